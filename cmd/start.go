@@ -21,18 +21,25 @@
 package cmd
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/pem"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/northwesternmutual/kanali/config"
 	"github.com/northwesternmutual/kanali/controller"
+	"github.com/northwesternmutual/kanali/handlers"
 	"github.com/northwesternmutual/kanali/monitor"
 	"github.com/northwesternmutual/kanali/server"
 	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/steps"
 	"github.com/northwesternmutual/kanali/tracer"
 	"github.com/opentracing/opentracing-go"
 	"github.com/spf13/cobra"
@@ -92,12 +99,20 @@ var startCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		// parse the proxies whose forwarding headers are trusted
+		if err := steps.LoadTrustedProxies(viper.GetStringSlice(config.FlagProxyTrustedProxies.GetLong())); err != nil {
+			logrus.Fatalf("could not load trusted proxies: %s", err.Error())
+			os.Exit(1)
+		}
+
 		// create tprs
 		if err := ctlr.CreateTPRs(); err != nil {
 			logrus.Fatalf("could not create TPRs: %s", err.Error())
 			os.Exit(1)
 		}
 
+		// not ready until every resource has been listed
+		server.AddReadinessCheck(ctlr.HasSynced)
 		go ctlr.Watch()
 
 		// start UDP server
@@ -108,35 +123,102 @@ var startCmd = &cobra.Command{
 			}
 		}()
 
+		// start active health checks of upstream pods
+		go steps.RunHealthChecks()
+
+		// create a sink for every enabled metrics backend
+		sink := monitor.NewSink()
+
+		// start admin server
+		go func() {
+			if err := server.StartAdminServer(sink.Prometheus()); err != nil {
+				logrus.Fatal(err.Error())
+				os.Exit(1)
+			}
+		}()
+
 		tracer, closer, err := tracer.Jaeger()
 		if err != nil {
 			logrus.Warnf("error create Jaeger tracer: %s", err.Error())
 		} else {
 			opentracing.SetGlobalTracer(tracer)
-			defer func() {
-				if err := closer.Close(); err != nil {
-					logrus.Warnf("error closing Jaeger tracer: %s", err.Error())
-				}
-			}()
 		}
 
-		influxCtlr, err := monitor.NewInfluxdbController()
+		gateway, err := server.NewGateway(sink)
 		if err != nil {
-			logrus.Warnf("error connecting to InfluxDB: %s", err.Error())
-		} else {
-			go influxCtlr.Run()
-			defer func() {
-				if err := influxCtlr.Client.Close(); err != nil {
-					logrus.Warnf("error closing the connection to InfluxDB: %s", err.Error())
-				}
-			}()
+			logrus.Fatal(err.Error())
+			os.Exit(1)
 		}
 
-		server.Start(influxCtlr)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- gateway.Serve()
+		}()
+
+		select {
+		case err := <-errs:
+			if err != nil {
+				logrus.Fatal(err.Error())
+				os.Exit(1)
+			}
+		case sig := <-signals:
+			logrus.Infof("received %s signal - shutting down", sig)
+			shutdown(gateway, sink, closer)
+		}
 
 	},
 }
 
+// shutdown gracefully stops Kanali. Readiness is reported as false first so
+// that Kubernetes stops routing new requests to this instance before it stops
+// accepting them. In flight requests are then drained and buffered metrics and
+// spans are flushed.
+func shutdown(gateway *server.Gateway, sink monitor.Sink, closer io.Closer) {
+	server.SetReady(false)
+	time.Sleep(viper.GetDuration(config.FlagServerShutdownDelay.GetLong()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration(config.FlagServerShutdownTimeout.GetLong()))
+	defer cancel()
+
+	if err := gateway.Shutdown(ctx); err != nil {
+		logrus.Warnf("error draining in flight requests: %s", err.Error())
+	}
+
+	if err := handlers.WaitForMetrics(ctx); err != nil {
+		logrus.Warnf("error waiting for request metrics: %s", err.Error())
+	}
+
+	if err := closeSink(ctx, sink); err != nil {
+		logrus.Warnf("error flushing request metrics: %s", err.Error())
+	}
+
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			logrus.Warnf("error closing Jaeger tracer: %s", err.Error())
+		}
+	}
+
+	logrus.Info("shutdown complete")
+}
+
+// closeSink closes a sink, giving up once the context is done
+// so that an unreachable backend cannot block the shutdown
+func closeSink(ctx context.Context, sink monitor.Sink) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- sink.Close()
+	}()
+	select {
+	case err := <-closed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func loadDecryptionKey(location string) error {
 
 	// read in private key
@@ -21,12 +21,43 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/northwesternmutual/kanali/metrics"
 	"github.com/stretchr/testify/assert"
 )
 
+// blockingSink is a sink whose Close blocks until it is released
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s *blockingSink) Name() string                              { return "blocking" }
+func (s *blockingSink) WriteRequestData(m *metrics.Metrics) error { return nil }
+func (s *blockingSink) Flush() error                              { return nil }
+func (s *blockingSink) Dropped() uint64                           { return 0 }
+func (s *blockingSink) Close() error {
+	<-s.release
+	return errors.New("closed")
+}
+
 func TestStartCmdInit(t *testing.T) {
 	assert.Equal(t, len(RootCmd.Commands()), 2)
 	assert.Equal(t, RootCmd.Commands()[0], startCmd)
 }
+
+func TestCloseSink(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	defer close(sink.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, closeSink(ctx, sink))
+
+	released := &blockingSink{release: make(chan struct{})}
+	close(released.release)
+	assert.Equal(t, "closed", closeSink(context.Background(), released).Error())
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package config
+
+func init() {
+	Flags.Add(
+		FlagAccessLogEnabled,
+		FlagAccessLogFormat,
+		FlagAccessLogTemplate,
+		FlagAccessLogOutput,
+		FlagAccessLogHeaders,
+		FlagAccessLogSuccessSampleRate,
+	)
+}
+
+var (
+	// FlagAccessLogEnabled specifies whether an access log entry is written for every request
+	FlagAccessLogEnabled = Flag{
+		Long:  "access_log.enabled",
+		Short: "",
+		Value: false,
+		Usage: "Write an access log entry for every request.",
+	}
+	// FlagAccessLogFormat specifies the format of access log entries
+	FlagAccessLogFormat = Flag{
+		Long:  "access_log.format",
+		Short: "",
+		Value: "json",
+		Usage: "Format of access log entries. Choose between 'json', 'combined' and 'template'.",
+	}
+	// FlagAccessLogTemplate specifies the template of access log entries when the template format is used
+	FlagAccessLogTemplate = Flag{
+		Long:  "access_log.template",
+		Short: "",
+		Value: "",
+		Usage: "Go template of access log entries when the format is 'template'. Any request metric can be referenced by name, e.g. {{.proxy_name}}.",
+	}
+	// FlagAccessLogOutput specifies where access log entries are written
+	FlagAccessLogOutput = Flag{
+		Long:  "access_log.output",
+		Short: "",
+		Value: "stdout",
+		Usage: "Where access log entries are written. Either 'stdout' or the path of a file.",
+	}
+	// FlagAccessLogHeaders specifies the request headers included in access log entries
+	FlagAccessLogHeaders = Flag{
+		Long:  "access_log.headers",
+		Short: "",
+		Value: []string{},
+		Usage: "Request headers included in JSON and template access log entries. Headers listed in --proxy.mask_header_keys are masked.",
+	}
+	// FlagAccessLogSuccessSampleRate specifies the fraction of successful requests that are logged
+	FlagAccessLogSuccessSampleRate = Flag{
+		Long:  "access_log.success_sample_rate",
+		Short: "",
+		Value: 1.0,
+		Usage: "Fraction of successful requests that are logged, between 0 and 1. Requests that fail with a 4xx or 5xx status are always logged.",
+	}
+)
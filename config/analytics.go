@@ -22,16 +22,80 @@ package config
 
 func init() {
 	Flags.Add(
+		FlagAnalyticsBackends,
 		FlagAnalyticsInfluxAddr,
 		FlagAnalyticsInfluxDb,
 		FlagAnalyticsInfluxUsername,
 		FlagAnalyticsInfluxPassword,
 		FlagAnalyticsInfluxBufferSize,
 		FlagAnalyticsInfluxMeasurement,
+		FlagAnalyticsInfluxFlushInterval,
+		FlagAnalyticsInfluxMaxPendingPoints,
+		FlagAnalyticsInfluxTimeout,
+		FlagAnalyticsQueueSize,
+		FlagAnalyticsStatsdAddr,
+		FlagAnalyticsStatsdPrefix,
+		FlagAnalyticsFilePath,
 	)
 }
 
 var (
+	// FlagAnalyticsBackends specifies the backends that request metrics are written to
+	FlagAnalyticsBackends = Flag{
+		Long:  "analytics.backends",
+		Short: "",
+		Value: []string{"influxdb"},
+		Usage: "Backends that request metrics are written to. Supported backends are influxdb, prometheus, statsd and file.",
+	}
+	// FlagAnalyticsInfluxFlushInterval specifies how often buffered request metrics are written to InfluxDB
+	FlagAnalyticsInfluxFlushInterval = Flag{
+		Long:  "analytics.influx_flush_interval",
+		Short: "",
+		Value: "0h0m10s",
+		Usage: "How often request metrics are written to InfluxDB, even if the buffer is not full. Zero only writes them when the buffer is full.",
+	}
+	// FlagAnalyticsInfluxMaxPendingPoints specifies the maximum number of points held while failed writes are retried
+	FlagAnalyticsInfluxMaxPendingPoints = Flag{
+		Long:  "analytics.influx_max_pending_points",
+		Short: "",
+		Value: 10000,
+		Usage: "Maximum number of request metrics held in memory while failed InfluxDB writes are retried. The oldest are dropped first.",
+	}
+	// FlagAnalyticsInfluxTimeout specifies how long a write to InfluxDB may take
+	FlagAnalyticsInfluxTimeout = Flag{
+		Long:  "analytics.influx_timeout",
+		Short: "",
+		Value: "0h0m10s",
+		Usage: "Length of time a write to InfluxDB may take before it fails and is retried.",
+	}
+	// FlagAnalyticsQueueSize specifies the number of requests whose metrics each backend can queue
+	FlagAnalyticsQueueSize = Flag{
+		Long:  "analytics.queue_size",
+		Short: "",
+		Value: 1000,
+		Usage: "Number of requests whose metrics each backend can queue. Metrics are dropped when the queue of a backend is full.",
+	}
+	// FlagAnalyticsStatsdAddr specifies the address of the StatsD server
+	FlagAnalyticsStatsdAddr = Flag{
+		Long:  "analytics.statsd_addr",
+		Short: "",
+		Value: "127.0.0.1:8125",
+		Usage: "StatsD address. Metrics are sent over UDP.",
+	}
+	// FlagAnalyticsStatsdPrefix specifies the prefix of every StatsD metric
+	FlagAnalyticsStatsdPrefix = Flag{
+		Long:  "analytics.statsd_prefix",
+		Short: "",
+		Value: "kanali",
+		Usage: "Prefix of every StatsD metric.",
+	}
+	// FlagAnalyticsFilePath specifies the file that request metrics are appended to
+	FlagAnalyticsFilePath = Flag{
+		Long:  "analytics.file_path",
+		Short: "",
+		Value: "",
+		Usage: "File that request metrics are appended to as JSON lines.",
+	}
 	// FlagAnalyticsInfluxAddr specifies the Influxdb address. Address should be of the form 'http://host:port' or 'http://[ipv6-host%zone]:port'
 	FlagAnalyticsInfluxAddr = Flag{
 		Long:  "analytics.influx_addr",
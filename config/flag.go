@@ -66,6 +66,8 @@ func (f flags) AddAll(cmd *cobra.Command) error {
 		switch v := currFlag.Value.(type) {
 		case int:
 			cmd.Flags().IntP(currFlag.Long, currFlag.Short, v, currFlag.Usage)
+		case float64:
+			cmd.Flags().Float64P(currFlag.Long, currFlag.Short, v, currFlag.Usage)
 		case bool:
 			cmd.Flags().BoolP(currFlag.Long, currFlag.Short, v, currFlag.Usage)
 		case string:
@@ -69,6 +69,12 @@ func TestAddAll(t *testing.T) {
 			Value: d,
 			Usage: "for testing",
 		},
+		Flag{
+			Long:  "float",
+			Short: "f",
+			Value: 0.5,
+			Usage: "for testing",
+		},
 		Flag{
 			Long:  "slice",
 			Short: "p",
@@ -82,6 +88,7 @@ func TestAddAll(t *testing.T) {
 	cobraValThree, _ := cmd.Flags().GetString("string")
 	cobraValFour, _ := cmd.Flags().GetDuration("duration")
 	cobraValFive, _ := cmd.Flags().GetStringSlice("slice")
+	cobraValSix, _ := cmd.Flags().GetFloat64("float")
 	assert.Equal(t, viper.GetString("string"), "hello world")
 	assert.Equal(t, viper.GetInt("int"), 1)
 	assert.True(t, viper.GetBool("bool"))
@@ -91,4 +98,6 @@ func TestAddAll(t *testing.T) {
 	assert.Equal(t, cobraValThree, "hello world")
 	assert.Equal(t, cobraValFour, d)
 	assert.Equal(t, cobraValFive, []string{"foo"})
+	assert.Equal(t, cobraValSix, 0.5)
+	assert.Equal(t, viper.GetFloat64("float"), 0.5)
 }
@@ -29,6 +29,16 @@ func init() {
 		FlagProxyMaskHeaderKeys,
 		FlagProxyTLSCommonNameValidation,
 		FlagProxyDefaultHeaderValues,
+		FlagProxyMaxIdleConns,
+		FlagProxyMaxIdleConnsPerHost,
+		FlagProxyIdleConnTimeout,
+		FlagProxyFlushInterval,
+		FlagProxyConnectTimeout,
+		FlagProxyResponseHeaderTimeout,
+		FlagProxyMaxRequestBodyBytes,
+		FlagProxyMaxHeaderBytes,
+		FlagProxyTrustedProxies,
+		FlagProxyMaxBufferedBodyBytes,
 	)
 }
 
@@ -59,7 +69,7 @@ var (
 		Long:  "proxy.upstream_timeout",
 		Short: "",
 		Value: "0h0m10s",
-		Usage: "Set length of upstream timeout. Defaults to none",
+		Usage: "Set length of upstream timeout. Defaults to none. Can be overridden per ApiProxy.",
 	}
 	// FlagProxyMaskHeaderKeys specifies which headers to mask.
 	FlagProxyMaskHeaderKeys = Flag{
@@ -82,4 +92,74 @@ var (
 		Value: map[string]string{},
 		Usage: "Specifies the default values for HTTP headers to be used in dynamic service discovery.",
 	}
+	// FlagProxyMaxIdleConns sets the maximum number of idle upstream connections kept open across all upstream hosts
+	FlagProxyMaxIdleConns = Flag{
+		Long:  "proxy.max_idle_conns",
+		Short: "",
+		Value: 100,
+		Usage: "Maximum number of idle upstream connections kept open across all upstream hosts. Zero means no limit.",
+	}
+	// FlagProxyMaxIdleConnsPerHost sets the maximum number of idle upstream connections kept open per upstream host
+	FlagProxyMaxIdleConnsPerHost = Flag{
+		Long:  "proxy.max_idle_conns_per_host",
+		Short: "",
+		Value: 10,
+		Usage: "Maximum number of idle upstream connections kept open per upstream host.",
+	}
+	// FlagProxyIdleConnTimeout sets how long an idle upstream connection is kept open
+	FlagProxyIdleConnTimeout = Flag{
+		Long:  "proxy.idle_conn_timeout",
+		Short: "",
+		Value: "0h1m30s",
+		Usage: "Length of time an idle upstream connection is kept open. Zero means no limit.",
+	}
+	// FlagProxyFlushInterval sets how often a streamed response is flushed to the client
+	FlagProxyFlushInterval = Flag{
+		Long:  "proxy.flush_interval",
+		Short: "",
+		Value: "0h0m0.1s",
+		Usage: "Interval at which responses of unknown length are flushed to the client. Zero flushes after every write. Event streams are always flushed after every write.",
+	}
+	// FlagProxyConnectTimeout sets how long establishing an upstream connection may take
+	FlagProxyConnectTimeout = Flag{
+		Long:  "proxy.connect_timeout",
+		Short: "",
+		Value: "0h0m30s",
+		Usage: "Length of time establishing an upstream connection may take. Can be overridden per ApiProxy.",
+	}
+	// FlagProxyResponseHeaderTimeout sets how long to wait for the headers of an upstream response
+	FlagProxyResponseHeaderTimeout = Flag{
+		Long:  "proxy.response_header_timeout",
+		Short: "",
+		Value: "0h0m0s",
+		Usage: "Length of time to wait for the headers of an upstream response once the request is written. Zero means no limit. Can be overridden per ApiProxy.",
+	}
+	// FlagProxyMaxRequestBodyBytes sets the maximum size of a request body
+	FlagProxyMaxRequestBodyBytes = Flag{
+		Long:  "proxy.max_request_body_bytes",
+		Short: "",
+		Value: 0,
+		Usage: "Maximum size of a request body in bytes. Larger requests are rejected with a 413. Zero means no limit. Can be overridden per ApiProxy.",
+	}
+	// FlagProxyMaxHeaderBytes sets the maximum size of the headers of a request
+	FlagProxyMaxHeaderBytes = Flag{
+		Long:  "proxy.max_header_bytes",
+		Short: "",
+		Value: 1048576,
+		Usage: "Maximum size of the headers of a request in bytes. Larger requests are rejected with a 431. Can be lowered per ApiProxy.",
+	}
+	// FlagProxyTrustedProxies lists the proxies whose forwarding headers are trusted
+	FlagProxyTrustedProxies = Flag{
+		Long:  "proxy.trusted_proxies",
+		Short: "",
+		Value: []string{},
+		Usage: "IP addresses and CIDR ranges of the proxies in front of Kanali. Forwarding headers are only kept when they were sent by one of these proxies.",
+	}
+	// FlagProxyMaxBufferedBodyBytes sets the maximum size of a request body that is buffered in memory
+	FlagProxyMaxBufferedBodyBytes = Flag{
+		Long:  "proxy.max_buffered_body_bytes",
+		Short: "",
+		Value: 1048576,
+		Usage: "Maximum size of a request body in bytes that is buffered so that the request can be retried or mirrored. Requests with larger bodies are neither retried nor mirrored. Zero means no limit.",
+	}
 )
@@ -26,6 +26,9 @@ func init() {
 		FlagServerBindAddress,
 		FlagServerPeerUDPPort,
 		FlagServerProxyProtocol,
+		FlagServerAdminPort,
+		FlagServerShutdownDelay,
+		FlagServerShutdownTimeout,
 	)
 }
 
@@ -58,4 +61,25 @@ var (
 		Value: false,
 		Usage: "Maintain the integrity of the remote client IP address when incoming traffic to Kanali includes the Proxy Protocol header.",
 	}
+	// FlagServerAdminPort sets the port that the Kanali admin server will listen on
+	FlagServerAdminPort = Flag{
+		Long:  "server.admin_port",
+		Short: "",
+		Value: 0,
+		Usage: "Sets the port that the admin server will listen on. The admin server is disabled if not set.",
+	}
+	// FlagServerShutdownDelay sets how long Kanali keeps accepting requests after reporting that it is not ready
+	FlagServerShutdownDelay = Flag{
+		Long:  "server.shutdown_delay",
+		Short: "",
+		Value: "0h0m5s",
+		Usage: "Length of time Kanali keeps accepting requests after it starts shutting down and reports that it is not ready.",
+	}
+	// FlagServerShutdownTimeout sets how long Kanali waits for in flight requests to complete when shutting down
+	FlagServerShutdownTimeout = Flag{
+		Long:  "server.shutdown_timeout",
+		Short: "",
+		Value: "0h0m30s",
+		Usage: "Length of time Kanali waits for in flight requests to complete when shutting down.",
+	}
 )
@@ -25,6 +25,9 @@ func init() {
 		FlagTLSCertFile,
 		FlagTLSKeyFile,
 		FlagTLSCaFile,
+		FlagTLSMinVersion,
+		FlagTLSCipherSuites,
+		FlagTLSClientAuth,
 	)
 }
 
@@ -50,4 +53,25 @@ var (
 		Value: "",
 		Usage: "Path to x509 certificate authority bundle for mutual TLS.",
 	}
+	// FlagTLSMinVersion specifies the minimum TLS version accepted by HTTPS servers
+	FlagTLSMinVersion = Flag{
+		Long:  "tls.min_version",
+		Short: "",
+		Value: "1.0",
+		Usage: "Minimum TLS version accepted by HTTPS servers. Choose between '1.0', '1.1', '1.2'.",
+	}
+	// FlagTLSCipherSuites specifies the cipher suites accepted by HTTPS servers
+	FlagTLSCipherSuites = Flag{
+		Long:  "tls.cipher_suites",
+		Short: "",
+		Value: []string{},
+		Usage: "Cipher suites accepted by HTTPS servers, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Defaults to the Go defaults.",
+	}
+	// FlagTLSClientAuth specifies whether HTTPS servers verify client certificates
+	FlagTLSClientAuth = Flag{
+		Long:  "tls.client_auth",
+		Short: "",
+		Value: "",
+		Usage: "Client certificate verification mode. Choose between 'none', 'request', 'require'. Defaults to 'require' if --tls.ca_file is set and 'none' otherwise.",
+	}
 )
@@ -24,6 +24,8 @@ func init() {
 	Flags.Add(
 		FlagTracingJaegerServerURL,
 		FlagTracingJaegerAgentURL,
+		FlagTracingMaxBodyBytes,
+		FlagTracingBodyContentTypes,
 	)
 }
 
@@ -42,4 +44,18 @@ var (
 		Value: "jaeger-all-in-one-agent.default.svc.cluster.local",
 		Usage: "Endpoint to the Jaeger agent",
 	}
+	// FlagTracingMaxBodyBytes sets the maximum number of body bytes recorded on a span
+	FlagTracingMaxBodyBytes = Flag{
+		Long:  "tracing.max_body_bytes",
+		Short: "",
+		Value: 4096,
+		Usage: "Maximum number of bytes of a request or response body recorded on a span. Zero disables body recording.",
+	}
+	// FlagTracingBodyContentTypes specifies the content types whose bodies are recorded on a span
+	FlagTracingBodyContentTypes = Flag{
+		Long:  "tracing.body_content_types",
+		Short: "",
+		Value: []string{"application/json", "application/xml", "application/x-www-form-urlencoded", "text/plain"},
+		Usage: "Content types whose request and response bodies are recorded on a span. A subtype may be a wildcard.",
+	}
 )
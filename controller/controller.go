@@ -38,6 +38,7 @@ type Controller struct {
 	RestClient *restclient.RESTClient
 	ClientSet  internalclientset.Interface
 	MasterHost string
+	syncs      *syncTracker
 }
 
 // New creates a new kubernetes controller
@@ -63,6 +64,7 @@ func New() (*Controller, error) {
 	controller := &Controller{
 		RestClient: restClient,
 		ClientSet:  clientSet,
+		syncs:      newSyncTracker(watchedResources),
 	}
 
 	// Returns a client.Config for accessing the Kubernetes server.
@@ -80,6 +80,9 @@ func (h k8sEventHandler) addFunc(obj interface{}) {
 			if endpoints.ObjectMeta.Name == "kanali" {
 				spec.KanaliEndpoints = &endpoints
 			}
+			if err := spec.EndpointsStore.Set(endpoints); err != nil {
+				logrus.Errorf("could not add endpoints. skipping: %s", err.Error())
+			}
 		}
 	case api.ConfigMap:
 		if cm, ok := obj.(api.ConfigMap); ok {
@@ -136,6 +139,10 @@ func (h k8sEventHandler) updateFunc(obj interface{}) {
 			if endpoints.ObjectMeta.Name == "kanali" {
 				spec.KanaliEndpoints = &endpoints
 			}
+			if err := spec.EndpointsStore.Update(endpoints); err != nil {
+				logrus.Errorf("could not modify endpoints. skipping: %s", err.Error())
+			}
+			spec.HealthStore.Prune(endpoints)
 		}
 	case api.ConfigMap:
 		if cm, ok := obj.(api.ConfigMap); ok {
@@ -186,6 +193,14 @@ func (h k8sEventHandler) deleteFunc(obj interface{}) {
 			if err != nil {
 				logrus.Errorf("could not delete service. skipping: %s", err.Error())
 			}
+			spec.BreakerStore.Evict(service.ObjectMeta.Namespace, service.ObjectMeta.Name)
+		}
+	case api.Endpoints:
+		if endpoints, ok := obj.(api.Endpoints); ok {
+			if _, err := spec.EndpointsStore.Delete(endpoints); err != nil {
+				logrus.Errorf("could not delete endpoints. skipping: %s", err.Error())
+			}
+			spec.HealthStore.Evict(endpoints.ObjectMeta.Namespace, endpoints.ObjectMeta.Name)
 		}
 	case api.ConfigMap:
 		if cm, ok := obj.(api.ConfigMap); ok {
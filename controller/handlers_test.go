@@ -130,6 +130,8 @@ func TestAddFunc(t *testing.T) {
 	}
 	handlers.addFunc(ep)
 	assert.Equal(t, *(spec.KanaliEndpoints), ep)
+	result, _ = spec.EndpointsStore.Get("kanali", "bar")
+	assert.Equal(t, ep, result)
 
 	mockOne, _ := json.Marshal([]spec.Route{
 		{
@@ -260,6 +262,8 @@ func TestUpdateFunc(t *testing.T) {
 	}
 	handlers.updateFunc(ep)
 	assert.Equal(t, *(spec.KanaliEndpoints), ep)
+	result, _ = spec.EndpointsStore.Get("kanali", "bar")
+	assert.Equal(t, ep, result)
 
 	mockOne, _ := json.Marshal([]spec.Route{
 		{
@@ -382,9 +386,22 @@ func TestDeleteFunc(t *testing.T) {
 	}
 
 	spec.ServiceStore.Set(spec.CreateService(service))
+	spec.BreakerStore.Record("bar", "foo", spec.CircuitBreaker{FailureThreshold: 1}, false)
 	assert.False(t, spec.ServiceStore.IsEmpty())
 	handlers.deleteFunc(service)
 	assert.True(t, spec.ServiceStore.IsEmpty())
+	assert.True(t, spec.BreakerStore.IsEmpty(), "the circuit breaker of a deleted service is evicted")
+
+	ep := api.Endpoints{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "foo",
+			Namespace: "bar",
+		},
+	}
+	spec.EndpointsStore.Set(ep)
+	assert.False(t, spec.EndpointsStore.IsEmpty())
+	handlers.deleteFunc(ep)
+	assert.True(t, spec.EndpointsStore.IsEmpty())
 
 	mockOne, _ := json.Marshal([]spec.Route{
 		{
@@ -417,6 +434,7 @@ func clearAllStores() {
 	spec.SecretStore.Clear()
 	spec.ServiceStore.Clear()
 	spec.MockResponseStore.Clear()
+	spec.EndpointsStore.Clear()
 }
 
 func setDecryptionKey(t *testing.T) {
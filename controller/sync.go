@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controller
+
+import "sync"
+
+// syncTracker records which watched resources have
+// completed their initial list since Kanali started
+type syncTracker struct {
+	mutex   sync.RWMutex
+	pending map[string]bool
+}
+
+func newSyncTracker(resources []string) *syncTracker {
+	pending := make(map[string]bool, len(resources))
+	for _, resource := range resources {
+		pending[resource] = true
+	}
+	return &syncTracker{pending: pending}
+}
+
+func (s *syncTracker) done(resource string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pending, resource)
+}
+
+func (s *syncTracker) hasSynced() bool {
+	if s == nil {
+		return false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.pending) == 0
+}
+
+// HasSynced reports whether the initial list of every watched resource has
+// been handled, i.e. whether every store reflects the state of the cluster
+func (c *Controller) HasSynced() bool {
+	return c.syncs.hasSynced()
+}
@@ -39,8 +39,23 @@ const (
 	added    = "ADDED"
 	modified = "MODIFIED"
 	deleted  = "DELETED"
+	// synced is an internal event type marking the end of the initial
+	// list of a resource. Its object is the function to call once every
+	// preceding event has been handled.
+	synced = "SYNCED"
 )
 
+// watchedResources are the Kubernetes resources that Kanali watches
+var watchedResources = []string{
+	"apis/kanali.io/v1/apikeies",
+	"apis/kanali.io/v1/apikeybindings",
+	"apis/kanali.io/v1/apiproxies",
+	"api/v1/secrets?fieldSelector=type%3Dkubernetes.io/tls",
+	"api/v1/services",
+	"api/v1/configmaps",
+	"api/v1/endpoints",
+}
+
 // event is an internal struct which we
 // we use to hold unmarshalled json events
 // from the kubernetes api server
@@ -57,6 +72,15 @@ type rawEvent struct {
 	Object json.RawMessage
 }
 
+// rawList is an internal struct which we
+// we use to hold a raw list of resources
+// from the kubernetes api server
+type rawList struct {
+	unversioned.TypeMeta `json:",inline"`
+	unversioned.ListMeta `json:"metadata,omitempty"`
+	Items                []json.RawMessage `json:"items"`
+}
+
 // Watch will use goroutines and channels to
 // listen to different endpoints on the kubernetes
 // api server and act on events that they emit
@@ -72,13 +96,9 @@ func (c *Controller) Watch() {
 
 	// start listening for events and put
 	// them on the channel
-	go c.watchResource(eventCh, "apis/kanali.io/v1/apikeies?watch=true")
-	go c.watchResource(eventCh, "apis/kanali.io/v1/apikeybindings?watch=true")
-	go c.watchResource(eventCh, "apis/kanali.io/v1/apiproxies?watch=true")
-	go c.watchResource(eventCh, "api/v1/secrets?fieldSelector=type%3Dkubernetes.io/tls&watch=true")
-	go c.watchResource(eventCh, "api/v1/services?watch=true")
-	go c.watchResource(eventCh, "api/v1/configmaps?watch=true")
-	go c.watchResource(eventCh, "api/v1/endpoints?watch=true")
+	for _, resource := range watchedResources {
+		go c.watchResource(eventCh, resource)
+	}
 
 }
 
@@ -93,20 +113,37 @@ func monitor(ev chan *event, h handlerFuncs) {
 			h.updateFunc(current.Object)
 		case deleted:
 			h.deleteFunc(current.Object)
+		case synced:
+			if f, ok := current.Object.(func()); ok {
+				f()
+			}
 		}
 	}
 }
 
-func (c *Controller) watchResource(eventCh chan *event, url string) {
+func (c *Controller) watchResource(eventCh chan *event, resource string) {
 	for {
-		if err := c.doWatchResource(eventCh, url); err != nil {
+		if err := c.doWatchResource(eventCh, resource); err != nil {
 			logrus.Warnf(err.Error())
 			time.Sleep(5 * time.Second)
 		}
 	}
 }
 
-func (c *Controller) doWatchResource(eventCh chan *event, url string) error {
+// doWatchResource lists every existing instance of a resource before watching
+// it for changes. Once the list has been handled, the resource is synced.
+func (c *Controller) doWatchResource(eventCh chan *event, resource string) error {
+
+	resourceVersion, err := c.listResource(eventCh, resource)
+	if err != nil {
+		return err
+	}
+	eventCh <- &event{
+		Type:   synced,
+		Object: func() { c.syncs.done(resource) },
+	}
+
+	url := fmt.Sprintf("%s%swatch=true&resourceVersion=%s", resource, querySeparator(resource), resourceVersion)
 
 	logrus.Infof("attempt to watch %s", url)
 
@@ -148,6 +185,58 @@ func (c *Controller) doWatchResource(eventCh chan *event, url string) error {
 
 }
 
+// listResource sends an added event for every existing instance of a
+// resource and returns the resource version at which they were listed
+func (c *Controller) listResource(eventCh chan *event, resource string) (string, error) {
+
+	logrus.Infof("attempt to list %s", resource)
+
+	resp, err := c.RestClient.Client.Get(fmt.Sprintf("%s/%s", c.MasterHost, resource))
+	if err != nil {
+		return "", fmt.Errorf("trouble connecting to k8s apiserver: %s", err.Error())
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logrus.Errorf("error closing response body: %s", err.Error())
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotFound && strings.Contains(resource, "kanali.io") {
+		if err := c.CreateTPRs(); err != nil {
+			return "", err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("k8s apiserver returned a %d status code", resp.StatusCode)
+	}
+
+	list := &rawList{}
+	if err := json.NewDecoder(resp.Body).Decode(list); err != nil {
+		return "", fmt.Errorf("error decoding list of %s: %s", resource, err.Error())
+	}
+
+	// the items of a list do not always declare their kind
+	kind := strings.TrimSuffix(list.Kind, "List")
+	for _, item := range list.Items {
+		e := &event{Type: added}
+		if err := handleValidEvent(kind, item, e); err != nil {
+			return "", err
+		}
+		eventCh <- e
+	}
+
+	return list.ResourceVersion, nil
+
+}
+
+func querySeparator(url string) string {
+	if strings.Contains(url, "?") {
+		return "&"
+	}
+	return "?"
+}
+
 func pollStream(decoder *json.Decoder) (*event, error) {
 
 	re := &rawEvent{}
@@ -22,6 +22,8 @@ package controller
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
@@ -30,6 +32,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/restclient"
 )
 
 type testHandlerFuncs struct {
@@ -228,3 +231,60 @@ func getTestAPIProxy() spec.APIProxy {
 		},
 	}
 }
+
+func TestDoWatchResource(t *testing.T) {
+	k8s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/services", r.URL.Path)
+		if r.URL.Query().Get("watch") != "true" {
+			fmt.Fprint(w, `{"kind":"ServiceList","metadata":{"resourceVersion":"42"},"items":[{"metadata":{"name":"foo","namespace":"bar"},"spec":{"clusterIP":"1.2.3.4"}}]}`)
+			return
+		}
+		assert.Equal(t, "42", r.URL.Query().Get("resourceVersion"))
+		fmt.Fprint(w, `{"type":"MODIFIED","object":{"kind":"Service","metadata":{"name":"foo","namespace":"bar"},"spec":{"clusterIP":"5.6.7.8"}}}`)
+	}))
+	defer k8s.Close()
+
+	c := &Controller{
+		RestClient: &restclient.RESTClient{Client: http.DefaultClient},
+		MasterHost: k8s.URL,
+		syncs:      newSyncTracker([]string{"api/v1/services"}),
+	}
+
+	eventCh := make(chan *event)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.doWatchResource(eventCh, "api/v1/services")
+	}()
+
+	e := <-eventCh
+	assert.Equal(t, added, e.Type)
+	assert.Equal(t, "1.2.3.4", e.Object.(api.Service).Spec.ClusterIP)
+
+	e = <-eventCh
+	assert.Equal(t, synced, e.Type)
+	assert.False(t, c.HasSynced())
+	e.Object.(func())()
+	assert.True(t, c.HasSynced())
+
+	e = <-eventCh
+	assert.Equal(t, modified, e.Type)
+	assert.Equal(t, "5.6.7.8", e.Object.(api.Service).Spec.ClusterIP)
+
+	assert.NotNil(t, <-errCh, "a closed watch should be reported")
+}
+
+func TestHasSynced(t *testing.T) {
+	assert.False(t, (&Controller{}).HasSynced())
+
+	c := &Controller{syncs: newSyncTracker([]string{"one", "two"})}
+	assert.False(t, c.HasSynced())
+	c.syncs.done("one")
+	assert.False(t, c.HasSynced())
+	c.syncs.done("two")
+	assert.True(t, c.HasSynced())
+}
+
+func TestQuerySeparator(t *testing.T) {
+	assert.Equal(t, "?", querySeparator("api/v1/services"))
+	assert.Equal(t, "&", querySeparator("api/v1/secrets?fieldSelector=type%3Dkubernetes.io/tls"))
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/northwesternmutual/kanali/metrics"
 	"github.com/northwesternmutual/kanali/spec"
 	"github.com/northwesternmutual/kanali/tracer"
+	"github.com/northwesternmutual/kanali/utils"
 	"github.com/opentracing/opentracing-go"
 )
 
@@ -42,11 +43,12 @@ func (f *Flow) Add(steps ...Step) {
 }
 
 // Play executes all step in a flow in the order they were added.
+// No further steps are executed once the context is done.
 func (f *Flow) Play(ctx context.Context, proxy *spec.APIProxy, metrics *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, trace opentracing.Span) error {
 	logrus.Debugf("flow with %d step about to play", len(*f))
 	for _, step := range *f {
 		logrus.Debugf("playing step %s", step.GetName())
-		if err := step.Do(ctx, proxy, metrics, w, r, resp, trace); err != nil {
+		if err := play(ctx, step, proxy, metrics, w, r, resp, trace); err != nil {
 			trace.SetTag(tracer.Error, true)
 			trace.LogKV(
 				"event", "error",
@@ -57,3 +59,10 @@ func (f *Flow) Play(ctx context.Context, proxy *spec.APIProxy, metrics *metrics.
 	}
 	return nil
 }
+
+func play(ctx context.Context, step Step, proxy *spec.APIProxy, metrics *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, trace opentracing.Span) error {
+	if err := utils.ContextError(ctx); err != nil {
+		return err
+	}
+	return step.Do(ctx, proxy, metrics, w, r, resp, trace)
+}
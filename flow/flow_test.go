@@ -70,3 +70,12 @@ func TestPlay(t *testing.T) {
 	f.Add(mockErrorStep{})
 	assert.Error(t, f.Play(context.Background(), nil, nil, nil, nil, nil, opentracing.StartSpan("test span")))
 }
+
+func TestPlayCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f := &Flow{}
+	f.Add(mockErrorStep{})
+	err := f.Play(ctx, nil, nil, nil, nil, nil, opentracing.StartSpan("test span"))
+	assert.Equal(t, "client closed request", err.Error())
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/spf13/viper"
+)
+
+const (
+	accessLogFormatJSON     = "json"
+	accessLogFormatCombined = "combined"
+	accessLogFormatTemplate = "template"
+
+	combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// AccessLogger writes an entry for every request that it samples
+type AccessLogger struct {
+	mutex      sync.Mutex
+	out        io.Writer
+	format     string
+	template   *template.Template
+	headers    []string
+	sampleRate float64
+}
+
+// NewAccessLogger creates an access logger from the configuration.
+// It returns nil if access logging is not enabled.
+func NewAccessLogger() (*AccessLogger, error) {
+	if !viper.GetBool(config.FlagAccessLogEnabled.GetLong()) {
+		return nil, nil
+	}
+
+	l := &AccessLogger{
+		format:     viper.GetString(config.FlagAccessLogFormat.GetLong()),
+		headers:    viper.GetStringSlice(config.FlagAccessLogHeaders.GetLong()),
+		sampleRate: viper.GetFloat64(config.FlagAccessLogSuccessSampleRate.GetLong()),
+	}
+
+	switch l.format {
+	case accessLogFormatJSON, accessLogFormatCombined:
+	case accessLogFormatTemplate:
+		tmpl, err := template.New("access_log").Option("missingkey=zero").Parse(viper.GetString(config.FlagAccessLogTemplate.GetLong()))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing access log template: %s", err.Error())
+		}
+		l.template = tmpl
+	default:
+		return nil, fmt.Errorf("access log format %s is not supported", l.format)
+	}
+
+	switch output := viper.GetString(config.FlagAccessLogOutput.GetLong()); output {
+	case "", "stdout":
+		l.out = os.Stdout
+	default:
+		file, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening access log: %s", err.Error())
+		}
+		l.out = file
+	}
+
+	return l, nil
+}
+
+// Log writes an access log entry for a request if it is sampled. Requests
+// that failed are always logged while successful ones are sampled.
+func (l *AccessLogger) Log(r *http.Request, status, size int, t time.Time, m *metrics.Metrics) error {
+	if status < http.StatusBadRequest && rand.Float64() >= l.sampleRate {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	switch l.format {
+	case accessLogFormatCombined:
+		writeCombined(&buf, r, status, size, t, m)
+	case accessLogFormatTemplate:
+		if err := l.template.Execute(&buf, l.entry(r, status, size, t, m)); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+	default:
+		if err := json.NewEncoder(&buf).Encode(l.entry(r, status, size, t, m)); err != nil {
+			return err
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, err := buf.WriteTo(l.out)
+	return err
+}
+
+// entry returns every request metric along with details of the request and response
+func (l *AccessLogger) entry(r *http.Request, status, size int, t time.Time, m *metrics.Metrics) map[string]interface{} {
+	entry := map[string]interface{}{}
+	for _, metric := range *m {
+		entry[metric.Name] = metric.Value
+	}
+	entry["time"] = t.Format(time.RFC3339Nano)
+	entry["status"] = status
+	entry["bytes"] = size
+	entry["protocol"] = r.Proto
+	entry["user_agent"] = r.UserAgent()
+	entry["referer"] = r.Referer()
+
+	headers := map[string]string{}
+	masked := viper.GetStringSlice(config.FlagProxyMaskHeaderKeys.GetLong())
+	for _, name := range l.headers {
+		value := r.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		if containsHeader(masked, name) {
+			value = viper.GetString(config.FlagProxyHeaderMaskValue.GetLong())
+		}
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+	entry["headers"] = headers
+
+	return entry
+}
+
+// writeCombined writes an entry in the Apache combined log format. Values
+// sent by the client are escaped so that they cannot forge log entries.
+func writeCombined(w io.Writer, r *http.Request, status, size int, t time.Time, m *metrics.Metrics) {
+	clientIP := "-"
+	if metric := m.Get("client_ip"); metric != nil {
+		clientIP = fmt.Sprintf("%v", metric.Value)
+	}
+	fmt.Fprintf(w, "%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		clientIP,
+		t.Format(combinedTimeFormat),
+		escapeLogItem(r.Method),
+		escapeLogItem(r.RequestURI),
+		escapeLogItem(r.Proto),
+		status,
+		orDash(size),
+		orDashString(escapeLogItem(r.Referer())),
+		orDashString(escapeLogItem(r.UserAgent())),
+	)
+}
+
+func containsHeader(headers []string, name string) bool {
+	for _, h := range headers {
+		if http.CanonicalHeaderKey(h) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func orDash(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
+
+func orDashString(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeLogItem escapes a value the way Apache does: quotes and backslashes
+// are prefixed with a backslash while other control characters and bytes
+// outside of printable ASCII are written as escape sequences
+func escapeLogItem(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&buf, `\x%02x`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var accessLogTime = time.Date(2017, time.December, 1, 13, 4, 5, 0, time.UTC)
+
+func getTestAccessLogRequest() (*http.Request, *metrics.Metrics) {
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts?id=1", nil)
+	r.RequestURI = "/api/v1/accounts?id=1"
+	r.Header.Set("User-Agent", "curl/7.54.0")
+	r.Header.Set("apikey", "secret")
+	r.Header.Set("X-Tenant", "acme")
+	return r, &metrics.Metrics{
+		metrics.Metric{Name: "client_ip", Value: "10.0.0.1", Index: false},
+		metrics.Metric{Name: "proxy_name", Value: "accounts", Index: true},
+		metrics.Metric{Name: "total_time", Value: 12, Index: false},
+		metrics.Metric{Name: "upstream_host", Value: "accounts.default.svc.cluster.local:8080", Index: false},
+	}
+}
+
+func TestNewAccessLogger(t *testing.T) {
+	defer viper.Reset()
+
+	l, err := NewAccessLogger()
+	assert.Nil(t, err)
+	assert.Nil(t, l, "access logging is disabled by default")
+
+	viper.Set(config.FlagAccessLogEnabled.GetLong(), true)
+	viper.Set(config.FlagAccessLogFormat.GetLong(), "xml")
+	_, err = NewAccessLogger()
+	assert.Equal(t, "access log format xml is not supported", err.Error())
+
+	viper.Set(config.FlagAccessLogFormat.GetLong(), "template")
+	viper.Set(config.FlagAccessLogTemplate.GetLong(), "{{.proxy_name")
+	_, err = NewAccessLogger()
+	assert.NotNil(t, err)
+
+	dir, _ := ioutil.TempDir("", "kanali")
+	defer os.RemoveAll(dir)
+	viper.Set(config.FlagAccessLogFormat.GetLong(), "json")
+	viper.Set(config.FlagAccessLogOutput.GetLong(), filepath.Join(dir, "access.log"))
+	viper.Set(config.FlagAccessLogSuccessSampleRate.GetLong(), 1.0)
+	l, err = NewAccessLogger()
+	assert.Nil(t, err)
+
+	r, m := getTestAccessLogRequest()
+	assert.Nil(t, l.Log(r, http.StatusOK, 42, accessLogTime, m))
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "access.log"))
+	assert.Contains(t, string(data), `"proxy_name":"accounts"`)
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	defer viper.Reset()
+	viper.Set(config.FlagProxyMaskHeaderKeys.GetLong(), []string{"apikey"})
+	viper.Set(config.FlagProxyHeaderMaskValue.GetLong(), "omitted")
+
+	out := new(bytes.Buffer)
+	l := &AccessLogger{out: out, format: accessLogFormatJSON, headers: []string{"apikey", "x-tenant", "x-missing"}, sampleRate: 1}
+	r, m := getTestAccessLogRequest()
+	assert.Nil(t, l.Log(r, http.StatusOK, 42, accessLogTime, m))
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "2017-12-01T13:04:05Z", entry["time"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, float64(42), entry["bytes"])
+	assert.Equal(t, float64(12), entry["total_time"])
+	assert.Equal(t, "accounts", entry["proxy_name"])
+	assert.Equal(t, "accounts.default.svc.cluster.local:8080", entry["upstream_host"])
+	assert.Equal(t, "curl/7.54.0", entry["user_agent"])
+	assert.Equal(t, map[string]interface{}{"Apikey": "omitted", "X-Tenant": "acme"}, entry["headers"])
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	out := new(bytes.Buffer)
+	l := &AccessLogger{out: out, format: accessLogFormatCombined, sampleRate: 1}
+	r, m := getTestAccessLogRequest()
+	assert.Nil(t, l.Log(r, http.StatusNotFound, 0, accessLogTime, m))
+	assert.Equal(t, `10.0.0.1 - - [01/Dec/2017:13:04:05 +0000] "GET /api/v1/accounts?id=1 HTTP/1.1" 404 - "-" "curl/7.54.0"`+"\n", out.String())
+}
+
+func TestEscapeLogItem(t *testing.T) {
+	assert.Equal(t, "curl/7.54.0", escapeLogItem("curl/7.54.0"))
+	assert.Equal(t, `a \"quoted\" \\ value`, escapeLogItem(`a "quoted" \ value`))
+	assert.Equal(t, `forged\n10.0.0.2 - - \t\x1b\xc3\xa9`, escapeLogItem("forged\n10.0.0.2 - - \t\x1b\u00e9"))
+
+	out := new(bytes.Buffer)
+	l := &AccessLogger{out: out, format: accessLogFormatCombined, sampleRate: 1}
+	r, m := getTestAccessLogRequest()
+	r.Header.Set("User-Agent", `evil" "agent`)
+	assert.Nil(t, l.Log(r, http.StatusOK, 42, accessLogTime, m))
+	assert.Contains(t, out.String(), `"evil\" \"agent"`)
+}
+
+func TestAccessLogTemplate(t *testing.T) {
+	defer viper.Reset()
+	viper.Set(config.FlagAccessLogEnabled.GetLong(), true)
+	viper.Set(config.FlagAccessLogFormat.GetLong(), "template")
+	viper.Set(config.FlagAccessLogTemplate.GetLong(), "{{.status}} {{.proxy_name}} {{.total_time}}ms {{.upstream_host}} {{.missing}}")
+	viper.Set(config.FlagAccessLogSuccessSampleRate.GetLong(), 1.0)
+
+	l, err := NewAccessLogger()
+	assert.Nil(t, err)
+	out := new(bytes.Buffer)
+	l.out = out
+
+	r, m := getTestAccessLogRequest()
+	assert.Nil(t, l.Log(r, http.StatusOK, 42, accessLogTime, m))
+	assert.Equal(t, "200 accounts 12ms accounts.default.svc.cluster.local:8080 <no value>\n", out.String())
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	out := new(bytes.Buffer)
+	l := &AccessLogger{out: out, format: accessLogFormatCombined, sampleRate: 0}
+	r, m := getTestAccessLogRequest()
+
+	// successes are not sampled while errors are always logged
+	assert.Nil(t, l.Log(r, http.StatusOK, 42, accessLogTime, m))
+	assert.Equal(t, 0, out.Len())
+	assert.Nil(t, l.Log(r, http.StatusTooManyRequests, 42, accessLogTime, m))
+	assert.Contains(t, out.String(), " 429 42 ")
+}
+
+func TestServeHTTPAccessLog(t *testing.T) {
+	out := new(bytes.Buffer)
+	h := Handler{
+		AccessLog: &AccessLogger{out: out, format: accessLogFormatCombined, sampleRate: 1},
+		H: func(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, trace opentracing.Span) error {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+			return nil
+		},
+	}
+
+	r, _ := http.NewRequest("POST", "/accounts", nil)
+	r.RequestURI = "/accounts"
+	r.RemoteAddr = "10.0.0.1:54321"
+	h.serveHTTP(httptest.NewRecorder(), r)
+	assert.Nil(t, WaitForMetrics(context.Background()))
+	assert.Contains(t, out.String(), `10.0.0.1 - - [`)
+	assert.Contains(t, out.String(), `"POST /accounts HTTP/1.1" 201 7 "-" "-"`)
+}
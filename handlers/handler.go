@@ -26,39 +26,86 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/northwesternmutual/kanali/metrics"
 	"github.com/northwesternmutual/kanali/monitor"
 	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/steps"
 	"github.com/northwesternmutual/kanali/tracer"
 	"github.com/northwesternmutual/kanali/utils"
 	"github.com/opentracing/opentracing-go"
 )
 
+// metricWrites tracks the request metrics that are still being written
+var metricWrites sync.WaitGroup
+
+// WaitForMetrics waits until the metrics of every completed request have been
+// handed off to every metrics backend or the context expires, in which case its error is returned
+func WaitForMetrics(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		metricWrites.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Handler is used to provide additional parameters to an HTTP handler
 type Handler struct {
-	*monitor.InfluxController
-	H func(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, trace opentracing.Span) error
+	Sink      monitor.Sink
+	AccessLog *AccessLogger
+	H         func(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, trace opentracing.Span) error
 }
 
 func (h Handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 
 	t0 := time.Now()
 	m := &metrics.Metrics{}
+	ctx, pending := metrics.WithPending(r.Context())
+	rec := newResponseRecorder(w)
+	w = rec
+
+	// every request is identified so that it can be correlated across
+	// logs, traces and metrics as well as by the upstream service
+	requestID := utils.RequestID(r)
+	ctx = utils.WithRequestID(ctx, requestID)
+	w.Header().Set(utils.RequestIDHeader, requestID)
+	m.Add(metrics.Metric{Name: "request_id", Value: requestID, Index: false})
 
 	defer func() {
+		status, size := rec.status, rec.bytes
 		m.Add(
 			metrics.Metric{Name: "total_time", Value: int(time.Now().Sub(t0) / time.Millisecond), Index: false},
 			metrics.Metric{Name: "http_method", Value: r.Method, Index: false},
 			metrics.Metric{Name: "http_uri", Value: utils.ComputeURLPath(r.URL), Index: false},
-			metrics.Metric{Name: "client_ip", Value: strings.Split(r.RemoteAddr, ":")[0], Index: false},
+			metrics.Metric{Name: "client_ip", Value: steps.ClientIP(r), Index: false},
+			metrics.Metric{Name: "response_bytes", Value: size, Index: false},
 		)
+		metricWrites.Add(1)
 		go func() {
-			if err := h.InfluxController.WriteRequestData(m); err != nil {
-				logrus.Warnf("error enqueuing request metrics for future InfluxDB write: %s", err.Error())
+			defer metricWrites.Done()
+			// metrics produced in the background on behalf of this request,
+			// e.g. by a mirrored request, are written along with it
+			m.Add(pending.Wait()...)
+			if h.AccessLog != nil {
+				if err := h.AccessLog.Log(r, status, size, t0, m); err != nil {
+					logrus.Warnf("error writing access log: %s", err.Error())
+				}
+			}
+			if h.Sink == nil {
+				return
+			}
+			if err := h.Sink.WriteRequestData(m); err != nil {
+				logrus.Debugf("error enqueuing request metrics: %s", err.Error())
 			}
 		}()
 	}()
@@ -70,15 +117,13 @@ func (h Handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	defer sp.Finish()
 
 	tracer.HydrateSpanFromRequest(r, sp)
+	sp.SetTag(tracer.KanaliRequestID, requestID)
 
-	err := h.H(context.Background(), &spec.APIProxy{}, m, w, r, sp)
+	err := h.H(ctx, &spec.APIProxy{}, m, w, r, sp)
 	if err == nil {
 		return
 	}
 
-	// all errors will need the application/json Content-Type header
-	w.Header().Set("Content-Type", "application/json")
-
 	// we'll have multiple types off errors
 	switch e := err.(type) {
 	case utils.Error:
@@ -87,26 +132,21 @@ func (h Handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 
 		// log error
 		logrus.WithFields(logrus.Fields{
-			"method": r.Method,
-			"uri":    utils.ComputeURLPath(r.URL),
+			"method":     r.Method,
+			"uri":        utils.ComputeURLPath(r.URL),
+			"request_id": requestID,
 		}).Error(e.Error())
 
 		m.Add(metrics.Metric{Name: "http_response_code", Value: strconv.Itoa(e.Status()), Index: true})
 
-		errStatus, err := json.Marshal(utils.JSONErr{Code: e.Status(), Msg: e.Error()})
+		errStatus, err := json.Marshal(utils.JSONErr{Code: e.Status(), Msg: e.Error(), RequestID: requestID})
 		if err != nil {
 			logrus.Warnf("could not marsah request headers into JSON - tracing data maybe not be as expected")
 		} else {
 			sp.SetTag(tracer.HTTPResponseBody, string(errStatus))
 		}
 
-		// write error code to response
-		w.WriteHeader(e.Status())
-
-		// write error message to response
-		if err := json.NewEncoder(w).Encode(utils.JSONErr{Code: e.Status(), Msg: e.Error()}); err != nil {
-			logrus.Fatal(err.Error())
-		}
+		writeError(w, r, e.Status(), e.Error())
 
 	default:
 
@@ -114,26 +154,45 @@ func (h Handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 
 		// log error
 		logrus.WithFields(logrus.Fields{
-			"method": r.Method,
-			"uri":    utils.ComputeURLPath(r.URL),
+			"method":     r.Method,
+			"uri":        utils.ComputeURLPath(r.URL),
+			"request_id": requestID,
 		}).Error("unknown error")
 
 		m.Add(metrics.Metric{Name: "http_response_code", Value: strconv.Itoa(http.StatusInternalServerError), Index: true})
 
-		errStatus, err := json.Marshal(utils.JSONErr{Code: http.StatusInternalServerError, Msg: "unknown error"})
+		errStatus, err := json.Marshal(utils.JSONErr{Code: http.StatusInternalServerError, Msg: "unknown error", RequestID: requestID})
 		if err != nil {
 			logrus.Warnf("could not marsah request headers into JSON - tracing data maybe not be as expected")
 		} else {
 			sp.SetTag(tracer.HTTPResponseBody, string(errStatus))
 		}
 
-		// write error code to response
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "unknown error")
 
-		// write error message to response
-		if err := json.NewEncoder(w).Encode(utils.JSONErr{Code: http.StatusInternalServerError, Msg: "unknown error"}); err != nil {
-			logrus.Fatal(err.Error())
-		}
+	}
+}
+
+// writeError writes an error to the response in a form the client understands.
+// gRPC clients receive a gRPC status while all other clients receive JSON.
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if utils.IsGRPC(r.Header.Get("Content-Type")) {
+		utils.WriteGRPCError(w, status, msg)
+		return
+	}
+
+	// all errors will need the application/json Content-Type header
+	w.Header().Set("Content-Type", "application/json")
+
+	// write error code to response
+	w.WriteHeader(status)
 
+	// write error message to response
+	if err := json.NewEncoder(w).Encode(utils.JSONErr{
+		Code:      status,
+		Msg:       msg,
+		RequestID: w.Header().Get(utils.RequestIDHeader),
+	}); err != nil {
+		logrus.Fatal(err.Error())
 	}
 }
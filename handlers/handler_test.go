@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSink chan *metrics.Metrics
+
+func (s mockSink) Name() string                              { return "mock" }
+func (s mockSink) WriteRequestData(m *metrics.Metrics) error { s <- m; return nil }
+func (s mockSink) Flush() error                              { return nil }
+func (s mockSink) Close() error                              { return nil }
+func (s mockSink) Dropped() uint64                           { return 0 }
+
+func TestWriteError(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	w := httptest.NewRecorder()
+	writeError(w, r, http.StatusUnauthorized, "api key not authorized")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"code":401,"msg":"api key not authorized"}`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "abc-123")
+	writeError(w, r, http.StatusUnauthorized, "api key not authorized")
+	assert.Equal(t, `{"code":401,"msg":"api key not authorized","request_id":"abc-123"}`+"\n", w.Body.String())
+
+	r.Header.Set("Content-Type", "application/grpc")
+	w = httptest.NewRecorder()
+	writeError(w, r, http.StatusUnauthorized, "api key not authorized")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc", w.Header().Get("Content-Type"))
+	assert.Equal(t, "16", w.Header().Get("Grpc-Status"))
+	assert.Equal(t, "api key not authorized", w.Header().Get("Grpc-Message"))
+}
+
+func TestWaitForMetrics(t *testing.T) {
+	assert.Nil(t, WaitForMetrics(context.Background()))
+
+	metricWrites.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, WaitForMetrics(ctx))
+
+	metricWrites.Done()
+	assert.Nil(t, WaitForMetrics(context.Background()))
+}
+
+func TestServeHTTPCanceled(t *testing.T) {
+	sink := make(mockSink, 1)
+	h := Handler{
+		Sink: sink,
+		H: func(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, trace opentracing.Span) error {
+			<-ctx.Done()
+			return utils.ContextError(ctx)
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	w := httptest.NewRecorder()
+	h.serveHTTP(w, r.WithContext(ctx))
+
+	assert.Equal(t, 499, w.Code)
+	m := <-sink
+	assert.Equal(t, "499", m.Get("http_response_code").Value)
+}
@@ -24,6 +24,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/northwesternmutual/kanali/config"
 	"github.com/northwesternmutual/kanali/flow"
 	"github.com/northwesternmutual/kanali/metrics"
@@ -41,13 +42,36 @@ func IncomingRequest(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metri
 	// maybe there's a better way to do this... seems misplaced
 	futureResponse := &http.Response{}
 
+	// the deadline of a request depends on the proxy that
+	// it matches so that proxy must be found first
+	validate := &flow.Flow{}
+	validate.Add(steps.ValidateProxyStep{})
+	if err := validate.Play(ctx, proxy, m, w, r, futureResponse, trace); err != nil {
+		return err
+	}
+
+	ctx, cancel := steps.WithProxyDeadline(ctx, proxy)
+	defer cancel()
+
+	// the upstream response is done with once every step has been
+	// played, whether or not its body was written to the client
+	defer closeResponse(futureResponse)
+
 	f := &flow.Flow{}
 
 	f.Add(
-		steps.ValidateProxyStep{},
+		steps.LimitsStep{},
 		steps.PluginsOnRequestStep{},
+		steps.RequestHeadersStep{},
 	)
-	if viper.GetBool(config.FlagProxyEnableMockResponses.GetLong()) && mockIsDefined(utils.ComputeURLPath(r.URL)) {
+	// a request that switches protocols does not have a
+	// response that can be handled by the remaining steps
+	if utils.IsUpgradeRequest(r) {
+		f.Add(steps.UpgradeStep{})
+		return f.Play(ctx, proxy, m, w, r, futureResponse, trace)
+	}
+
+	if viper.GetBool(config.FlagProxyEnableMockResponses.GetLong()) && mockIsDefined(utils.ComputeURLPath(r.URL), r.Host) {
 		f.Add(steps.MockServiceStep{})
 	} else {
 		f.Add(steps.ProxyPassStep{})
@@ -55,6 +79,7 @@ func IncomingRequest(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metri
 
 	f.Add(
 		steps.PluginsOnResponseStep{},
+		steps.ResponseHeadersStep{},
 		steps.WriteResponseStep{},
 	)
 
@@ -64,9 +89,18 @@ func IncomingRequest(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metri
 
 }
 
-func mockIsDefined(path string) bool {
+func closeResponse(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	if err := resp.Body.Close(); err != nil {
+		logrus.Debugf("error closing upstream response body: %s", err.Error())
+	}
+}
+
+func mockIsDefined(path, host string) bool {
 
-	untypedProxy, err := spec.ProxyStore.Get(path)
+	untypedProxy, err := spec.ProxyStore.Get(path, host)
 	if err != nil || untypedProxy == nil {
 		return false
 	}
@@ -144,13 +144,13 @@ func TestMockIsDefined(t *testing.T) {
 		},
 	})
 
-	result := mockIsDefined("/api/v1/accounts/foo")
+	result := mockIsDefined("/api/v1/accounts/foo", "")
 	assert.True(t, result)
 
-	result = mockIsDefined("/api/v1/clients/foo")
+	result = mockIsDefined("/api/v1/clients/foo", "")
 	assert.False(t, result)
 
-	result = mockIsDefined("/api/v1/properties/foo")
+	result = mockIsDefined("/api/v1/properties/foo", "")
 	assert.False(t, result)
 
 }
@@ -22,9 +22,9 @@ package handlers
 
 import (
 	"net/http"
-	"strings"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/steps"
 	"github.com/northwesternmutual/kanali/utils"
 )
 
@@ -38,9 +38,10 @@ func Logger(inner Handler) http.Handler {
 		inner.serveHTTP(w, r)
 
 		logrus.WithFields(logrus.Fields{
-			"client ip": strings.Split(r.RemoteAddr, ":")[0],
-			"method":    r.Method,
-			"uri":       utils.ComputeURLPath(r.URL),
+			"client ip":  steps.ClientIP(r),
+			"method":     r.Method,
+			"uri":        utils.ComputeURLPath(r.URL),
+			"request id": w.Header().Get(utils.RequestIDHeader),
 		}).Info("request details")
 
 	})
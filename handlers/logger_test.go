@@ -35,20 +35,23 @@ import (
 )
 
 func TestLogger(t *testing.T) {
-	server := &http.Server{Addr: "127.0.0.1:40123", Handler: Logger(Handler{InfluxController: nil, H: IncomingRequest})}
+	server := &http.Server{Addr: "127.0.0.1:40123", Handler: Logger(Handler{H: IncomingRequest})}
 	listener, _ := net.Listen("tcp4", "127.0.0.1:40123")
 	go server.Serve(listener)
 	defer server.Close()
 
 	writer := new(bytes.Buffer)
 	logrus.SetOutput(writer)
-	resp, err := http.Get("http://127.0.0.1:40123/")
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:40123/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	resp, err := http.DefaultClient.Do(req)
 	logrus.SetOutput(os.Stdout)
 	assert.Nil(t, err)
 	assert.Equal(t, resp.Header.Get("Content-Type"), "application/json")
+	assert.Equal(t, "abc-123", resp.Header.Get("X-Request-ID"))
 
 	body, _ := ioutil.ReadAll(resp.Body)
-	assert.Equal(t, string(body), fmt.Sprintf("%s\n", `{"code":404,"msg":"proxy not found"}`))
+	assert.Equal(t, string(body), fmt.Sprintf("%s\n", `{"code":404,"msg":"proxy not found","request_id":"abc-123"}`))
 	assert.Equal(t, resp.StatusCode, 404)
 
 	logOutput := writer.String()
@@ -58,4 +61,6 @@ func TestLogger(t *testing.T) {
 	assert.True(t, strings.Contains(logOutput, `client ip=127.0.0.1`))
 	assert.True(t, strings.Contains(logOutput, `method=GET`))
 	assert.True(t, strings.Contains(logOutput, `uri="/"`))
+	assert.True(t, strings.Contains(logOutput, `request_id=abc-123`))
+	assert.True(t, strings.Contains(logOutput, `request id=abc-123`))
 }
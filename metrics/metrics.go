@@ -20,6 +20,11 @@
 
 package metrics
 
+import (
+	"context"
+	"sync"
+)
+
 // Metric represent a single request metric
 type Metric struct {
 	Name  string
@@ -46,3 +51,46 @@ func (m *Metrics) Get(name string) *Metric {
 	}
 	return nil
 }
+
+type pendingKey struct{}
+
+// Pending collects metrics that are produced asynchronously on behalf
+// of a request, possibly after a response has been written to the client
+type Pending struct {
+	wg      sync.WaitGroup
+	mutex   sync.Mutex
+	metrics Metrics
+}
+
+// WithPending returns a copy of ctx that carries a new Pending
+func WithPending(ctx context.Context) (context.Context, *Pending) {
+	p := &Pending{}
+	return context.WithValue(ctx, pendingKey{}, p), p
+}
+
+// PendingFromContext returns the Pending carried by ctx, if any
+func PendingFromContext(ctx context.Context) *Pending {
+	p, _ := ctx.Value(pendingKey{}).(*Pending)
+	return p
+}
+
+// Go runs f in a new goroutine and collects the metrics that it returns
+func (p *Pending) Go(f func() Metrics) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		result := f()
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.metrics.Add(result...)
+	}()
+}
+
+// Wait blocks until every function started with Go has
+// returned and then returns all of the collected metrics
+func (p *Pending) Wait() Metrics {
+	p.wg.Wait()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.metrics
+}
@@ -21,6 +21,7 @@
 package metrics
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -51,3 +52,22 @@ func TestGet(t *testing.T) {
 	assert.Equal(t, f.Get("nameTwo"), &Metric{"nameTwo", "valueTwo", true})
 	assert.Equal(t, f.Get("nameThree"), &Metric{"nameThree", "valueThree", false})
 }
+
+func TestPending(t *testing.T) {
+	assert.Nil(t, PendingFromContext(context.Background()))
+
+	ctx, p := WithPending(context.Background())
+	assert.Equal(t, p, PendingFromContext(ctx))
+	assert.Equal(t, 0, len(p.Wait()))
+
+	p.Go(func() Metrics {
+		return Metrics{{"nameOne", "valueOne", false}}
+	})
+	p.Go(func() Metrics {
+		return Metrics{{"nameTwo", "valueTwo", true}}
+	})
+	result := p.Wait()
+	assert.Equal(t, 2, len(result))
+	assert.NotNil(t, result.Get("nameOne"))
+	assert.NotNil(t, result.Get("nameTwo"))
+}
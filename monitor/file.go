@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/spf13/viper"
+)
+
+// FileSink appends request metrics to a file, one JSON object per line
+type FileSink struct {
+	file  *os.File
+	queue *queue
+}
+
+// NewFileSink creates a new sink appending request metrics to a file
+func NewFileSink() (*FileSink, error) {
+	path := viper.GetString(config.FlagAnalyticsFilePath.GetLong())
+	if path == "" {
+		return nil, errors.New("a file path is required")
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	sink := &FileSink{
+		file:  file,
+		queue: newQueue(viper.GetInt(config.FlagAnalyticsQueueSize.GetLong())),
+	}
+	go sink.queue.run(sink.append, func() {})
+	return sink, nil
+}
+
+// Name returns the name of the file backend
+func (s *FileSink) Name() string {
+	return BackendFile
+}
+
+// WriteRequestData enqueues the metrics of a single request. They are
+// dropped if the queue is full.
+func (s *FileSink) WriteRequestData(m *metrics.Metrics) error {
+	return s.queue.push(m)
+}
+
+// Flush waits until the metrics of every queued request have been written
+func (s *FileSink) Flush() error {
+	s.queue.flush()
+	return s.file.Sync()
+}
+
+// Close writes the metrics of every queued request and closes the file
+func (s *FileSink) Close() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
+
+// Dropped returns the number of requests whose metrics were dropped
+// because the queue was full
+func (s *FileSink) Dropped() uint64 {
+	return s.queue.droppedCount()
+}
+
+// append writes the metrics of a single request as a single line
+func (s *FileSink) append(m *metrics.Metrics) {
+	fields := getFields(m)
+	fields["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	line, err := json.Marshal(fields)
+	if err != nil {
+		logrus.Warnf("error encoding request metrics: %s", err.Error())
+		return
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		logrus.Warnf("error writing request metrics to %s: %s", s.file.Name(), err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	defer viper.Reset()
+
+	_, err := NewFileSink()
+	assert.Equal(t, "a file path is required", err.Error())
+
+	dir, err := ioutil.TempDir("", "kanali")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+
+	viper.Set(config.FlagAnalyticsFilePath.GetLong(), path)
+	viper.Set(config.FlagAnalyticsQueueSize.GetLong(), 10)
+
+	sink, err := NewFileSink()
+	assert.Nil(t, err)
+	assert.Equal(t, "file", sink.Name())
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, sink.WriteRequestData(&metrics.Metrics{
+			metrics.Metric{Name: "http_response_code", Value: "200", Index: true},
+			metrics.Metric{Name: "total_time", Value: 20, Index: false},
+		}))
+	}
+	assert.Nil(t, sink.Close())
+	assert.Equal(t, uint64(0), sink.Dropped())
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "200", line["http_response_code"])
+	assert.Equal(t, float64(20), line["total_time"])
+	assert.NotEmpty(t, line["time"])
+}
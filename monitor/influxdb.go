@@ -23,6 +23,7 @@ package monitor
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -32,11 +33,28 @@ import (
 	"github.com/spf13/viper"
 )
 
+// maxRetryBackoff is the longest time that failed writes wait before being retried
+const maxRetryBackoff = 5 * time.Minute
+
+// selfMeasurement is the InfluxDB measurement that the health of the
+// InfluxDB writer itself is recorded to along with every batch
+const selfMeasurement = "kanali_analytics"
+
 // InfluxController represents configuration to create an Influxdb connection
 type InfluxController struct {
-	Client    influx.Client
-	capacity  int
-	taskQueue chan *influx.Point
+	Client        influx.Client
+	capacity      int
+	flushInterval time.Duration
+	maxPending    int
+	taskQueue     chan *influx.Point
+	flushQueue    chan chan error
+	// batches of points that have yet to be written, oldest first
+	pending       [][]*influx.Point
+	pendingPoints int
+	backoff       time.Duration
+	nextRetry     time.Time
+	dropped       uint64
+	failures      uint64
 }
 
 // NewInfluxdbController creates a new controller allowing
@@ -46,39 +64,172 @@ func NewInfluxdbController() (*InfluxController, error) {
 		Addr:     viper.GetString(config.FlagAnalyticsInfluxAddr.GetLong()),
 		Username: viper.GetString(config.FlagAnalyticsInfluxUsername.GetLong()),
 		Password: viper.GetString(config.FlagAnalyticsInfluxPassword.GetLong()),
+		Timeout:  viper.GetDuration(config.FlagAnalyticsInfluxTimeout.GetLong()),
 	})
 	if err != nil {
 		return nil, err
 	}
 	return &InfluxController{
-		Client:    influxClient,
-		capacity:  viper.GetInt(config.FlagAnalyticsInfluxBufferSize.GetLong()),
-		taskQueue: make(chan *influx.Point),
+		Client:        influxClient,
+		capacity:      viper.GetInt(config.FlagAnalyticsInfluxBufferSize.GetLong()),
+		flushInterval: viper.GetDuration(config.FlagAnalyticsInfluxFlushInterval.GetLong()),
+		maxPending:    viper.GetInt(config.FlagAnalyticsInfluxMaxPendingPoints.GetLong()),
+		taskQueue:     make(chan *influx.Point, viper.GetInt(config.FlagAnalyticsQueueSize.GetLong())),
+		flushQueue:    make(chan chan error),
 	}, nil
 }
 
-// Run will begin a watch that receives request metrics
-// and writes them to InfluxDB when the specificed buffer is full
+// Run will begin a watch that receives request metrics and writes them to
+// InfluxDB when the specificed buffer is full or the flush interval elapses.
+// Batches that fail to be written are retried with an exponential backoff.
 func (ctlr *InfluxController) Run() {
 	var buffer []*influx.Point
 
+	interval := ctlr.flushInterval
+	if interval <= 0 {
+		interval = maxRetryBackoff
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
-		buffer = append(buffer, <-ctlr.taskQueue)
-		if len(buffer) == ctlr.capacity {
-			batchPoints, err := prepareWrite(buffer)
-			// clear the buffer
-			buffer = []*influx.Point{}
-			if err != nil {
-				logrus.Warnf("error preparing batched metrics: %s", err.Error())
-				continue
+		select {
+		case pt := <-ctlr.taskQueue:
+			buffer = append(buffer, pt)
+			if len(buffer) >= ctlr.capacity {
+				ctlr.writeBuffer(buffer, false)
+				// clear the buffer
+				buffer = []*influx.Point{}
+			}
+		case <-ticker.C:
+			// failed batches are retried even if the buffer is not flushed
+			if ctlr.flushInterval > 0 {
+				ctlr.writeBuffer(buffer, false)
+				buffer = []*influx.Point{}
+			} else {
+				ctlr.writeBuffer(nil, false)
+			}
+		case flushed := <-ctlr.flushQueue:
+			for len(ctlr.taskQueue) > 0 {
+				buffer = append(buffer, <-ctlr.taskQueue)
 			}
-			go func() {
-				if err := ctlr.write(batchPoints); err != nil {
-					logrus.Warnf("error writing batched metrics to InfluxDB: %s", err.Error())
-				}
-			}()
+			flushed <- ctlr.writeBuffer(buffer, true)
+			buffer = []*influx.Point{}
+		}
+	}
+}
+
+// Flush writes the request metrics that are buffered, along with any batch
+// that previously failed, to InfluxDB. Run must have been started.
+func (ctlr *InfluxController) Flush() error {
+	if ctlr == nil {
+		return errors.New("influxDB controller not initialized")
+	}
+
+	flushed := make(chan error)
+	ctlr.flushQueue <- flushed
+	return <-flushed
+}
+
+// Close flushes the request metrics that are buffered and closes the connection to InfluxDB
+func (ctlr *InfluxController) Close() error {
+	if err := ctlr.Flush(); err != nil {
+		return err
+	}
+	return ctlr.Client.Close()
+}
+
+// Name returns the name of the InfluxDB backend
+func (ctlr *InfluxController) Name() string {
+	return BackendInfluxDB
+}
+
+// Dropped returns the number of requests whose metrics were dropped, either
+// because the queue was full or because too many points were pending
+func (ctlr *InfluxController) Dropped() uint64 {
+	return atomic.LoadUint64(&ctlr.dropped)
+}
+
+// WriteFailures returns the number of failed attempts to write to InfluxDB
+func (ctlr *InfluxController) WriteFailures() uint64 {
+	return atomic.LoadUint64(&ctlr.failures)
+}
+
+// writeBuffer adds the buffered points as a new batch to the pending batches and
+// writes them, oldest first. Unless forced, nothing is written while backing off
+// from a failed write. Only the latest error is returned.
+func (ctlr *InfluxController) writeBuffer(buffer []*influx.Point, force bool) error {
+	if len(buffer) > 0 {
+		ctlr.addPending(buffer)
+	}
+
+	if len(ctlr.pending) == 0 || (!force && time.Now().Before(ctlr.nextRetry)) {
+		return nil
+	}
+
+	for len(ctlr.pending) > 0 {
+		points := ctlr.pending[0]
+		if pt, err := ctlr.selfPoint(); err == nil {
+			// the pending batch is copied so that it is not modified if retried
+			points = append(points[:len(points):len(points)], pt)
+		}
+		batchPoints, err := prepareWrite(points)
+		if err != nil {
+			logrus.Warnf("error preparing batched metrics: %s", err.Error())
+			return err
+		}
+		if err := ctlr.write(batchPoints); err != nil {
+			atomic.AddUint64(&ctlr.failures, 1)
+			ctlr.backOff()
+			logrus.Warnf("error writing batched metrics to InfluxDB, %d points pending: %s", ctlr.pendingPoints, err.Error())
+			return err
 		}
+		ctlr.pendingPoints -= len(ctlr.pending[0])
+		ctlr.pending = ctlr.pending[1:]
 	}
+
+	ctlr.backoff = 0
+	ctlr.nextRetry = time.Time{}
+	return nil
+}
+
+// addPending adds a batch to the pending batches. The oldest batches are
+// dropped when more than the maximum number of points are pending.
+func (ctlr *InfluxController) addPending(points []*influx.Point) {
+	ctlr.pending = append(ctlr.pending, points)
+	ctlr.pendingPoints += len(points)
+
+	for ctlr.maxPending > 0 && ctlr.pendingPoints > ctlr.maxPending && len(ctlr.pending) > 1 {
+		oldest := len(ctlr.pending[0])
+		atomic.AddUint64(&ctlr.dropped, uint64(oldest))
+		ctlr.pendingPoints -= oldest
+		ctlr.pending = ctlr.pending[1:]
+	}
+}
+
+// backOff doubles the time to wait before retrying, starting at the flush interval
+func (ctlr *InfluxController) backOff() {
+	switch {
+	case ctlr.backoff > 0:
+		ctlr.backoff *= 2
+	case ctlr.flushInterval > 0:
+		ctlr.backoff = ctlr.flushInterval
+	default:
+		ctlr.backoff = time.Second
+	}
+	if ctlr.backoff > maxRetryBackoff {
+		ctlr.backoff = maxRetryBackoff
+	}
+	ctlr.nextRetry = time.Now().Add(ctlr.backoff)
+}
+
+// selfPoint records the health of the InfluxDB writer
+func (ctlr *InfluxController) selfPoint() (*influx.Point, error) {
+	return influx.NewPoint(selfMeasurement, nil, map[string]interface{}{
+		"write_failures": int64(ctlr.WriteFailures()),
+		"dropped":        int64(ctlr.Dropped()),
+		"pending_points": ctlr.pendingPoints,
+	}, time.Now())
 }
 
 func (ctlr *InfluxController) write(bp influx.BatchPoints) (err error) {
@@ -112,7 +263,8 @@ func prepareWrite(buffer []*influx.Point) (influx.BatchPoints, error) {
 	return bp, nil
 }
 
-// WriteRequestData writes contextual request metrics to Influxdb
+// WriteRequestData enqueues contextual request metrics for a future InfluxDB
+// write. The metrics are dropped if the queue is full.
 func (ctlr *InfluxController) WriteRequestData(m *metrics.Metrics) error {
 	if ctlr == nil {
 		return errors.New("influxDB controller not initialized")
@@ -127,8 +279,13 @@ func (ctlr *InfluxController) WriteRequestData(m *metrics.Metrics) error {
 		return err
 	}
 
-	ctlr.taskQueue <- pt
-	return nil
+	select {
+	case ctlr.taskQueue <- pt:
+		return nil
+	default:
+		atomic.AddUint64(&ctlr.dropped, 1)
+		return errQueueFull
+	}
 }
 
 func createDatabase(c influx.Client) error {
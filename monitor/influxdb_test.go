@@ -38,6 +38,7 @@ type mockClient struct {
 	db    string
 	store []influx.BatchPoints
 	mutex sync.RWMutex
+	down  bool
 }
 
 func (c *mockClient) Ping(timeout time.Duration) (time.Duration, string, error) {
@@ -47,6 +48,9 @@ func (c *mockClient) Ping(timeout time.Duration) (time.Duration, string, error)
 func (c *mockClient) Write(bp influx.BatchPoints) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	if c.down {
+		return errors.New("influxdb is down")
+	}
 	if bp.Database() == "" || c.db != bp.Database() {
 		return errors.New("database does not exist")
 	}
@@ -75,20 +79,20 @@ func TestWriteRequestData(t *testing.T) {
 	ctlr := &InfluxController{
 		Client:    &mockClient{},
 		capacity:  viper.GetInt(config.FlagAnalyticsInfluxBufferSize.GetLong()),
-		taskQueue: make(chan *influx.Point),
+		taskQueue: make(chan *influx.Point, 1),
 	}
 	m := &metrics.Metrics{
 		metrics.Metric{Name: "metric-one", Value: "value-one", Index: true},
 		metrics.Metric{Name: "metric-two", Value: "value-two", Index: false},
 	}
 
-	// not doing anything with items put on this channel
-	// but it needs to exist so that we don't block forever
-	go func() {
-		<-ctlr.taskQueue
-	}()
-
 	assert.Nil(t, ctlr.WriteRequestData(m))
+	assert.Equal(t, uint64(0), ctlr.Dropped())
+
+	// the queue is full so the metrics are dropped instead of blocking
+	assert.Equal(t, errQueueFull, ctlr.WriteRequestData(m))
+	assert.Equal(t, uint64(1), ctlr.Dropped())
+	assert.Equal(t, 1, len(ctlr.taskQueue))
 }
 
 func TestPrepareWrite(t *testing.T) {
@@ -169,6 +173,136 @@ func TestRun(t *testing.T) {
 	client.mutex.RUnlock()
 }
 
+func TestFlush(t *testing.T) {
+	defer viper.Reset()
+
+	client := &mockClient{}
+	ctlr := &InfluxController{
+		Client:     client,
+		capacity:   10,
+		taskQueue:  make(chan *influx.Point),
+		flushQueue: make(chan chan error),
+	}
+
+	m := &metrics.Metrics{
+		metrics.Metric{Name: "metric-one", Value: "value-one", Index: true},
+	}
+
+	tags, _ := getTags(m)
+	pt, _ := influx.NewPoint(viper.GetString(config.FlagAnalyticsInfluxMeasurement.GetLong()), tags, getFields(m), time.Now())
+	viper.SetDefault(config.FlagAnalyticsInfluxDb.GetLong(), "test_db")
+
+	go ctlr.Run()
+
+	ctlr.taskQueue <- pt
+	ctlr.taskQueue <- pt
+	assert.Nil(t, ctlr.Flush())
+	client.mutex.RLock()
+	assert.Equal(t, 1, len(client.store))
+	// the request points are written along with a point recording the writer's health
+	assert.Equal(t, 3, len(client.store[0].Points()))
+	assert.Equal(t, selfMeasurement, client.store[0].Points()[2].Name())
+	client.mutex.RUnlock()
+
+	// flushing an empty buffer does not write
+	assert.Nil(t, ctlr.Flush())
+	client.mutex.RLock()
+	assert.Equal(t, 1, len(client.store))
+	client.mutex.RUnlock()
+
+	ctlr = nil
+	assert.Equal(t, "influxDB controller not initialized", ctlr.Flush().Error())
+}
+
+func TestRunFlushInterval(t *testing.T) {
+	defer viper.Reset()
+	viper.SetDefault(config.FlagAnalyticsInfluxDb.GetLong(), "test_db")
+
+	client := &mockClient{}
+	ctlr := &InfluxController{
+		Client:        client,
+		capacity:      10,
+		flushInterval: 10 * time.Millisecond,
+		taskQueue:     make(chan *influx.Point),
+		flushQueue:    make(chan chan error),
+	}
+	go ctlr.Run()
+
+	pt, _ := influx.NewPoint("test", nil, map[string]interface{}{"value": 1}, time.Now())
+	ctlr.taskQueue <- pt
+
+	// the buffer is not full but is written once the flush interval elapses
+	assert.True(t, waitFor(func() bool {
+		client.mutex.RLock()
+		defer client.mutex.RUnlock()
+		return len(client.store) == 1
+	}))
+}
+
+func TestWriteBufferRetries(t *testing.T) {
+	defer viper.Reset()
+	viper.SetDefault(config.FlagAnalyticsInfluxDb.GetLong(), "test_db")
+
+	client := &mockClient{down: true}
+	ctlr := &InfluxController{
+		Client:        client,
+		flushInterval: time.Minute,
+		maxPending:    3,
+	}
+	pt, _ := influx.NewPoint("test", nil, map[string]interface{}{"value": 1}, time.Now())
+
+	assert.NotNil(t, ctlr.writeBuffer([]*influx.Point{pt, pt}, false))
+	assert.Equal(t, uint64(1), ctlr.WriteFailures())
+	assert.Equal(t, time.Minute, ctlr.backoff)
+	assert.Equal(t, 2, ctlr.pendingPoints)
+
+	// nothing is written while backing off
+	assert.Nil(t, ctlr.writeBuffer([]*influx.Point{pt}, false))
+	assert.Equal(t, uint64(1), ctlr.WriteFailures())
+	assert.Equal(t, 2, len(ctlr.pending))
+
+	// the oldest batch is dropped once too many points are pending
+	assert.Nil(t, ctlr.writeBuffer([]*influx.Point{pt}, false))
+	assert.Equal(t, uint64(2), ctlr.Dropped())
+	assert.Equal(t, 2, ctlr.pendingPoints)
+
+	// the backoff doubles until writes succeed
+	assert.NotNil(t, ctlr.writeBuffer(nil, true))
+	assert.Equal(t, 2*time.Minute, ctlr.backoff)
+
+	client.down = false
+	assert.Nil(t, ctlr.writeBuffer(nil, true))
+	assert.Equal(t, 0, len(ctlr.pending))
+	assert.Equal(t, 0, ctlr.pendingPoints)
+	assert.Equal(t, time.Duration(0), ctlr.backoff)
+	assert.Equal(t, 2, len(client.store))
+
+	fields := client.store[1].Points()[1].Fields()
+	assert.Equal(t, int64(2), fields["write_failures"])
+	assert.Equal(t, int64(2), fields["dropped"])
+}
+
+func TestBackOff(t *testing.T) {
+	ctlr := &InfluxController{}
+	ctlr.backOff()
+	assert.Equal(t, time.Second, ctlr.backoff)
+	for i := 0; i < 20; i++ {
+		ctlr.backOff()
+	}
+	assert.Equal(t, maxRetryBackoff, ctlr.backoff)
+	assert.True(t, ctlr.nextRetry.After(time.Now()))
+}
+
+func waitFor(condition func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
 func TestCreateDatabase(t *testing.T) {
 	err := createDatabase(&mockClient{})
 	assert.Equal(t, err.Error(), "no database name")
@@ -0,0 +1,221 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets of every latency histogram
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusController aggregates request metrics and exposes them,
+// along with the size of Kanali's stores, in the Prometheus text format
+type PrometheusController struct {
+	registry            *prometheus.Registry
+	handler             http.Handler
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	upstreamDuration    *prometheus.HistogramVec
+	pluginErrors        *prometheus.CounterVec
+	rateLimitRejections *prometheus.CounterVec
+	queue               *queue
+	// sinks whose dropped metrics are exposed
+	sinks MultiSink
+}
+
+// NewPrometheusController creates a new controller exposing request metrics to Prometheus
+func NewPrometheusController() *PrometheusController {
+	requestLabels := []string{"proxy_name", "proxy_namespace", "method", "code"}
+	proxyLabels := []string{"proxy_name", "proxy_namespace"}
+
+	ctlr := &PrometheusController{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kanali_requests_total",
+			Help: "Number of requests handled.",
+		}, requestLabels),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kanali_request_duration_seconds",
+			Help:    "Time taken to handle a request.",
+			Buckets: durationBuckets,
+		}, requestLabels),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kanali_upstream_duration_seconds",
+			Help:    "Time taken by the upstream service to respond.",
+			Buckets: durationBuckets,
+		}, proxyLabels),
+		pluginErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kanali_plugin_errors_total",
+			Help: "Number of requests rejected by a plugin.",
+		}, []string{"plugin"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kanali_rate_limit_rejections_total",
+			Help: "Number of requests rejected for exceeding a rate limit or quota.",
+		}, proxyLabels),
+		queue: newQueue(viper.GetInt(config.FlagAnalyticsQueueSize.GetLong())),
+	}
+	ctlr.sinks = MultiSink{ctlr}
+
+	ctlr.registry.MustRegister(
+		ctlr.requests,
+		ctlr.requestDuration,
+		ctlr.upstreamDuration,
+		ctlr.pluginErrors,
+		ctlr.rateLimitRejections,
+		storeSize("kanali_proxies", "Number of ApiProxies in the store.", spec.ProxyStore.Size),
+		storeSize("kanali_api_keys", "Number of ApiKeys in the store.", spec.KeyStore.Size),
+		storeSize("kanali_api_key_bindings", "Number of ApiKeyBindings in the store.", spec.BindingStore.Size),
+		sinkCollector{ctlr},
+	)
+	ctlr.handler = promhttp.HandlerFor(ctlr.registry, promhttp.HandlerOpts{})
+
+	go ctlr.queue.run(ctlr.record, func() {})
+	return ctlr
+}
+
+// Name returns the name of the Prometheus backend
+func (ctlr *PrometheusController) Name() string {
+	return BackendPrometheus
+}
+
+// WriteRequestData enqueues the metrics of a single request. They are
+// dropped if the queue is full.
+func (ctlr *PrometheusController) WriteRequestData(m *metrics.Metrics) error {
+	return ctlr.queue.push(m)
+}
+
+// Flush waits until the metrics of every queued request have been recorded
+func (ctlr *PrometheusController) Flush() error {
+	ctlr.queue.flush()
+	return nil
+}
+
+// Close waits until the metrics of every queued request have been recorded
+func (ctlr *PrometheusController) Close() error {
+	return ctlr.Flush()
+}
+
+// Dropped returns the number of requests whose metrics were dropped
+// because the queue was full
+func (ctlr *PrometheusController) Dropped() uint64 {
+	return ctlr.queue.droppedCount()
+}
+
+// record records the metrics of a single request
+func (ctlr *PrometheusController) record(m *metrics.Metrics) {
+	proxyName := getString(m, "proxy_name")
+	proxyNamespace := getString(m, "proxy_namespace")
+	method := getString(m, "http_method")
+	code := getString(m, "http_response_code")
+
+	ctlr.requests.WithLabelValues(proxyName, proxyNamespace, method, code).Inc()
+	if d, ok := getMilliseconds(m, "total_time"); ok {
+		ctlr.requestDuration.WithLabelValues(proxyName, proxyNamespace, method, code).Observe(d.Seconds())
+	}
+	if d, ok := getMilliseconds(m, "total_target_time"); ok {
+		ctlr.upstreamDuration.WithLabelValues(proxyName, proxyNamespace).Observe(d.Seconds())
+	}
+	if code == strconv.Itoa(http.StatusTooManyRequests) {
+		ctlr.rateLimitRejections.WithLabelValues(proxyName, proxyNamespace).Inc()
+	}
+
+	for _, metric := range *m {
+		if metric.Name == "plugin_error" {
+			ctlr.pluginErrors.WithLabelValues(fmt.Sprintf("%v", metric.Value)).Inc()
+		}
+	}
+}
+
+// ServeHTTP writes every metric in the Prometheus text format
+func (ctlr *PrometheusController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctlr.handler.ServeHTTP(w, r)
+}
+
+func getString(m *metrics.Metrics, name string) string {
+	metric := m.Get(name)
+	if metric == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", metric.Value)
+}
+
+func getMilliseconds(m *metrics.Metrics, name string) (time.Duration, bool) {
+	metric := m.Get(name)
+	if metric == nil {
+		return 0, false
+	}
+	ms, ok := metric.Value.(int)
+	return time.Duration(ms) * time.Millisecond, ok
+}
+
+// storeSize creates a gauge whose value is the size of a store when it is exposed
+func storeSize(name, help string, size func() int) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, func() float64 {
+		return float64(size())
+	})
+}
+
+var (
+	droppedDesc = prometheus.NewDesc(
+		"kanali_metrics_dropped_total",
+		"Number of requests whose metrics were dropped by a backend.",
+		[]string{"backend"}, nil,
+	)
+	writeFailuresDesc = prometheus.NewDesc(
+		"kanali_metrics_write_failures_total",
+		"Number of failed attempts to write metrics to a backend.",
+		[]string{"backend"}, nil,
+	)
+)
+
+// sinkCollector exposes how many metrics every sink dropped or failed to write
+type sinkCollector struct {
+	ctlr *PrometheusController
+}
+
+// Describe sends the descriptors of the metrics of every sink
+func (c sinkCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- droppedDesc
+	ch <- writeFailuresDesc
+}
+
+// Collect sends the number of metrics every sink dropped or failed to write
+func (c sinkCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, sink := range c.ctlr.sinks {
+		ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(sink.Dropped()), sink.Name())
+		if f, ok := sink.(writeFailureCounter); ok {
+			ch <- prometheus.MustNewConstMetric(writeFailuresDesc, prometheus.CounterValue, float64(f.WriteFailures()), sink.Name())
+		}
+	}
+}
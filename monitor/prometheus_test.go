@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestPrometheusWriteRequestData(t *testing.T) {
+	viper.SetDefault(config.FlagAnalyticsQueueSize.GetLong(), 10)
+	defer viper.Reset()
+	ctlr := NewPrometheusController()
+
+	assert.Nil(t, ctlr.WriteRequestData(&metrics.Metrics{
+		metrics.Metric{Name: "proxy_name", Value: "foo", Index: true},
+		metrics.Metric{Name: "proxy_namespace", Value: "bar", Index: true},
+		metrics.Metric{Name: "http_method", Value: "GET", Index: false},
+		metrics.Metric{Name: "http_response_code", Value: "200", Index: true},
+		metrics.Metric{Name: "total_time", Value: 20, Index: false},
+		metrics.Metric{Name: "total_target_time", Value: 7, Index: false},
+	}))
+	assert.Nil(t, ctlr.WriteRequestData(&metrics.Metrics{
+		metrics.Metric{Name: "proxy_name", Value: "foo", Index: true},
+		metrics.Metric{Name: "proxy_namespace", Value: "bar", Index: true},
+		metrics.Metric{Name: "http_method", Value: "GET", Index: false},
+		metrics.Metric{Name: "http_response_code", Value: "429", Index: true},
+		metrics.Metric{Name: "plugin_error", Value: "apikey", Index: false},
+		metrics.Metric{Name: "plugin_error", Value: "quota", Index: false},
+		metrics.Metric{Name: "total_time", Value: 1, Index: false},
+	}))
+	assert.Nil(t, ctlr.WriteRequestData(&metrics.Metrics{
+		metrics.Metric{Name: "http_method", Value: "GET", Index: false},
+		metrics.Metric{Name: "http_response_code", Value: "401", Index: true},
+		metrics.Metric{Name: "plugin_error", Value: "apikey", Index: false},
+	}))
+	assert.Nil(t, ctlr.Flush())
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	ctlr.ServeHTTP(rec, req)
+	body := rec.Body.String()
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, body, "# TYPE kanali_requests_total counter\n")
+	assert.Contains(t, body, `kanali_requests_total{code="200",method="GET",proxy_name="foo",proxy_namespace="bar"} 1`+"\n")
+	assert.Contains(t, body, `kanali_requests_total{code="401",method="GET",proxy_name="",proxy_namespace=""} 1`+"\n")
+	assert.Contains(t, body, "# TYPE kanali_request_duration_seconds histogram\n")
+	assert.Contains(t, body, `kanali_request_duration_seconds_bucket{code="200",method="GET",proxy_name="foo",proxy_namespace="bar",le="0.01"} 0`+"\n")
+	assert.Contains(t, body, `kanali_request_duration_seconds_bucket{code="200",method="GET",proxy_name="foo",proxy_namespace="bar",le="0.025"} 1`+"\n")
+	assert.Contains(t, body, `kanali_request_duration_seconds_bucket{code="200",method="GET",proxy_name="foo",proxy_namespace="bar",le="+Inf"} 1`+"\n")
+	assert.Contains(t, body, `kanali_request_duration_seconds_sum{code="200",method="GET",proxy_name="foo",proxy_namespace="bar"} 0.02`+"\n")
+	assert.Contains(t, body, `kanali_upstream_duration_seconds_count{proxy_name="foo",proxy_namespace="bar"} 1`+"\n")
+	assert.Contains(t, body, `kanali_plugin_errors_total{plugin="apikey"} 2`+"\n")
+	assert.Contains(t, body, `kanali_plugin_errors_total{plugin="quota"} 1`+"\n")
+	assert.Contains(t, body, `kanali_rate_limit_rejections_total{proxy_name="foo",proxy_namespace="bar"} 1`+"\n")
+	assert.Contains(t, body, `kanali_metrics_dropped_total{backend="prometheus"} 0`+"\n")
+}
+
+func TestPrometheusStoreSizes(t *testing.T) {
+	defer spec.ProxyStore.Clear()
+	spec.ProxyStore.Clear()
+	spec.KeyStore.Clear()
+	spec.BindingStore.Clear()
+	spec.ProxyStore.Set(spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "bar"},
+		Spec:       spec.APIProxySpec{Path: "/foo"},
+	})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	NewPrometheusController().ServeHTTP(rec, req)
+
+	assert.Contains(t, rec.Body.String(), "# TYPE kanali_proxies gauge\nkanali_proxies 1\n")
+	assert.Contains(t, rec.Body.String(), "kanali_api_keys 0\n")
+	assert.Contains(t, rec.Body.String(), "kanali_api_key_bindings 0\n")
+}
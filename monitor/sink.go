@@ -0,0 +1,225 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/spf13/viper"
+)
+
+const (
+	// BackendInfluxDB writes request metrics to InfluxDB
+	BackendInfluxDB = "influxdb"
+	// BackendPrometheus exposes request metrics to Prometheus
+	BackendPrometheus = "prometheus"
+	// BackendStatsd sends request metrics to StatsD
+	BackendStatsd = "statsd"
+	// BackendFile appends request metrics to a file
+	BackendFile = "file"
+)
+
+var errQueueFull = errors.New("queue is full - request metrics dropped")
+
+// Sink is a backend that request metrics are written to
+type Sink interface {
+	// Name returns the name of the backend
+	Name() string
+	// WriteRequestData enqueues the metrics of a single request. It never
+	// blocks. The metrics are dropped if the queue of the sink is full.
+	WriteRequestData(m *metrics.Metrics) error
+	// Flush writes every queued metric and waits for the writes to complete
+	Flush() error
+	// Close flushes the sink and releases its resources
+	Close() error
+	// Dropped returns the number of requests whose metrics were dropped
+	Dropped() uint64
+}
+
+// writeFailureCounter is implemented by sinks that count failed writes
+type writeFailureCounter interface {
+	WriteFailures() uint64
+}
+
+// MultiSink writes request metrics to every one of its sinks
+type MultiSink []Sink
+
+// NewSink creates a sink for every backend enabled by the configuration.
+// A backend that cannot be created is logged and skipped.
+func NewSink() MultiSink {
+	sinks := MultiSink{}
+	if IsEnabled(BackendInfluxDB) {
+		if ctlr, err := NewInfluxdbController(); err != nil {
+			logrus.Warnf("error connecting to InfluxDB: %s", err.Error())
+		} else {
+			go ctlr.Run()
+			sinks = append(sinks, ctlr)
+		}
+	}
+	if IsEnabled(BackendPrometheus) {
+		sinks = append(sinks, NewPrometheusController())
+	}
+	if IsEnabled(BackendStatsd) {
+		if sink, err := NewStatsdSink(); err != nil {
+			logrus.Warnf("error connecting to StatsD: %s", err.Error())
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+	if IsEnabled(BackendFile) {
+		if sink, err := NewFileSink(); err != nil {
+			logrus.Warnf("error opening request metrics file: %s", err.Error())
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if ctlr := sinks.Prometheus(); ctlr != nil {
+		ctlr.sinks = sinks
+	}
+	return sinks
+}
+
+// IsEnabled reports whether request metrics should be written to a backend
+func IsEnabled(backend string) bool {
+	for _, b := range viper.GetStringSlice(config.FlagAnalyticsBackends.GetLong()) {
+		if strings.EqualFold(strings.TrimSpace(b), backend) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of every sink
+func (s MultiSink) Name() string {
+	names := make([]string, len(s))
+	for i, sink := range s {
+		names[i] = sink.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// WriteRequestData writes the metrics of a single request to every sink
+func (s MultiSink) WriteRequestData(m *metrics.Metrics) error {
+	return s.each(func(sink Sink) error {
+		return sink.WriteRequestData(m)
+	})
+}
+
+// Flush flushes every sink
+func (s MultiSink) Flush() error {
+	return s.each(Sink.Flush)
+}
+
+// Close closes every sink
+func (s MultiSink) Close() error {
+	return s.each(Sink.Close)
+}
+
+// Dropped returns the number of requests whose metrics were dropped by any sink
+func (s MultiSink) Dropped() uint64 {
+	var dropped uint64
+	for _, sink := range s {
+		dropped += sink.Dropped()
+	}
+	return dropped
+}
+
+// Prometheus returns the Prometheus sink, if any
+func (s MultiSink) Prometheus() *PrometheusController {
+	for _, sink := range s {
+		if ctlr, ok := sink.(*PrometheusController); ok {
+			return ctlr
+		}
+	}
+	return nil
+}
+
+// each calls f for every sink and returns an error naming every sink that failed
+func (s MultiSink) each(f func(Sink) error) error {
+	var errs []string
+	for _, sink := range s {
+		if err := f(sink); err != nil {
+			errs = append(errs, sink.Name()+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// queue is a bounded queue of request metrics consumed by a single goroutine
+type queue struct {
+	points  chan *metrics.Metrics
+	flushes chan chan struct{}
+	dropped uint64
+}
+
+func newQueue(size int) *queue {
+	return &queue{
+		points:  make(chan *metrics.Metrics, size),
+		flushes: make(chan chan struct{}),
+	}
+}
+
+// push enqueues request metrics without blocking
+func (q *queue) push(m *metrics.Metrics) error {
+	select {
+	case q.points <- m:
+		return nil
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+		return errQueueFull
+	}
+}
+
+// run consumes request metrics forever. When a flush is requested,
+// every queued metric is consumed before flush is called.
+func (q *queue) run(consume func(*metrics.Metrics), flush func()) {
+	for {
+		select {
+		case m := <-q.points:
+			consume(m)
+		case flushed := <-q.flushes:
+			for len(q.points) > 0 {
+				consume(<-q.points)
+			}
+			flush()
+			close(flushed)
+		}
+	}
+}
+
+// flush waits until every queued metric has been consumed and flushed
+func (q *queue) flush() {
+	flushed := make(chan struct{})
+	q.flushes <- flushed
+	<-flushed
+}
+
+func (q *queue) droppedCount() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
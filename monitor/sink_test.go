@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSink struct {
+	name    string
+	err     error
+	written int
+	dropped uint64
+}
+
+func (s *fakeSink) Name() string { return s.name }
+
+func (s *fakeSink) WriteRequestData(m *metrics.Metrics) error {
+	s.written++
+	return s.err
+}
+
+func (s *fakeSink) Flush() error { return s.err }
+
+func (s *fakeSink) Close() error { return s.err }
+
+func (s *fakeSink) Dropped() uint64 { return s.dropped }
+
+func TestMultiSink(t *testing.T) {
+	one := &fakeSink{name: "one", dropped: 1}
+	two := &fakeSink{name: "two", dropped: 2, err: errors.New("failed")}
+	sink := MultiSink{one, two}
+
+	assert.Equal(t, "one,two", sink.Name())
+	assert.Equal(t, "two: failed", sink.WriteRequestData(&metrics.Metrics{}).Error())
+	assert.Equal(t, 1, one.written)
+	assert.Equal(t, 1, two.written)
+	assert.Equal(t, "two: failed", sink.Flush().Error())
+	assert.Equal(t, "two: failed", sink.Close().Error())
+	assert.Equal(t, uint64(3), sink.Dropped())
+	assert.Nil(t, sink.Prometheus())
+	assert.Nil(t, MultiSink{one}.Flush())
+}
+
+func TestNewSink(t *testing.T) {
+	defer viper.Reset()
+	viper.Set(config.FlagAnalyticsQueueSize.GetLong(), 10)
+
+	viper.Set(config.FlagAnalyticsBackends.GetLong(), []string{"prometheus", "file"})
+	sink := NewSink()
+	assert.Equal(t, 1, len(sink), "a file sink without a path is skipped")
+	assert.NotNil(t, sink.Prometheus())
+	assert.Equal(t, sink, sink.Prometheus().sinks)
+
+	viper.Set(config.FlagAnalyticsBackends.GetLong(), []string{})
+	assert.Equal(t, 0, len(NewSink()))
+}
+
+func TestIsEnabled(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set(config.FlagAnalyticsBackends.GetLong(), []string{"influxdb", " Prometheus"})
+	assert.True(t, IsEnabled(BackendInfluxDB))
+	assert.True(t, IsEnabled(BackendPrometheus))
+
+	viper.Set(config.FlagAnalyticsBackends.GetLong(), []string{"prometheus"})
+	assert.False(t, IsEnabled(BackendInfluxDB))
+}
+
+func TestQueue(t *testing.T) {
+	q := newQueue(2)
+	assert.Nil(t, q.push(&metrics.Metrics{}))
+	assert.Nil(t, q.push(&metrics.Metrics{}))
+	assert.Equal(t, errQueueFull, q.push(&metrics.Metrics{}))
+	assert.Equal(t, uint64(1), q.droppedCount())
+
+	consumed, flushed := 0, 0
+	go q.run(func(m *metrics.Metrics) { consumed++ }, func() { flushed++ })
+	q.flush()
+	assert.Equal(t, 2, consumed)
+	assert.Equal(t, 1, flushed)
+}
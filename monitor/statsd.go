@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/spf13/viper"
+)
+
+var invalidStatsdChars = regexp.MustCompile("[^a-zA-Z0-9_-]")
+
+// StatsdSink sends request metrics to StatsD over UDP
+type StatsdSink struct {
+	conn   net.Conn
+	prefix string
+	queue  *queue
+}
+
+// NewStatsdSink creates a new sink sending request metrics to StatsD
+func NewStatsdSink() (*StatsdSink, error) {
+	conn, err := net.Dial("udp", viper.GetString(config.FlagAnalyticsStatsdAddr.GetLong()))
+	if err != nil {
+		return nil, err
+	}
+	sink := &StatsdSink{
+		conn:   conn,
+		prefix: viper.GetString(config.FlagAnalyticsStatsdPrefix.GetLong()),
+		queue:  newQueue(viper.GetInt(config.FlagAnalyticsQueueSize.GetLong())),
+	}
+	go sink.queue.run(sink.send, func() {})
+	return sink, nil
+}
+
+// Name returns the name of the StatsD backend
+func (s *StatsdSink) Name() string {
+	return BackendStatsd
+}
+
+// WriteRequestData enqueues the metrics of a single request. They are
+// dropped if the queue is full.
+func (s *StatsdSink) WriteRequestData(m *metrics.Metrics) error {
+	return s.queue.push(m)
+}
+
+// Flush waits until the metrics of every queued request have been sent
+func (s *StatsdSink) Flush() error {
+	s.queue.flush()
+	return nil
+}
+
+// Close sends the metrics of every queued request and closes the connection
+func (s *StatsdSink) Close() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.conn.Close()
+}
+
+// Dropped returns the number of requests whose metrics were dropped
+// because the queue was full
+func (s *StatsdSink) Dropped() uint64 {
+	return s.queue.droppedCount()
+}
+
+// send writes the metrics of a single request as one packet
+func (s *StatsdSink) send(m *metrics.Metrics) {
+	if _, err := s.conn.Write(s.packet(m)); err != nil {
+		logrus.Warnf("error sending request metrics to StatsD: %s", err.Error())
+	}
+}
+
+// packet formats the metrics of a single request. Every request is counted
+// under the name and namespace of its proxy, its method and its status code.
+// Durations are sent as timers and other integer metrics as counters.
+func (s *StatsdSink) packet(m *metrics.Metrics) []byte {
+	base := statsdSegment(getString(m, "proxy_namespace")) + "." + statsdSegment(getString(m, "proxy_name"))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s:1|c\n", s.name(base, "requests", statsdSegment(getString(m, "http_method")), statsdSegment(getString(m, "http_response_code"))))
+	for _, metric := range *m {
+		switch value := metric.Value.(type) {
+		case int:
+			kind := "c"
+			if strings.HasSuffix(metric.Name, "_time") || strings.HasSuffix(metric.Name, "_duration") {
+				kind = "ms"
+			}
+			fmt.Fprintf(&buf, "%s:%d|%s\n", s.name(base, statsdSegment(metric.Name)), value, kind)
+		case string:
+			if metric.Name == "plugin_error" {
+				fmt.Fprintf(&buf, "%s:1|c\n", s.name(base, "plugin_errors", statsdSegment(value)))
+			}
+		}
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func (s *StatsdSink) name(segments ...string) string {
+	if s.prefix == "" {
+		return strings.Join(segments, ".")
+	}
+	return s.prefix + "." + strings.Join(segments, ".")
+}
+
+// statsdSegment sanitizes a single segment of a StatsD metric name
+func statsdSegment(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return invalidStatsdChars.ReplaceAllString(s, "_")
+}
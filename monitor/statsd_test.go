@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package monitor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsdSink(t *testing.T) {
+	defer viper.Reset()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	viper.Set(config.FlagAnalyticsStatsdAddr.GetLong(), conn.LocalAddr().String())
+	viper.Set(config.FlagAnalyticsStatsdPrefix.GetLong(), "kanali")
+	viper.Set(config.FlagAnalyticsQueueSize.GetLong(), 10)
+
+	sink, err := NewStatsdSink()
+	assert.Nil(t, err)
+	assert.Equal(t, "statsd", sink.Name())
+
+	assert.Nil(t, sink.WriteRequestData(&metrics.Metrics{
+		metrics.Metric{Name: "proxy_name", Value: "foo.bar", Index: true},
+		metrics.Metric{Name: "proxy_namespace", Value: "default", Index: true},
+		metrics.Metric{Name: "http_method", Value: "GET", Index: false},
+		metrics.Metric{Name: "http_response_code", Value: "200", Index: true},
+		metrics.Metric{Name: "total_time", Value: 20, Index: false},
+		metrics.Metric{Name: "upstream_attempts", Value: 2, Index: false},
+	}))
+	assert.Nil(t, sink.Close())
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "kanali.default.foo_bar.requests.GET.200:1|c\nkanali.default.foo_bar.total_time:20|ms\nkanali.default.foo_bar.upstream_attempts:2|c", string(buf[:n]))
+}
+
+func TestStatsdPacket(t *testing.T) {
+	sink := &StatsdSink{}
+	assert.Equal(t, "unknown.unknown.requests.unknown.401:1|c\nunknown.unknown.plugin_errors.apikey:1|c", string(sink.packet(&metrics.Metrics{
+		metrics.Metric{Name: "http_response_code", Value: "401", Index: true},
+		metrics.Metric{Name: "plugin_error", Value: "apikey", Index: false},
+	})))
+}
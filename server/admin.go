@@ -0,0 +1,161 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/monitor"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/spf13/viper"
+)
+
+// StartAdminServer will start the HTTP server that exposes the internal
+// state of this Kanali instance. It is not started if no admin port is set.
+// Prometheus metrics are exposed on /metrics if a controller is given.
+func StartAdminServer(promCtlr *monitor.PrometheusController) error {
+
+	port := viper.GetInt(config.FlagServerAdminPort.GetLong())
+	if port <= 0 {
+		logrus.Debug("admin server not configured")
+		return nil
+	}
+
+	address := fmt.Sprintf("%s:%d",
+		viper.GetString(config.FlagServerBindAddress.GetLong()),
+		port,
+	)
+
+	logrus.Infof("admin server listening on %s", address)
+
+	return http.ListenAndServe(address, adminRouter(promCtlr))
+
+}
+
+func adminRouter(promCtlr *monitor.PrometheusController) http.Handler {
+	mux := http.NewServeMux()
+	if promCtlr != nil {
+		mux.Handle("/metrics", promCtlr)
+	}
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	mux.HandleFunc("/debug/proxies", storeHandler(spec.ProxyStore))
+	mux.HandleFunc("/debug/bindings", storeHandler(spec.BindingStore))
+	mux.HandleFunc("/debug/services", storeHandler(spec.ServiceStore))
+	mux.HandleFunc("/debug/mocks", storeHandler(spec.MockResponseStore))
+	mux.HandleFunc("/debug/breakers", breakersHandler)
+	mux.HandleFunc("/debug/ejections", ejectionsHandler)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// healthzHandler reports that this Kanali instance is running.
+// It can be used as the liveness probe of the Kanali pod.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler reports whether this Kanali instance should receive traffic.
+// It can be used as the readiness probe of the Kanali pod.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !IsReady() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// storeHandler dumps the content of a store. The value of any field
+// named like an API key is redacted as it may be a credential.
+func storeHandler(store json.Marshaler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dump, err := redactAPIKeys(store)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeAdminJSON(w, dump)
+	}
+}
+
+func breakersHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, spec.BreakerStore.Status())
+}
+
+func ejectionsHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, spec.HealthStore.Status())
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("error writing admin response: %s", err.Error())
+	}
+}
+
+// redactAPIKeys returns a copy of the JSON encoding of a value in which
+// the value of every field whose name looks like an API key is masked
+func redactAPIKeys(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var dump interface{}
+	if err := json.Unmarshal(raw, &dump); err != nil {
+		return nil, err
+	}
+	return redact(dump, viper.GetString(config.FlagProxyHeaderMaskValue.GetLong())), nil
+}
+
+func redact(v interface{}, mask string) interface{} {
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		for k, value := range typed {
+			if isAPIKeyField(k) {
+				typed[k] = mask
+			} else {
+				typed[k] = redact(value, mask)
+			}
+		}
+	case []interface{}:
+		for i, value := range typed {
+			typed[i] = redact(value, mask)
+		}
+	}
+	return v
+}
+
+// isAPIKeyField reports whether a field name, such as apikey, X-API-Key
+// or apiKeyData, names an API key
+func isAPIKeyField(name string) bool {
+	name = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	return strings.Contains(name, "apikey")
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/monitor"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	adminRouter(nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\n", rec.Body.String())
+}
+
+func TestReadyzHandler(t *testing.T) {
+	defer SetReady(false)
+	defer func() { readinessChecks.checks = nil }()
+
+	SetReady(false)
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	adminRouter(nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	SetReady(true)
+	rec = httptest.NewRecorder()
+	adminRouter(nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\n", rec.Body.String())
+
+	synced := false
+	AddReadinessCheck(func() bool { return synced })
+	rec = httptest.NewRecorder()
+	adminRouter(nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	synced = true
+	rec = httptest.NewRecorder()
+	adminRouter(nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestStoreHandler(t *testing.T) {
+	defer spec.ProxyStore.Clear()
+	spec.ProxyStore.Clear()
+	spec.ProxyStore.Set(spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "exampleAPIProxyOne", Namespace: "foo"},
+		Spec: spec.APIProxySpec{
+			Path:    "/api/v1/accounts",
+			Service: spec.Service{Name: "bar"},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/proxies", nil)
+	adminRouter(nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var dump struct {
+		Default struct {
+			Children map[string]interface{} `json:"children"`
+		} `json:"default"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &dump))
+	assert.NotNil(t, dump.Default.Children["api"])
+
+	for _, path := range []string{"/debug/bindings", "/debug/services", "/debug/mocks"} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		adminRouter(nil).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "{}\n", rec.Body.String(), path)
+	}
+}
+
+func TestRedactAPIKeys(t *testing.T) {
+	viper.SetDefault(config.FlagProxyHeaderMaskValue.GetLong(), "omitted")
+	defer viper.Reset()
+
+	dump, err := redactAPIKeys(map[string]interface{}{
+		"name": "foo",
+		"headers": []map[string]string{
+			{"apikey": "secret", "X-API-Key": "secret", "accept": "*/*"},
+		},
+		"spec": map[string]string{"apiKeyData": "secret"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name": "foo",
+		"headers": []interface{}{
+			map[string]interface{}{"apikey": "omitted", "X-API-Key": "omitted", "accept": "*/*"},
+		},
+		"spec": map[string]interface{}{"apiKeyData": "omitted"},
+	}, dump)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	adminRouter(nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	adminRouter(monitor.NewPrometheusController()).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# TYPE kanali_proxies gauge")
+}
+
+func TestBreakersHandler(t *testing.T) {
+	defer spec.BreakerStore.Clear()
+	spec.BreakerStore.Clear()
+	spec.BreakerStore.Record("foo", "bar", spec.CircuitBreaker{FailureThreshold: 1}, false)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/breakers", nil)
+	adminRouter(nil).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var status []spec.BreakerStatus
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, 1, len(status))
+	assert.Equal(t, "foo", status[0].Namespace)
+	assert.Equal(t, "bar", status[0].Service)
+	assert.Equal(t, spec.BreakerOpen, status[0].State)
+}
+
+func TestEjectionsHandler(t *testing.T) {
+	defer spec.HealthStore.Clear()
+	spec.HealthStore.Clear()
+	spec.HealthStore.RecordPassive(spec.Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.1:8080"}, spec.HealthCheck{ConsecutiveFailures: 1}, false)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/ejections", nil)
+	adminRouter(nil).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var ejections []spec.Ejection
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &ejections))
+	assert.Equal(t, 1, len(ejections))
+	assert.Equal(t, "10.0.0.1:8080", ejections[0].Address)
+	assert.Equal(t, "bar", ejections[0].Service)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/spec"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// certificateKey identifies a serving certificate. The resource version
+// ensures that a certificate is never served after its secret changes.
+type certificateKey struct {
+	namespace       string
+	name            string
+	resourceVersion string
+}
+
+// certificateFactory is a concurrency safe cache of the serving certificates
+// parsed from the secrets named by the hosts of every APIProxy
+type certificateFactory struct {
+	mutex        sync.Mutex
+	certificates map[certificateKey]*tls.Certificate
+}
+
+var certificates = &certificateFactory{certificates: map[certificateKey]*tls.Certificate{}}
+
+func init() {
+	spec.SecretStore.Observe(certificates.invalidate)
+}
+
+// getCertificate retrieves the serving certificate for the host requested
+// using SNI. If no APIProxy declares a certificate for that host, nil is
+// returned so that the default certificate is served.
+func (f *certificateFactory) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName == "" {
+		return nil, nil
+	}
+
+	namespace, ssl := spec.ProxyStore.HostSSL(hello.ServerName)
+	if ssl == nil {
+		return nil, nil
+	}
+
+	untypedSecret, err := spec.SecretStore.Get(ssl.SecretName, namespace)
+	if err != nil || untypedSecret == nil {
+		logrus.Warnf("secret %s for host %s not found - serving default certificate", ssl.SecretName, hello.ServerName)
+		return nil, nil
+	}
+	secret, _ := untypedSecret.(api.Secret)
+
+	key := certificateKey{
+		namespace:       namespace,
+		name:            secret.ObjectMeta.Name,
+		resourceVersion: secret.ObjectMeta.ResourceVersion,
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if cert, ok := f.certificates[key]; ok {
+		return cert, nil
+	}
+
+	cert, err := spec.X509KeyPair(secret)
+	if err != nil {
+		logrus.Warnf("secret %s for host %s does not contain a valid cert/key pair - serving default certificate", ssl.SecretName, hello.ServerName)
+		return nil, nil
+	}
+
+	f.certificates[key] = cert
+	return cert, nil
+}
+
+// invalidate removes every certificate parsed from the given secret
+// so that the next handshake uses its latest version
+func (f *certificateFactory) invalidate(namespace, name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key := range f.certificates {
+		if key.namespace == namespace && key.name == name {
+			logrus.Debugf("discarding serving certificate from secret %s", name)
+			delete(f.certificates, key)
+		}
+	}
+}
+
+// clear removes every certificate
+func (f *certificateFactory) clear() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key := range f.certificates {
+		delete(f.certificates, key)
+	}
+}
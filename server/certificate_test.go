@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func getTestServingSecret(t *testing.T, host, resourceVersion string) api.Secret {
+	dir, certFile, keyFile := writeTestCertificate(t, host)
+	defer os.RemoveAll(dir)
+	cert, _ := ioutil.ReadFile(certFile)
+	key, _ := ioutil.ReadFile(keyFile)
+	return api.Secret{
+		ObjectMeta: api.ObjectMeta{
+			Name:            "servingsecret",
+			Namespace:       "foo",
+			ResourceVersion: resourceVersion,
+		},
+		Type: "kubernetes.io/tls",
+		Data: map[string][]byte{
+			"tls.crt": cert,
+			"tls.key": key,
+		},
+	}
+}
+
+func leafCommonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestGetCertificate(t *testing.T) {
+	defer spec.ProxyStore.Clear()
+	defer spec.SecretStore.Clear()
+	defer certificates.clear()
+
+	spec.ProxyStore.Set(spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "exampleAPIProxyOne", Namespace: "foo"},
+		Spec: spec.APIProxySpec{
+			Path:    "/api/v1/accounts",
+			Service: spec.Service{Name: "bar"},
+			Hosts: []spec.Host{
+				{Name: "foo.bar.com", SSL: spec.SSL{SecretName: "servingsecret"}},
+			},
+		},
+	})
+
+	cert, err := certificates.getCertificate(&tls.ClientHelloInfo{ServerName: "foo.bar.com"})
+	assert.Nil(t, err)
+	assert.Nil(t, cert, "a missing secret should fall back to the default certificate")
+
+	spec.SecretStore.Set(getTestServingSecret(t, "foo.bar.com", "1"))
+	cert, err = certificates.getCertificate(&tls.ClientHelloInfo{ServerName: "FOO.bar.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "foo.bar.com", leafCommonName(t, cert))
+	cached, _ := certificates.getCertificate(&tls.ClientHelloInfo{ServerName: "foo.bar.com"})
+	assert.True(t, cert == cached)
+
+	// updating the secret swaps the certificate
+	spec.SecretStore.Update(getTestServingSecret(t, "new.foo.bar.com", "2"))
+	assert.Equal(t, 0, len(certificates.certificates))
+	updated, err := certificates.getCertificate(&tls.ClientHelloInfo{ServerName: "foo.bar.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "new.foo.bar.com", leafCommonName(t, updated))
+
+	cert, err = certificates.getCertificate(&tls.ClientHelloInfo{ServerName: "unknown.bar.com"})
+	assert.Nil(t, err)
+	assert.Nil(t, cert)
+	cert, err = certificates.getCertificate(&tls.ClientHelloInfo{})
+	assert.Nil(t, err)
+	assert.Nil(t, cert)
+}
+
+func TestTLSListenerSNI(t *testing.T) {
+	resetTLSFlags()
+	defer resetTLSFlags()
+	defer spec.ProxyStore.Clear()
+	defer spec.SecretStore.Clear()
+	defer certificates.clear()
+
+	dir, certFile, keyFile := writeTestCertificate(t, "default.bar.com")
+	defer os.RemoveAll(dir)
+	viper.Set(config.FlagTLSCertFile.GetLong(), certFile)
+	viper.Set(config.FlagTLSKeyFile.GetLong(), keyFile)
+
+	spec.ProxyStore.Set(spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "exampleAPIProxyOne", Namespace: "foo"},
+		Spec: spec.APIProxySpec{
+			Path:    "/api/v1/accounts",
+			Service: spec.Service{Name: "bar"},
+			Hosts: []spec.Host{
+				{Name: "foo.bar.com", SSL: spec.SSL{SecretName: "servingsecret"}},
+			},
+		},
+	})
+	spec.SecretStore.Set(getTestServingSecret(t, "foo.bar.com", "1"))
+
+	tlsConfig, err := buildTLSConfig()
+	assert.Nil(t, err)
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := tls.Server(conn, tlsConfig)
+			tlsConn.Handshake()
+			tlsConn.Close()
+		}
+	}()
+
+	for serverName, expected := range map[string]string{
+		"foo.bar.com":     "foo.bar.com",
+		"unknown.bar.com": "default.bar.com",
+	} {
+		conn, err := tls.Dial("tcp4", listener.Addr().String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if !assert.Nil(t, err) {
+			continue
+		}
+		assert.Equal(t, expected, conn.ConnectionState().PeerCertificates[0].Subject.CommonName)
+		conn.Close()
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ready is non-zero while this Kanali instance is accepting requests
+var ready int32
+
+// readinessChecks must all pass for this Kanali instance to be ready
+var readinessChecks struct {
+	sync.RWMutex
+	checks []func() bool
+}
+
+// AddReadinessCheck adds a condition that must be met, in addition
+// to accepting requests, for this Kanali instance to be ready
+func AddReadinessCheck(check func() bool) {
+	readinessChecks.Lock()
+	defer readinessChecks.Unlock()
+	readinessChecks.checks = append(readinessChecks.checks, check)
+}
+
+// SetReady sets whether this Kanali instance is accepting requests
+func SetReady(r bool) {
+	var v int32
+	if r {
+		v = 1
+	}
+	atomic.StoreInt32(&ready, v)
+}
+
+// IsReady reports whether this Kanali instance should receive traffic
+func IsReady() bool {
+	if atomic.LoadInt32(&ready) != 1 {
+		return false
+	}
+
+	readinessChecks.RLock()
+	defer readinessChecks.RUnlock()
+	for _, check := range readinessChecks.checks {
+		if !check() {
+			return false
+		}
+	}
+	return true
+}
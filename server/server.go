@@ -21,14 +21,11 @@
 package server
 
 import (
-	"crypto/rand"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/http"
-	"os"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/armon/go-proxyproto"
@@ -38,72 +35,79 @@ import (
 	"github.com/spf13/viper"
 )
 
-// Start will start the HTTP server for the Kanali gateway
+// Gateway is the HTTP server for the Kanali gateway
+type Gateway struct {
+	server   *http.Server
+	listener net.Listener
+	scheme   string
+}
+
+// NewGateway creates the HTTP server for the Kanali gateway along with its listener.
 // It could either be an HTTP or HTTPS server depending on the configuration
-func Start(influxCtlr *monitor.InfluxController) {
+func NewGateway(sink monitor.Sink) (*Gateway, error) {
 
-	var listener net.Listener
-	var lerr error
-	var scheme string
+	accessLog, err := h.NewAccessLogger()
+	if err != nil {
+		return nil, err
+	}
 
-	router := h.Logger(h.Handler{InfluxController: influxCtlr, H: h.IncomingRequest})
+	router := h.Logger(h.Handler{Sink: sink, AccessLog: accessLog, H: h.IncomingRequest})
 
 	address := fmt.Sprintf("%s:%d",
 		viper.GetString(config.FlagServerBindAddress.GetLong()),
 		getKanaliPort(),
 	)
 
-	server := &http.Server{Addr: address, Handler: router}
+	tlsConfig, err := buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
 
-	if viper.GetString(config.FlagTLSCertFile.GetLong()) == "" || viper.GetString(config.FlagTLSKeyFile.GetLong()) == "" {
-		scheme = "http"
-		listener, lerr = net.Listen("tcp4", address)
-		if lerr != nil {
-			logrus.Fatal("error creating http net listener")
-			os.Exit(1)
-		}
-	} else {
-		scheme = "https"
-		cert, err := tls.LoadX509KeyPair(viper.GetString(config.FlagTLSCertFile.GetLong()), viper.GetString(config.FlagTLSKeyFile.GetLong()))
-		if err != nil {
-			logrus.Fatal("could not load server cert/key pair")
-			os.Exit(1)
-		}
-		listener, lerr = tls.Listen("tcp4", address, &tls.Config{Certificates: []tls.Certificate{cert}, Rand: rand.Reader})
-		if lerr != nil {
-			logrus.Fatal("error creating https net listener")
-			os.Exit(1)
-		}
-		// is bi-direction ssl required
-		if viper.GetString(config.FlagTLSCaFile.GetLong()) != "" {
-			caCert, err := ioutil.ReadFile(viper.GetString(config.FlagTLSCaFile.GetLong()))
-			if err != nil {
-				logrus.Fatal(err.Error())
-				os.Exit(1)
-			}
-			// load and set client certificate
-			caCertPool := x509.NewCertPool()
-			caCertPool.AppendCertsFromPEM(caCert)
-			tlsConfig := &tls.Config{
-				ClientCAs:  caCertPool,
-				ClientAuth: tls.RequireAndVerifyClientCert,
-			}
-			tlsConfig.BuildNameToCertificate()
-			server.TLSConfig = tlsConfig
-		}
+	listener, err := net.Listen("tcp4", address)
+	if err != nil {
+		return nil, fmt.Errorf("error creating net listener: %s", err.Error())
 	}
 
+	// the proxy protocol header precedes the TLS handshake
 	if viper.GetBool(config.FlagServerProxyProtocol.GetLong()) {
 		listener = &proxyproto.Listener{Listener: listener}
 	}
 
-	logrus.Infof(fmt.Sprintf("%s server listening on %s", scheme, address))
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	return &Gateway{
+		server: &http.Server{
+			Addr:    address,
+			Handler: router,
+			// ApiProxies can lower, but not raise, this limit
+			MaxHeaderBytes: viper.GetInt(config.FlagProxyMaxHeaderBytes.GetLong()),
+		},
+		listener: listener,
+		scheme:   scheme,
+	}, nil
+
+}
+
+// Serve accepts incoming requests until the gateway is shut down. This
+// Kanali instance is reported as ready once it is accepting requests.
+func (g *Gateway) Serve() error {
+	logrus.Infof("%s server listening on %s", g.scheme, g.server.Addr)
 
-	if err := server.Serve(listener); err != nil {
-		logrus.Fatal(err.Error())
-		os.Exit(1)
+	SetReady(true)
+	if err := g.server.Serve(g.listener); err != nil && err != http.ErrServerClosed {
+		return err
 	}
+	return nil
+}
 
+// Shutdown stops accepting incoming requests and waits for in flight requests
+// to complete. If the context expires first, its error is returned.
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	return g.server.Shutdown(ctx)
 }
 
 func getKanaliPort() int {
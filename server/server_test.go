@@ -21,7 +21,11 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/northwesternmutual/kanali/config"
 	"github.com/spf13/viper"
@@ -39,3 +43,46 @@ func TestGetKanaliPort(t *testing.T) {
 	viper.Set(config.FlagTLSKeyFile.GetLong(), "bye")
 	assert.Equal(t, getKanaliPort(), 443)
 }
+
+func TestGateway(t *testing.T) {
+	resetTLSFlags()
+	defer viper.Set(config.FlagServerPort.GetLong(), 0)
+	defer viper.Set(config.FlagServerBindAddress.GetLong(), "")
+	defer SetReady(false)
+
+	free, _ := net.Listen("tcp4", "127.0.0.1:0")
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	viper.Set(config.FlagServerBindAddress.GetLong(), "127.0.0.1")
+	viper.Set(config.FlagServerPort.GetLong(), port)
+
+	gateway, err := NewGateway(nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "http", gateway.scheme)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- gateway.Serve()
+	}()
+
+	// wait for the gateway to be ready
+	for i := 0; i < 100 && !IsReady(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, IsReady())
+
+	conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Nil(t, err)
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, gateway.Shutdown(ctx))
+	assert.Nil(t, <-errs, "a gateway that is shut down should not report an error")
+
+	_, err = net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.NotNil(t, err, "a gateway that is shut down should not accept connections")
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/spf13/viper"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// HTTP/2 requires one of these cipher suites to be
+// enabled as per https://http2.github.io/http2-spec/#rfc.section.9.2.2
+var http2CipherSuites = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+}
+
+// buildTLSConfig builds the TLS configuration of the server listener from
+// the tls flags. It returns nil if the server is not configured for TLS.
+func buildTLSConfig() (*tls.Config, error) {
+	certFile := viper.GetString(config.FlagTLSCertFile.GetLong())
+	keyFile := viper.GetString(config.FlagTLSKeyFile.GetLong())
+	if certFile == "" || keyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server cert/key pair: %s", err.Error())
+	}
+
+	minVersion, err := parseTLSVersion(viper.GetString(config.FlagTLSMinVersion.GetLong()))
+	if err != nil {
+		return nil, err
+	}
+
+	suites, err := parseCipherSuites(viper.GetStringSlice(config.FlagTLSCipherSuites.GetLong()))
+	if err != nil {
+		return nil, err
+	}
+
+	// the configured certificate is served to clients whose
+	// requested host has no certificate declared by an APIProxy
+	tlsConfig := &tls.Config{
+		Certificates:   []tls.Certificate{cert},
+		GetCertificate: certificates.getCertificate,
+		Rand:           rand.Reader,
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if suites != nil {
+		tlsConfig.PreferServerCipherSuites = true
+		if !supportsHTTP2(suites) {
+			logrus.Warn("none of the configured cipher suites are allowed by HTTP/2 - only HTTP/1.1 will be negotiated")
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		}
+	}
+
+	if err := configureClientAuth(tlsConfig); err != nil {
+		return nil, err
+	}
+
+	return tlsConfig, nil
+}
+
+// configureClientAuth configures how client certificates are verified.
+// Client certificates are verified using the certificate authority bundle.
+func configureClientAuth(tlsConfig *tls.Config) error {
+	caFile := viper.GetString(config.FlagTLSCaFile.GetLong())
+	mode := strings.ToLower(viper.GetString(config.FlagTLSClientAuth.GetLong()))
+	if mode == "" {
+		mode = "none"
+		if caFile != "" {
+			mode = "require"
+		}
+	}
+
+	switch mode {
+	case "none":
+		tlsConfig.ClientAuth = tls.NoClientCert
+		return nil
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("client auth mode %s is not supported", mode)
+	}
+
+	if caFile == "" {
+		return errors.New("a certificate authority bundle is required to verify client certificates")
+	}
+	caCert, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return fmt.Errorf("no certificates found in %s", caFile)
+	}
+	tlsConfig.ClientCAs = caCertPool
+
+	return nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("tls version %s is not supported", version)
+	}
+	return v, nil
+}
+
+// parseCipherSuites converts cipher suite names into their identifiers. It
+// returns nil if no names are given so that the Go defaults are used.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	var suites []uint16
+	for _, name := range names {
+		suite, ok := cipherSuites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("cipher suite %s is not supported", name)
+		}
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
+
+func supportsHTTP2(suites []uint16) bool {
+	for _, suite := range suites {
+		for _, required := range http2CipherSuites {
+			if suite == required {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+// writeTestCertificate writes a self signed certificate, and its private
+// key, for the given host to a temporary directory
+func writeTestCertificate(t *testing.T, host string) (string, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "kanali")
+	assert.Nil(t, err)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return dir, certFile, keyFile
+}
+
+func resetTLSFlags() {
+	viper.Set(config.FlagTLSCertFile.GetLong(), "")
+	viper.Set(config.FlagTLSKeyFile.GetLong(), "")
+	viper.Set(config.FlagTLSCaFile.GetLong(), "")
+	viper.Set(config.FlagTLSMinVersion.GetLong(), config.FlagTLSMinVersion.Value)
+	viper.Set(config.FlagTLSCipherSuites.GetLong(), []string{})
+	viper.Set(config.FlagTLSClientAuth.GetLong(), "")
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	resetTLSFlags()
+	defer resetTLSFlags()
+
+	tlsConfig, err := buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig, "tls should not be configured without a cert/key pair")
+
+	dir, certFile, keyFile := writeTestCertificate(t, "foo.bar.com")
+	defer os.RemoveAll(dir)
+	viper.Set(config.FlagTLSCertFile.GetLong(), certFile)
+	viper.Set(config.FlagTLSKeyFile.GetLong(), keyFile)
+
+	tlsConfig, err = buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tlsConfig.Certificates))
+	assert.Equal(t, uint16(tls.VersionTLS10), tlsConfig.MinVersion)
+	assert.Nil(t, tlsConfig.CipherSuites)
+	assert.Equal(t, []string{"h2", "http/1.1"}, tlsConfig.NextProtos)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	viper.Set(config.FlagTLSMinVersion.GetLong(), "1.1")
+	viper.Set(config.FlagTLSCipherSuites.GetLong(), []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	tlsConfig, err = buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS11), tlsConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+	assert.True(t, tlsConfig.PreferServerCipherSuites)
+	assert.Equal(t, []string{"h2", "http/1.1"}, tlsConfig.NextProtos)
+
+	viper.Set(config.FlagTLSCipherSuites.GetLong(), []string{"TLS_RSA_WITH_AES_128_CBC_SHA"})
+	tlsConfig, err = buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http/1.1"}, tlsConfig.NextProtos, "h2 requires an allowed cipher suite")
+
+	viper.Set(config.FlagTLSCipherSuites.GetLong(), []string{"TLS_FOO"})
+	_, err = buildTLSConfig()
+	assert.Equal(t, "cipher suite TLS_FOO is not supported", err.Error())
+	viper.Set(config.FlagTLSCipherSuites.GetLong(), []string{})
+
+	viper.Set(config.FlagTLSMinVersion.GetLong(), "0.9")
+	_, err = buildTLSConfig()
+	assert.Equal(t, "tls version 0.9 is not supported", err.Error())
+	viper.Set(config.FlagTLSMinVersion.GetLong(), config.FlagTLSMinVersion.Value)
+
+	viper.Set(config.FlagTLSClientAuth.GetLong(), "require")
+	_, err = buildTLSConfig()
+	assert.Equal(t, "a certificate authority bundle is required to verify client certificates", err.Error())
+
+	viper.Set(config.FlagTLSClientAuth.GetLong(), "sometimes")
+	_, err = buildTLSConfig()
+	assert.Equal(t, "client auth mode sometimes is not supported", err.Error())
+
+	viper.Set(config.FlagTLSClientAuth.GetLong(), "")
+	viper.Set(config.FlagTLSCaFile.GetLong(), certFile)
+	tlsConfig, err = buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+
+	viper.Set(config.FlagTLSClientAuth.GetLong(), "request")
+	tlsConfig, err = buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+}
+
+func TestTLSListenerHTTP2(t *testing.T) {
+	resetTLSFlags()
+	defer resetTLSFlags()
+
+	dir, certFile, keyFile := writeTestCertificate(t, "127.0.0.1")
+	defer os.RemoveAll(dir)
+	viper.Set(config.FlagTLSCertFile.GetLong(), certFile)
+	viper.Set(config.FlagTLSKeyFile.GetLong(), keyFile)
+
+	tlsConfig, err := buildTLSConfig()
+	assert.Nil(t, err)
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	go server.Serve(tls.NewListener(listener, tlsConfig))
+	defer listener.Close()
+
+	pool := x509.NewCertPool()
+	pem, _ := ioutil.ReadFile(certFile)
+	pool.AppendCertsFromPEM(pem)
+	client := &http.Client{Transport: &http2.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}}}
+
+	resp, err := client.Get("https://" + listener.Addr().String())
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "HTTP/2.0", string(body))
+}
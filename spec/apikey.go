@@ -149,6 +149,13 @@ func (s *KeyFactory) IsEmpty() bool {
 	return len(s.keyMap) == 0
 }
 
+// Size returns the number of keys in the store
+func (s *KeyFactory) Size() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.keyMap)
+}
+
 // Decrypt decrypts the data in an APIKey
 func (k *APIKey) Decrypt() error {
 	cipherText, err := hex.DecodeString(k.Spec.APIKeyData)
@@ -21,6 +21,7 @@
 package spec
 
 import (
+	"encoding/json"
 	"errors"
 	"regexp"
 	"strings"
@@ -101,6 +102,14 @@ func init() {
 	BindingStore = &BindingFactory{sync.RWMutex{}, map[string]map[string]APIKeyBinding{}}
 }
 
+// MarshalJSON returns the JSON encoding of every binding in the store,
+// keyed by namespace and the name of the proxy it is bound to
+func (s *BindingFactory) MarshalJSON() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return json.Marshal(s.bindingMap)
+}
+
 // Clear will remove all bindings from the store
 func (s *BindingFactory) Clear() {
 	s.mutex.Lock()
@@ -117,6 +126,17 @@ func (s *BindingFactory) IsEmpty() bool {
 	return len(s.bindingMap) == 0
 }
 
+// Size returns the number of bindings in the store
+func (s *BindingFactory) Size() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	size := 0
+	for _, bindings := range s.bindingMap {
+		size += len(bindings)
+	}
+	return size
+}
+
 // Update will update an APIKeyBinding
 func (s *BindingFactory) Update(obj interface{}) error {
 	s.mutex.Lock()
@@ -21,10 +21,15 @@
 package spec
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"sort"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/northwesternmutual/kanali/utils"
@@ -44,17 +49,244 @@ type APIProxy struct {
 	unversioned.TypeMeta `json:",inline"`
 	api.ObjectMeta       `json:"metadata,omitempty"`
 	Spec                 APIProxySpec `json:"spec"`
+	// PathParams holds the values captured from the incoming request path
+	// by the named parameters and wildcard of Spec.Path. It is only
+	// populated on an APIProxy retrieved from the ProxyStore.
+	PathParams map[string]string `json:"-"`
 }
 
 // APIProxySpec represents the data fields for the APIProxy TPR
 type APIProxySpec struct {
-	Path    string   `json:"path"`
-	Target  string   `json:"target,omitempty"`
-	Mock    *Mock    `json:"mock,omitempty"`
-	Hosts   []Host   `json:"hosts,omitempty"`
-	Service Service  `json:"service,omitempty"`
-	Plugins []Plugin `json:"plugins,omitempty"`
-	SSL     SSL      `json:"ssl,omitempty"`
+	Path            string           `json:"path"`
+	Target          string           `json:"target,omitempty"`
+	Protocol        string           `json:"protocol,omitempty"`
+	VirtualHosts    []string         `json:"virtualHosts,omitempty"`
+	Mock            *Mock            `json:"mock,omitempty"`
+	Hosts           []Host           `json:"hosts,omitempty"`
+	Service         Service          `json:"service,omitempty"`
+	Backends        []Backend        `json:"backends,omitempty"`
+	Stickiness      *Stickiness      `json:"stickiness,omitempty"`
+	Mirror          *Mirror          `json:"mirror,omitempty"`
+	Retry           *Retry           `json:"retry,omitempty"`
+	CircuitBreaker  *CircuitBreaker  `json:"circuitBreaker,omitempty"`
+	LoadBalancer    *LoadBalancer    `json:"loadBalancer,omitempty"`
+	HealthCheck     *HealthCheck     `json:"healthCheck,omitempty"`
+	Limits          *Limits          `json:"limits,omitempty"`
+	RequestHeaders  *HeaderTransform `json:"requestHeaders,omitempty"`
+	ResponseHeaders *HeaderTransform `json:"responseHeaders,omitempty"`
+	Plugins         []Plugin         `json:"plugins,omitempty"`
+	SSL             SSL              `json:"ssl,omitempty"`
+}
+
+// Backend represents an upstream service that receives
+// a weighted share of the traffic for a proxy
+type Backend struct {
+	Service Service `json:"service"`
+	Weight  int     `json:"weight"`
+}
+
+// Stickiness defines how requests are pinned to the same backend.
+// The value of the named header or cookie is hashed to select a backend.
+type Stickiness struct {
+	Header string `json:"header,omitempty"`
+	Cookie string `json:"cookie,omitempty"`
+}
+
+// Mirror represents a service that receives a copy of a sample
+// of the traffic for a proxy. Its responses are discarded.
+type Mirror struct {
+	Service Service `json:"service"`
+	Percent int     `json:"percent"`
+}
+
+const (
+	// ProtocolHTTP1 proxies requests to the upstream service using HTTP/1.1
+	ProtocolHTTP1 = "http1"
+	// ProtocolH2 proxies requests to the upstream service using HTTP/2 over TLS
+	ProtocolH2 = "h2"
+	// ProtocolH2C proxies requests to the upstream service using HTTP/2 over cleartext
+	ProtocolH2C = "h2c"
+	// ProtocolGRPC proxies requests to a gRPC upstream service using HTTP/2,
+	// over TLS if it is configured for the proxy and over cleartext otherwise
+	ProtocolGRPC = "grpc"
+)
+
+const (
+	// LoadBalancerRoundRobin chooses each pod in turn
+	LoadBalancerRoundRobin = "roundRobin"
+	// LoadBalancerLeastOutstanding chooses the pod with the fewest requests in flight
+	LoadBalancerLeastOutstanding = "leastOutstanding"
+	// LoadBalancerConsistentHash chooses a pod based on a hash of a header value or the client IP
+	LoadBalancerConsistentHash = "consistentHash"
+)
+
+// LoadBalancer defines how a pod of the upstream service is chosen. If
+// defined, requests are sent directly to the pod IPs of the upstream service.
+type LoadBalancer struct {
+	Algorithm string `json:"algorithm"`
+	Header    string `json:"header,omitempty"`
+}
+
+// Retry defines when and how a failed upstream request is retried.
+// Durations are expressed in the format accepted by time.ParseDuration.
+type Retry struct {
+	MaxAttempts int      `json:"maxAttempts"`
+	StatusCodes []int    `json:"statusCodes,omitempty"`
+	Methods     []string `json:"methods,omitempty"`
+	Backoff     string   `json:"backoff,omitempty"`
+	MaxBackoff  string   `json:"maxBackoff,omitempty"`
+	Budget      string   `json:"budget,omitempty"`
+}
+
+var (
+	defaultRetryStatusCodes = []int{502, 503, 504}
+	defaultRetryMethods     = []string{"GET", "HEAD", "OPTIONS", "PUT", "DELETE", "TRACE"}
+	defaultRetryBackoff     = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = time.Second
+)
+
+// IsRetryableStatus reports whether an upstream response with the given
+// status code should be retried. If no status codes are defined,
+// 502, 503 and 504 responses are retried.
+func (r Retry) IsRetryableStatus(code int) bool {
+	codes := r.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryableMethod reports whether a request with the given method may be
+// retried. If no methods are defined, only idempotent methods are retried.
+func (r Retry) IsRetryableMethod(method string) bool {
+	methods := r.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBackoff returns the delay before the first retry. Subsequent
+// retries double this delay. It defaults to 100ms.
+func (r Retry) GetBackoff() time.Duration {
+	return parseDurationOrDefault(r.Backoff, defaultRetryBackoff)
+}
+
+// GetMaxBackoff returns the maximum delay between retries. It defaults to 1s.
+func (r Retry) GetMaxBackoff() time.Duration {
+	return parseDurationOrDefault(r.MaxBackoff, defaultRetryMaxBackoff)
+}
+
+// GetBudget returns the maximum length of time that may be spent on all
+// attempts, after which no further retries are made. Zero means no limit.
+func (r Retry) GetBudget() time.Duration {
+	return parseDurationOrDefault(r.Budget, 0)
+}
+
+// Limits bounds the time taken by, and the size of, the requests of a proxy.
+// Durations are expressed in the format accepted by time.ParseDuration.
+// A limit that is not set, or a nil Limits, falls back to the given default.
+type Limits struct {
+	ConnectTimeout        string `json:"connectTimeout,omitempty"`
+	ResponseHeaderTimeout string `json:"responseHeaderTimeout,omitempty"`
+	Timeout               string `json:"timeout,omitempty"`
+	MaxRequestBodyBytes   int64  `json:"maxRequestBodyBytes,omitempty"`
+	MaxHeaderBytes        int    `json:"maxHeaderBytes,omitempty"`
+}
+
+// GetConnectTimeout returns the maximum length of time
+// taken to establish a connection to the upstream service
+func (l *Limits) GetConnectTimeout(d time.Duration) time.Duration {
+	if l == nil {
+		return d
+	}
+	return parseDurationOrDefault(l.ConnectTimeout, d)
+}
+
+// GetResponseHeaderTimeout returns the maximum length of time to wait for the
+// headers of the upstream response once the request has been written
+func (l *Limits) GetResponseHeaderTimeout(d time.Duration) time.Duration {
+	if l == nil {
+		return d
+	}
+	return parseDurationOrDefault(l.ResponseHeaderTimeout, d)
+}
+
+// GetTimeout returns the maximum length of time taken by a request,
+// from the moment its proxy is found until its response is written
+func (l *Limits) GetTimeout(d time.Duration) time.Duration {
+	if l == nil {
+		return d
+	}
+	return parseDurationOrDefault(l.Timeout, d)
+}
+
+// GetMaxRequestBodyBytes returns the maximum size of a request body
+func (l *Limits) GetMaxRequestBodyBytes(d int64) int64 {
+	if l == nil || l.MaxRequestBodyBytes <= 0 {
+		return d
+	}
+	return l.MaxRequestBodyBytes
+}
+
+// GetMaxHeaderBytes returns the maximum size of the headers of a request
+func (l *Limits) GetMaxHeaderBytes(d int) int {
+	if l == nil || l.MaxHeaderBytes <= 0 {
+		return d
+	}
+	return l.MaxHeaderBytes
+}
+
+// HeaderTransform declares changes to the headers of a request or response.
+// Headers are removed first, then set and finally added. Values are Go
+// templates, parsed using ParseHeaderTemplate.
+type HeaderTransform struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// ParseHeaderTemplate parses the value of a header transformation
+func ParseHeaderTemplate(value string) (*template.Template, error) {
+	return template.New("header").Option("missingkey=zero").Parse(value)
+}
+
+func (t *HeaderTransform) validate() error {
+	if t == nil {
+		return nil
+	}
+	for _, values := range []map[string]string{t.Set, t.Add} {
+		for name, value := range values {
+			if name == "" {
+				return errors.New("header name must not be empty")
+			}
+			if _, err := ParseHeaderTemplate(value); err != nil {
+				return fmt.Errorf("header %s value is not a valid template: %s", name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func parseDurationOrDefault(value string, d time.Duration) time.Duration {
+	if value == "" {
+		return d
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return d
+	}
+	return parsed
 }
 
 // Mock represents a mock configuration
@@ -80,14 +312,23 @@ type SSL struct {
 }
 
 type proxyNode struct {
-	Children map[string]*proxyNode
-	Value    *APIProxy
+	Children map[string]*proxyNode `json:"children,omitempty"`
+	Value    *APIProxy             `json:"value,omitempty"`
 }
 
-// ProxyFactory is factory that implements a concurrency safe store for Kanali ApiProxies
+// ProxyObserver is notified with the namespace and name of
+// an APIProxy whenever that APIProxy is changed or removed
+type ProxyObserver func(namespace, name string)
+
+// ProxyFactory is factory that implements a concurrency safe store for Kanali ApiProxies.
+// ApiProxies that declare virtual hosts are stored in a tree per host while all
+// other ApiProxies are stored in the default tree.
 type ProxyFactory struct {
 	mutex     sync.RWMutex
 	proxyTree *proxyNode
+	hostTrees map[string]*proxyNode
+	sslHosts  map[string]map[string]SSL
+	observers []ProxyObserver
 }
 
 // ProxyStore holds all Kanali ApiProxies that Kanali has discovered
@@ -95,7 +336,21 @@ type ProxyFactory struct {
 var ProxyStore *ProxyFactory
 
 func init() {
-	ProxyStore = &ProxyFactory{sync.RWMutex{}, &proxyNode{}}
+	ProxyStore = &ProxyFactory{sync.RWMutex{}, &proxyNode{}, map[string]*proxyNode{}, map[string]map[string]SSL{}, nil}
+}
+
+// Observe registers an observer that will be notified of changes to ApiProxies.
+// Observers are notified while the store is locked and so must not use it.
+func (s *ProxyFactory) Observe(o ProxyObserver) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.observers = append(s.observers, o)
+}
+
+func (s *ProxyFactory) notify(namespace, name string) {
+	for _, o := range s.observers {
+		o(namespace, name)
+	}
 }
 
 // Clear will remove all proxies from the store
@@ -103,6 +358,8 @@ func (s *ProxyFactory) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	*(s.proxyTree) = proxyNode{}
+	s.hostTrees = map[string]*proxyNode{}
+	s.sslHosts = map[string]map[string]SSL{}
 }
 
 // Update will update an APIProxy and preform necessary clean up of old APIProxy is necessary.
@@ -114,24 +371,30 @@ func (s *ProxyFactory) Update(obj interface{}) error {
 		return errors.New("parameter was not of type APIProxy")
 	}
 	normalize(&p)
+	if err := validate(p); err != nil {
+		return err
+	}
 	return s.update(p)
 }
 
 func (s *ProxyFactory) update(p APIProxy) error {
-	untyped := s.get(p.Spec.Path)
-	if untyped != nil {
-		typed, ok := untyped.(APIProxy)
-		if !ok {
-			return errors.New("received interface not of type APIProxy")
-		}
-		if !utils.CompareObjectMeta(p.ObjectMeta, typed.ObjectMeta) {
-			return errors.New("there exists an APIProxy as the targeted path - APIProxy can not be updated - consider using kanalictl to avoid this error in the future")
-		}
+	if s.conflicts(p) {
+		return errors.New("there exists an APIProxy as the targeted path - APIProxy can not be updated - consider using kanalictl to avoid this error in the future")
 	}
 	s.proxyTree.deletePreviousProxy(p)
-	p.Spec.Service.Namespace = p.ObjectMeta.Namespace
+	for host, tree := range s.hostTrees {
+		tree.deletePreviousProxy(p)
+		if len(tree.Children) == 0 {
+			delete(s.hostTrees, host)
+		}
+	}
+	setServiceNamespace(&p)
 	logrus.Debugf("updating APIProxy %s", p.ObjectMeta.Name)
-	s.proxyTree.doSet(strings.Split(p.Spec.Path[1:], "/"), &p)
+	for _, tree := range s.trees(p, true) {
+		tree.doSet(strings.Split(p.Spec.Path[1:], "/"), &p)
+	}
+	s.indexHosts(p)
+	s.notify(p.ObjectMeta.Namespace, p.ObjectMeta.Name)
 	return nil
 }
 
@@ -155,13 +418,57 @@ func (s *ProxyFactory) Set(obj interface{}) error {
 	if !ok {
 		return errors.New("parameter was not of type APIProxy")
 	}
-	p.Spec.Service.Namespace = p.ObjectMeta.Namespace
+	setServiceNamespace(&p)
 	logrus.Debugf("adding APIProxy %s", p.ObjectMeta.Name)
 	normalize(&p)
-	s.proxyTree.doSet(strings.Split(p.Spec.Path[1:], "/"), &p)
+	if err := validate(p); err != nil {
+		return err
+	}
+	if s.conflicts(p) {
+		return errors.New("there exists an APIProxy as the targeted path - APIProxy can not be added - consider using kanalictl to avoid this error in the future")
+	}
+	for _, tree := range s.trees(p, true) {
+		tree.doSet(strings.Split(p.Spec.Path[1:], "/"), &p)
+	}
+	s.indexHosts(p)
+	s.notify(p.ObjectMeta.Namespace, p.ObjectMeta.Name)
 	return nil
 }
 
+// conflicts reports whether another APIProxy is already
+// stored at the host and path of the given APIProxy
+func (s *ProxyFactory) conflicts(p APIProxy) bool {
+	for _, tree := range s.trees(p, false) {
+		if existing := tree.find(strings.Split(p.Spec.Path[1:], "/")); existing != nil {
+			if !utils.CompareObjectMeta(p.ObjectMeta, existing.ObjectMeta) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trees returns the proxy trees that an APIProxy belongs in. If create is
+// true, trees for virtual hosts that have not been seen before are created.
+func (s *ProxyFactory) trees(p APIProxy, create bool) []*proxyNode {
+	if len(p.Spec.VirtualHosts) == 0 {
+		return []*proxyNode{s.proxyTree}
+	}
+	trees := []*proxyNode{}
+	for _, host := range p.Spec.VirtualHosts {
+		tree, ok := s.hostTrees[host]
+		if !ok {
+			if !create {
+				continue
+			}
+			tree = &proxyNode{}
+			s.hostTrees[host] = tree
+		}
+		trees = append(trees, tree)
+	}
+	return trees
+}
+
 func (n *proxyNode) doSet(keys []string, v *APIProxy) {
 	if n.Children == nil {
 		n.Children = map[string]*proxyNode{}
@@ -180,41 +487,186 @@ func (n *proxyNode) doSet(keys []string, v *APIProxy) {
 func (s *ProxyFactory) IsEmpty() bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	return len(s.proxyTree.Children) <= 0
+	return len(s.proxyTree.Children) <= 0 && len(s.hostTrees) <= 0
+}
+
+// MarshalJSON returns the JSON encoding of the default tree
+// and the tree of every virtual host of the store
+func (s *ProxyFactory) MarshalJSON() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return json.Marshal(struct {
+		Default *proxyNode            `json:"default"`
+		Hosts   map[string]*proxyNode `json:"hosts"`
+	}{s.proxyTree, s.hostTrees})
+}
+
+// List returns every proxy in the store, sorted by namespace and name
+func (s *ProxyFactory) List() []APIProxy {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	seen := map[string]bool{}
+	proxies := []APIProxy{}
+	collect := func(p APIProxy) {
+		key := p.ObjectMeta.Namespace + "/" + p.ObjectMeta.Name
+		if !seen[key] {
+			seen[key] = true
+			proxies = append(proxies, p)
+		}
+	}
+	s.proxyTree.walk(collect)
+	for _, tree := range s.hostTrees {
+		tree.walk(collect)
+	}
+	sort.Slice(proxies, func(i, j int) bool {
+		if proxies[i].ObjectMeta.Namespace != proxies[j].ObjectMeta.Namespace {
+			return proxies[i].ObjectMeta.Namespace < proxies[j].ObjectMeta.Namespace
+		}
+		return proxies[i].ObjectMeta.Name < proxies[j].ObjectMeta.Name
+	})
+	return proxies
+}
+
+// Size returns the number of proxies in the store
+func (s *ProxyFactory) Size() int {
+	return len(s.List())
 }
 
 // Get retrieves a particual proxy in the store. If not found, nil is returned.
+// The first parameter is the path of the incoming request. An optional second
+// parameter is the host of the incoming request. ApiProxies with a virtual host
+// matching exactly are preferred, followed by those matching a wildcard virtual
+// host and finally those that do not declare any virtual hosts.
 func (s *ProxyFactory) Get(params ...interface{}) (interface{}, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	if len(params) != 1 {
-		return nil, errors.New("should only pass the path of the proxy")
+	if len(params) != 1 && len(params) != 2 {
+		return nil, errors.New("should only pass the path and optionally the host of the proxy")
 	}
 	path, ok := params[0].(string)
 	if !ok {
 		return nil, errors.New("when retrieving a proxy, use the proxy path")
 	}
-	return s.get(path), nil
+	host := ""
+	if len(params) == 2 {
+		if host, ok = params[1].(string); !ok {
+			return nil, errors.New("when retrieving a proxy, the host must be a string")
+		}
+	}
+	return s.get(path, host), nil
 }
 
-func (s *ProxyFactory) get(path string) interface{} {
-	if len(s.proxyTree.Children) == 0 || path == "" {
+func (s *ProxyFactory) get(path, host string) interface{} {
+	if path == "" {
 		return nil
 	}
 	if path[0] == '/' {
 		path = path[1:]
 	}
-	rootNode := s.proxyTree
-	for i, part := range strings.Split(path, "/") {
-		if rootNode.Children[part] == nil || (rootNode.Children[part].Value == nil && i == len(strings.Split(path, "/"))-1) {
-			break
+	segments := strings.Split(path, "/")
+	for _, candidate := range hostCandidates(host) {
+		tree, ok := s.hostTrees[candidate]
+		if !ok {
+			continue
+		}
+		if result := tree.match(segments); result != nil {
+			return withPathParams(*result, path)
+		}
+	}
+	if result := s.proxyTree.match(segments); result != nil {
+		return withPathParams(*result, path)
+	}
+	return nil
+}
+
+func withPathParams(p APIProxy, path string) APIProxy {
+	if params := utils.ExtractPathParams(p.Spec.Path, path); len(params) > 0 {
+		p.PathParams = params
+	}
+	return p
+}
+
+// hostCandidates lists, in order of precedence, the virtual hosts that
+// could match the given host. For a.b.example.com these are a.b.example.com,
+// *.b.example.com, *.example.com and *.com
+func hostCandidates(host string) []string {
+	host = normalizeHost(host)
+	if host == "" {
+		return nil
+	}
+	candidates := []string{host}
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels); i++ {
+		candidates = append(candidates, "*."+strings.Join(labels[i:], "."))
+	}
+	return candidates
+}
+
+// match finds the most specific APIProxy whose path is a prefix of the given
+// path segments. Literal segments take precedence over named parameters,
+// which in turn take precedence over a wildcard. A literal segment is
+// followed without backtracking, so a path that leads into a node without
+// an APIProxy matches nothing rather than an ancestor of that node.
+func (n *proxyNode) match(segments []string) *APIProxy {
+	if len(segments) > 0 {
+		if child, ok := n.Children[segments[0]]; ok && !isTemplateSegment(segments[0]) {
+			if len(segments) > 1 {
+				return child.match(segments[1:])
+			}
+			// the last segment only leads to a node that has an APIProxy
+			if result := child.match(nil); result != nil {
+				return result
+			}
+		}
+		for _, key := range n.paramKeys() {
+			if result := n.Children[key].match(segments[1:]); result != nil {
+				return result
+			}
 		}
-		rootNode = rootNode.Children[part]
 	}
-	if rootNode.Value == nil {
+	if child, ok := n.Children[utils.PathWildcard]; ok && child.Value != nil {
+		return child.Value
+	}
+	return n.Value
+}
+
+// find returns the APIProxy stored at exactly the given path segments
+func (n *proxyNode) find(segments []string) *APIProxy {
+	if len(segments) == 0 {
+		return n.Value
+	}
+	child, ok := n.Children[segments[0]]
+	if !ok {
 		return nil
 	}
-	return *rootNode.Value
+	return child.find(segments[1:])
+}
+
+// walk calls f with every APIProxy stored in the tree rooted at this node
+func (n *proxyNode) walk(f func(APIProxy)) {
+	if n.Value != nil {
+		f(*n.Value)
+	}
+	for _, child := range n.Children {
+		child.walk(f)
+	}
+}
+
+// paramKeys returns the named parameter children of a node in a
+// deterministic order
+func (n *proxyNode) paramKeys() []string {
+	keys := []string{}
+	for k := range n.Children {
+		if utils.IsPathParam(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isTemplateSegment(segment string) bool {
+	return segment == utils.PathWildcard || utils.IsPathParam(segment)
 }
 
 // Delete will remove a particular proxy from the store
@@ -229,19 +681,90 @@ func (s *ProxyFactory) Delete(obj interface{}) (interface{}, error) {
 		return nil, errors.New("there's no way this api proxy could've gotten in here")
 	}
 	normalize(&p)
-	result := s.proxyTree.delete(strings.Split(p.Spec.Path[1:], "/"))
+	var result *APIProxy
+	for _, tree := range s.trees(p, false) {
+		if deleted := tree.delete(strings.Split(p.Spec.Path[1:], "/")); deleted != nil {
+			result = deleted
+		}
+	}
+	for _, host := range p.Spec.VirtualHosts {
+		if tree, ok := s.hostTrees[host]; ok && len(tree.Children) == 0 {
+			delete(s.hostTrees, host)
+		}
+	}
+	s.unindexHosts(p)
+	s.notify(p.ObjectMeta.Namespace, p.ObjectMeta.Name)
 	if result == nil {
 		return nil, nil
 	}
 	return *result, nil
 }
 
+// indexHosts records the SSL object of every host of an APIProxy that names
+// a secret, replacing those recorded for a previous version of the APIProxy
+func (s *ProxyFactory) indexHosts(p APIProxy) {
+	s.unindexHosts(p)
+	if s.sslHosts == nil {
+		s.sslHosts = map[string]map[string]SSL{}
+	}
+	key := p.ObjectMeta.Namespace + "/" + p.ObjectMeta.Name
+	for _, h := range p.Spec.Hosts {
+		if h.SSL.SecretName == "" {
+			continue
+		}
+		host := normalizeHost(h.Name)
+		if s.sslHosts[host] == nil {
+			s.sslHosts[host] = map[string]SSL{}
+		}
+		s.sslHosts[host][key] = h.SSL
+	}
+}
+
+// unindexHosts removes the SSL objects recorded for the hosts of an APIProxy
+func (s *ProxyFactory) unindexHosts(p APIProxy) {
+	key := p.ObjectMeta.Namespace + "/" + p.ObjectMeta.Name
+	for host, proxies := range s.sslHosts {
+		delete(proxies, key)
+		if len(proxies) == 0 {
+			delete(s.sslHosts, host)
+		}
+	}
+}
+
+// HostSSL finds the SSL object of the APIProxy host matching the given server
+// name, returning the namespace of its APIProxy along with it. A host matching
+// exactly is preferred over one matching a wildcard. If no APIProxy declares a
+// secret for the server name, nil is returned.
+func (s *ProxyFactory) HostSSL(serverName string) (string, *SSL) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, candidate := range hostCandidates(serverName) {
+		proxies, ok := s.sslHosts[candidate]
+		if !ok {
+			continue
+		}
+		// when several ApiProxies declare the same host, the
+		// first one by namespace and name is used consistently
+		keys := make([]string, 0, len(proxies))
+		for key := range proxies {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		ssl := proxies[keys[0]]
+		return strings.SplitN(keys[0], "/", 2)[0], &ssl
+	}
+	return "", nil
+}
+
 func (n *proxyNode) delete(segments []string) *APIProxy {
 	if len(segments) == 0 {
 		tmp := n.Value
 		n.Value = nil
 		return tmp
 	}
+	if n.Children[segments[0]] == nil {
+		return nil
+	}
 	result := n.Children[segments[0]].delete(segments[1:])
 	if len(n.Children[segments[0]].Children) == 0 && n.Children[segments[0]].Value == nil {
 		delete(n.Children, segments[0])
@@ -259,6 +782,29 @@ func (p APIProxy) GetSSLCertificates(host string) *SSL {
 	return &p.Spec.SSL
 }
 
+// alwaysTLS reports whether the upstream service is reached over TLS
+// whatever the host of a request, see GetSSLCertificates
+func (p APIProxy) alwaysTLS() bool {
+	if p.Spec.SSL != (SSL{}) {
+		return true
+	}
+	for _, h := range p.Spec.Hosts {
+		if h.SSL == (SSL{}) {
+			return false
+		}
+	}
+	return len(p.Spec.Hosts) > 0
+}
+
+// GetProtocol retrieves the protocol used to proxy requests to the
+// upstream service, defaulting to HTTP/1.1
+func (p APIProxy) GetProtocol() string {
+	if p.Spec.Protocol == "" {
+		return ProtocolHTTP1
+	}
+	return p.Spec.Protocol
+}
+
 // GetFileName gets the file name for a plugin.
 // This is dynamic base on the plugin version used.
 func (p Plugin) GetFileName() string {
@@ -271,7 +817,145 @@ func (p Plugin) GetFileName() string {
 	return p.Name
 }
 
+// validate ensures that the path of an APIProxy is a well formed template and
+// that every parameter referenced by its target is captured by its path
+func validate(p APIProxy) error {
+	if err := utils.ValidatePathTemplate(p.Spec.Path); err != nil {
+		return err
+	}
+	params := map[string]bool{}
+	for _, segment := range strings.Split(p.Spec.Path, "/") {
+		if utils.IsPathParam(segment) {
+			params[segment] = true
+		} else if segment == utils.PathWildcard {
+			params["{"+utils.PathWildcard+"}"] = true
+		}
+	}
+	for _, segment := range strings.Split(p.Spec.Target, "/") {
+		if utils.IsPathParam(segment) && !params[segment] {
+			return fmt.Errorf("target %s references %s which is not captured by path %s", p.Spec.Target, segment, p.Spec.Path)
+		}
+	}
+	for _, backend := range p.Spec.Backends {
+		if backend.Weight < 0 {
+			return fmt.Errorf("backend %s has a negative weight", backend.Service.Name)
+		}
+	}
+	if p.Spec.Mirror != nil && (p.Spec.Mirror.Percent < 0 || p.Spec.Mirror.Percent > 100) {
+		return fmt.Errorf("mirror percent %d is not between 0 and 100", p.Spec.Mirror.Percent)
+	}
+	if p.Spec.Retry != nil {
+		if p.Spec.Retry.MaxAttempts < 0 {
+			return fmt.Errorf("retry max attempts %d must not be negative", p.Spec.Retry.MaxAttempts)
+		}
+		for _, d := range []string{p.Spec.Retry.Backoff, p.Spec.Retry.MaxBackoff, p.Spec.Retry.Budget} {
+			if _, err := time.ParseDuration(d); d != "" && err != nil {
+				return fmt.Errorf("retry duration %s is not valid", d)
+			}
+		}
+	}
+	if p.Spec.CircuitBreaker != nil {
+		if p.Spec.CircuitBreaker.FailureThreshold < 0 {
+			return fmt.Errorf("circuit breaker failure threshold %d must not be negative", p.Spec.CircuitBreaker.FailureThreshold)
+		}
+		if d := p.Spec.CircuitBreaker.OpenDuration; d != "" {
+			if _, err := time.ParseDuration(d); err != nil {
+				return fmt.Errorf("circuit breaker duration %s is not valid", d)
+			}
+		}
+	}
+	switch p.GetProtocol() {
+	case ProtocolH2:
+		if !p.alwaysTLS() {
+			return fmt.Errorf("protocol %s requires ssl to be configured - use %s for HTTP/2 over cleartext", ProtocolH2, ProtocolH2C)
+		}
+	case ProtocolHTTP1, ProtocolH2C, ProtocolGRPC:
+	default:
+		return fmt.Errorf("protocol %s is not supported", p.Spec.Protocol)
+	}
+	if p.Spec.LoadBalancer != nil {
+		switch p.Spec.LoadBalancer.Algorithm {
+		case LoadBalancerRoundRobin, LoadBalancerLeastOutstanding, LoadBalancerConsistentHash:
+		default:
+			return fmt.Errorf("load balancer algorithm %s is not supported", p.Spec.LoadBalancer.Algorithm)
+		}
+	}
+	if h := p.Spec.HealthCheck; h != nil {
+		if h.ConsecutiveFailures < 0 {
+			return fmt.Errorf("health check consecutive failures %d must not be negative", h.ConsecutiveFailures)
+		}
+		durations := []string{h.EjectionDuration}
+		if h.Active != nil {
+			if !strings.HasPrefix(h.Active.Path, "/") {
+				return fmt.Errorf("health check path %s must start with a /", h.Active.Path)
+			}
+			durations = append(durations, h.Active.Interval, h.Active.Timeout)
+		}
+		for _, d := range durations {
+			if _, err := time.ParseDuration(d); d != "" && err != nil {
+				return fmt.Errorf("health check duration %s is not valid", d)
+			}
+		}
+	}
+	if l := p.Spec.Limits; l != nil {
+		if l.MaxRequestBodyBytes < 0 || l.MaxHeaderBytes < 0 {
+			return fmt.Errorf("limits must not be negative")
+		}
+		for _, d := range []string{l.ConnectTimeout, l.ResponseHeaderTimeout, l.Timeout} {
+			if _, err := time.ParseDuration(d); d != "" && err != nil {
+				return fmt.Errorf("limit duration %s is not valid", d)
+			}
+		}
+	}
+	if err := p.Spec.RequestHeaders.validate(); err != nil {
+		return err
+	}
+	if err := p.Spec.ResponseHeaders.validate(); err != nil {
+		return err
+	}
+	for _, host := range p.Spec.VirtualHosts {
+		if host == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("virtual host %s is not valid - a wildcard is only allowed as the leftmost label", host)
+		}
+	}
+	return nil
+}
+
 func normalize(p *APIProxy) {
 	(*p).Spec.Path = utils.NormalizeURLPath(p.Spec.Path)
 	(*p).Spec.Target = utils.NormalizeURLPath(p.Spec.Target)
+	if len(p.Spec.VirtualHosts) > 0 {
+		hosts := make([]string, len(p.Spec.VirtualHosts))
+		for i, host := range p.Spec.VirtualHosts {
+			hosts[i] = normalizeHost(host)
+		}
+		(*p).Spec.VirtualHosts = hosts
+	}
+}
+
+// setServiceNamespace forces every service of an APIProxy into the
+// namespace of the APIProxy to comply with Kubernetes conventions
+func setServiceNamespace(p *APIProxy) {
+	(*p).Spec.Service.Namespace = p.ObjectMeta.Namespace
+	if len(p.Spec.Backends) > 0 {
+		backends := make([]Backend, len(p.Spec.Backends))
+		for i, backend := range p.Spec.Backends {
+			backend.Service.Namespace = p.ObjectMeta.Namespace
+			backends[i] = backend
+		}
+		(*p).Spec.Backends = backends
+	}
+	if p.Spec.Mirror != nil {
+		mirror := *p.Spec.Mirror
+		mirror.Service.Namespace = p.ObjectMeta.Namespace
+		(*p).Spec.Mirror = &mirror
+	}
+}
+
+// normalizeHost lowercases a host and strips any port
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
 }
@@ -21,7 +21,9 @@
 package spec
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/kubernetes/pkg/api"
@@ -57,6 +59,16 @@ func TestAPIProxySet(t *testing.T) {
 	assert.Equal(proxyList.Proxies[0], *store.proxyTree.Children["api"].Children["v1"].Children["accounts"].Value, "proxy should exist")
 	assert.Equal(proxyList.Proxies[1], *store.proxyTree.Children["api"].Children["v1"].Children["field"].Value, "proxy should exist")
 	assert.Equal(proxyList.Proxies[2], *store.proxyTree.Children["api"].Value, "proxy should exist")
+
+	// another APIProxy may not take over the path of an existing one
+	proxy := proxyList.Proxies[0]
+	proxy.ObjectMeta = api.ObjectMeta{
+		Name:      "frank",
+		Namespace: "greco",
+	}
+	assert.Equal(store.Set(proxy).Error(), "there exists an APIProxy as the targeted path - APIProxy can not be added - consider using kanalictl to avoid this error in the future")
+	assert.Equal(proxyList.Proxies[0], *store.proxyTree.Children["api"].Children["v1"].Children["accounts"].Value, "proxy should not be replaced")
+	assert.Nil(store.Set(proxyList.Proxies[0]))
 }
 
 func TestAPIProxyUpdate(t *testing.T) {
@@ -162,8 +174,8 @@ func TestAPIProxyGet(t *testing.T) {
 	store.Set(proxyList.Proxies[0])
 	store.Set(proxyList.Proxies[1])
 	store.Set(proxyList.Proxies[2])
-	_, err := store.Get("", "")
-	assert.Equal(err.Error(), "should only pass the path of the proxy", "wrong error")
+	_, err := store.Get("", "", "")
+	assert.Equal(err.Error(), "should only pass the path and optionally the host of the proxy", "wrong error")
 	_, err = store.Get(5)
 	assert.Equal(err.Error(), "when retrieving a proxy, use the proxy path", "wrong error")
 	result, _ := store.Get("")
@@ -190,6 +202,492 @@ func TestAPIProxyGet(t *testing.T) {
 	assert.Equal(proxyList.Proxies[2], result, "proxy should be returned")
 }
 
+func TestAPIProxyGetPathParams(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	literal := APIProxy{ObjectMeta: api.ObjectMeta{Name: "literal", Namespace: "foo"}, Spec: APIProxySpec{Path: "/accounts/me/orders"}}
+	param := APIProxy{ObjectMeta: api.ObjectMeta{Name: "param", Namespace: "foo"}, Spec: APIProxySpec{Path: "/accounts/{id}/orders", Target: "/v2/customers/{id}/orders"}}
+	nested := APIProxy{ObjectMeta: api.ObjectMeta{Name: "nested", Namespace: "foo"}, Spec: APIProxySpec{Path: "/accounts/{id}/orders/{order}"}}
+	wildcard := APIProxy{ObjectMeta: api.ObjectMeta{Name: "wildcard", Namespace: "foo"}, Spec: APIProxySpec{Path: "/files/*"}}
+
+	store.Clear()
+	assert.Nil(store.Set(literal))
+	assert.Nil(store.Set(param))
+	assert.Nil(store.Set(nested))
+	assert.Nil(store.Set(wildcard))
+
+	result, _ := store.Get("/accounts/me/orders")
+	assert.Equal("literal", result.(APIProxy).ObjectMeta.Name)
+	assert.Nil(result.(APIProxy).PathParams)
+
+	result, _ = store.Get("/accounts/me/orders/456")
+	assert.Equal("literal", result.(APIProxy).ObjectMeta.Name)
+
+	result, _ = store.Get("/accounts/123/orders")
+	assert.Equal("param", result.(APIProxy).ObjectMeta.Name)
+	assert.Equal(map[string]string{"id": "123"}, result.(APIProxy).PathParams)
+
+	result, _ = store.Get("/accounts/123/orders/456")
+	assert.Equal("nested", result.(APIProxy).ObjectMeta.Name)
+	assert.Equal(map[string]string{"id": "123", "order": "456"}, result.(APIProxy).PathParams)
+
+	result, _ = store.Get("/accounts/123/invoices")
+	assert.Nil(result)
+
+	result, _ = store.Get("/files/css/main.css")
+	assert.Equal("wildcard", result.(APIProxy).ObjectMeta.Name)
+	assert.Equal(map[string]string{"*": "css/main.css"}, result.(APIProxy).PathParams)
+
+	result, _ = store.Get("/files")
+	assert.Equal("wildcard", result.(APIProxy).ObjectMeta.Name)
+	assert.Equal(map[string]string{"*": ""}, result.(APIProxy).PathParams)
+}
+
+func TestAPIProxyGetIntermediatePath(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	parent := APIProxy{ObjectMeta: api.ObjectMeta{Name: "parent", Namespace: "foo"}, Spec: APIProxySpec{Path: "/a"}}
+	child := APIProxy{ObjectMeta: api.ObjectMeta{Name: "child", Namespace: "foo"}, Spec: APIProxySpec{Path: "/a/b/d"}}
+
+	store.Clear()
+	assert.Nil(store.Set(parent))
+	assert.Nil(store.Set(child))
+
+	result, _ := store.Get("/a/x/y")
+	assert.Equal("parent", result.(APIProxy).ObjectMeta.Name)
+	result, _ = store.Get("/a/b")
+	assert.Equal("parent", result.(APIProxy).ObjectMeta.Name)
+	result, _ = store.Get("/a/b/d/e")
+	assert.Equal("child", result.(APIProxy).ObjectMeta.Name)
+
+	// a path leading into /a/b does not fall back to /a
+	result, _ = store.Get("/a/b/c")
+	assert.Nil(result)
+}
+
+func TestAPIProxySetInvalidPath(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	store.Clear()
+	err := store.Set(APIProxy{Spec: APIProxySpec{Path: "/foo/*/bar"}})
+	assert.Equal("wildcard in path /foo/*/bar must be the last segment", err.Error())
+	err = store.Update(APIProxy{Spec: APIProxySpec{Path: "/foo/{id}", Target: "/bar/{name}"}})
+	assert.Equal("target /bar/{name} references {name} which is not captured by path /foo/{id}", err.Error())
+	assert.Nil(store.Set(APIProxy{Spec: APIProxySpec{Path: "/foo/*", Target: "/bar/{*}"}}))
+	assert.False(store.IsEmpty())
+}
+
+func TestAPIProxyUpdateSubpath(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	proxyList := getTestAPIProxyList()
+	defer store.Clear()
+
+	store.Clear()
+	store.Set(proxyList.Proxies[2])
+	proxy := proxyList.Proxies[0]
+	proxy.Spec.Path = "/api/v2"
+	assert.Nil(store.Update(proxy))
+	result, _ := store.Get("/api/v2/foo")
+	assert.Equal(proxy, result)
+}
+
+func TestAPIProxyVirtualHosts(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	teamOne := APIProxy{ObjectMeta: api.ObjectMeta{Name: "team-one", Namespace: "foo"}, Spec: APIProxySpec{Path: "/v1", VirtualHosts: []string{"One.Example.com"}}}
+	teamTwo := APIProxy{ObjectMeta: api.ObjectMeta{Name: "team-two", Namespace: "bar"}, Spec: APIProxySpec{Path: "/v1", VirtualHosts: []string{"*.example.com"}}}
+	fallback := APIProxy{ObjectMeta: api.ObjectMeta{Name: "fallback", Namespace: "car"}, Spec: APIProxySpec{Path: "/"}}
+
+	store.Clear()
+	assert.Nil(store.Set(teamOne))
+	assert.Nil(store.Set(teamTwo))
+	assert.Nil(store.Set(fallback))
+	assert.Equal(2, len(store.hostTrees))
+
+	result, _ := store.Get("/v1/accounts", "one.example.com:8443")
+	assert.Equal("team-one", result.(APIProxy).ObjectMeta.Name)
+	result, _ = store.Get("/v1/accounts", "two.example.com")
+	assert.Equal("team-two", result.(APIProxy).ObjectMeta.Name)
+	result, _ = store.Get("/v1/accounts", "a.b.example.com")
+	assert.Equal("team-two", result.(APIProxy).ObjectMeta.Name)
+	result, _ = store.Get("/v1/accounts", "example.com")
+	assert.Nil(result)
+	result, _ = store.Get("/", "one.example.com")
+	assert.Equal("fallback", result.(APIProxy).ObjectMeta.Name)
+	result, _ = store.Get("/v1/accounts")
+	assert.Nil(result)
+
+	conflict := APIProxy{ObjectMeta: api.ObjectMeta{Name: "conflict", Namespace: "foo"}, Spec: APIProxySpec{Path: "/v1", VirtualHosts: []string{"one.example.com"}}}
+	assert.Equal("there exists an APIProxy as the targeted path - APIProxy can not be updated - consider using kanalictl to avoid this error in the future", store.Update(conflict).Error())
+	conflict.Spec.VirtualHosts = []string{"three.example.com"}
+	assert.Nil(store.Update(conflict))
+	result, _ = store.Get("/v1", "three.example.com")
+	assert.Equal("conflict", result.(APIProxy).ObjectMeta.Name)
+
+	result, _ = store.Delete(teamTwo)
+	assert.Equal("team-two", result.(APIProxy).ObjectMeta.Name)
+	assert.Equal(2, len(store.hostTrees))
+	result, _ = store.Get("/v1/accounts", "two.example.com")
+	assert.Nil(result)
+
+	err := store.Set(APIProxy{Spec: APIProxySpec{Path: "/v1", VirtualHosts: []string{"foo.*.com"}}})
+	assert.Equal("virtual host foo.*.com is not valid - a wildcard is only allowed as the leftmost label", err.Error())
+}
+
+func TestAPIProxyBackends(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "weighted", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path: "/weighted",
+			Backends: []Backend{
+				{Service: Service{Name: "stable", Namespace: "bar"}, Weight: 90},
+				{Service: Service{Name: "canary"}, Weight: 10},
+			},
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	result, _ := store.Get("/weighted")
+	assert.Equal("foo", result.(APIProxy).Spec.Backends[0].Service.Namespace)
+	assert.Equal("foo", result.(APIProxy).Spec.Backends[1].Service.Namespace)
+	assert.Equal("bar", proxy.Spec.Backends[0].Service.Namespace)
+
+	proxy.Spec.Backends[1].Weight = -1
+	assert.Equal("backend canary has a negative weight", store.Update(proxy).Error())
+}
+
+func TestAPIProxyMirror(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "mirrored", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:    "/mirrored",
+			Service: Service{Name: "primary"},
+			Mirror: &Mirror{
+				Service: Service{Name: "shadow", Namespace: "bar"},
+				Percent: 25,
+			},
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	result, _ := store.Get("/mirrored")
+	assert.Equal("foo", result.(APIProxy).Spec.Mirror.Service.Namespace)
+	assert.Equal("bar", proxy.Spec.Mirror.Service.Namespace)
+
+	proxy.Spec.Mirror.Percent = 101
+	assert.Equal("mirror percent 101 is not between 0 and 100", store.Update(proxy).Error())
+	proxy.Spec.Mirror.Percent = -1
+	assert.Equal("mirror percent -1 is not between 0 and 100", store.Set(proxy).Error())
+}
+
+func TestAPIProxyRetry(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	retry := Retry{}
+	assert.True(retry.IsRetryableStatus(503))
+	assert.False(retry.IsRetryableStatus(500))
+	assert.True(retry.IsRetryableMethod("get"))
+	assert.False(retry.IsRetryableMethod("POST"))
+	assert.Equal(100*time.Millisecond, retry.GetBackoff())
+	assert.Equal(time.Second, retry.GetMaxBackoff())
+	assert.Equal(time.Duration(0), retry.GetBudget())
+
+	retry = Retry{
+		MaxAttempts: 3,
+		StatusCodes: []int{500},
+		Methods:     []string{"POST"},
+		Backoff:     "10ms",
+		MaxBackoff:  "50ms",
+		Budget:      "2s",
+	}
+	assert.True(retry.IsRetryableStatus(500))
+	assert.False(retry.IsRetryableStatus(503))
+	assert.True(retry.IsRetryableMethod("POST"))
+	assert.False(retry.IsRetryableMethod("GET"))
+	assert.Equal(10*time.Millisecond, retry.GetBackoff())
+	assert.Equal(50*time.Millisecond, retry.GetMaxBackoff())
+	assert.Equal(2*time.Second, retry.GetBudget())
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "retried", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:    "/retried",
+			Service: Service{Name: "primary"},
+			Retry:   &retry,
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	retry.Budget = "forever"
+	assert.Equal("retry duration forever is not valid", store.Update(proxy).Error())
+	retry.Budget = ""
+	retry.MaxAttempts = -1
+	assert.Equal("retry max attempts -1 must not be negative", store.Update(proxy).Error())
+}
+
+func TestAPIProxyLimits(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	var unset *Limits
+	assert.Equal(time.Second, unset.GetConnectTimeout(time.Second))
+	assert.Equal(time.Second, unset.GetResponseHeaderTimeout(time.Second))
+	assert.Equal(time.Second, unset.GetTimeout(time.Second))
+	assert.Equal(int64(10), unset.GetMaxRequestBodyBytes(10))
+	assert.Equal(10, unset.GetMaxHeaderBytes(10))
+
+	limits := &Limits{Timeout: "2m"}
+	assert.Equal(time.Second, limits.GetConnectTimeout(time.Second))
+	assert.Equal(2*time.Minute, limits.GetTimeout(time.Second))
+	assert.Equal(int64(10), limits.GetMaxRequestBodyBytes(10))
+
+	limits = &Limits{
+		ConnectTimeout:        "1s",
+		ResponseHeaderTimeout: "5s",
+		MaxRequestBodyBytes:   1024,
+		MaxHeaderBytes:        512,
+	}
+	assert.Equal(time.Second, limits.GetConnectTimeout(time.Minute))
+	assert.Equal(5*time.Second, limits.GetResponseHeaderTimeout(time.Minute))
+	assert.Equal(int64(1024), limits.GetMaxRequestBodyBytes(10))
+	assert.Equal(512, limits.GetMaxHeaderBytes(10))
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "limited", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:    "/limited",
+			Service: Service{Name: "primary"},
+			Limits:  limits,
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	limits.Timeout = "later"
+	assert.Equal("limit duration later is not valid", store.Update(proxy).Error())
+	limits.Timeout = ""
+	limits.MaxHeaderBytes = -1
+	assert.Equal("limits must not be negative", store.Update(proxy).Error())
+}
+
+func TestAPIProxyHeaderTransform(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "transformed", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:    "/transformed",
+			Service: Service{Name: "primary"},
+			RequestHeaders: &HeaderTransform{
+				Set:    map[string]string{"X-Client-IP": "{{.ClientIP}}"},
+				Remove: []string{"X-Debug"},
+			},
+			ResponseHeaders: &HeaderTransform{
+				Add: map[string]string{"X-Served-By": "kanali"},
+			},
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	proxy.Spec.ResponseHeaders.Add["X-Broken"] = "{{.ClientIP"
+	assert.Contains(store.Update(proxy).Error(), "header X-Broken value is not a valid template")
+	delete(proxy.Spec.ResponseHeaders.Add, "X-Broken")
+	proxy.Spec.RequestHeaders.Set[""] = "value"
+	assert.Equal("header name must not be empty", store.Update(proxy).Error())
+}
+
+func TestAPIProxyCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "guarded", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:           "/guarded",
+			Service:        Service{Name: "primary"},
+			CircuitBreaker: &CircuitBreaker{FailureThreshold: 5, OpenDuration: "10s"},
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	proxy.Spec.CircuitBreaker.OpenDuration = "soon"
+	assert.Equal("circuit breaker duration soon is not valid", store.Update(proxy).Error())
+	proxy.Spec.CircuitBreaker.OpenDuration = ""
+	proxy.Spec.CircuitBreaker.FailureThreshold = -1
+	assert.Equal("circuit breaker failure threshold -1 must not be negative", store.Update(proxy).Error())
+}
+
+func TestAPIProxyLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "balanced", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:         "/balanced",
+			Service:      Service{Name: "primary"},
+			LoadBalancer: &LoadBalancer{Algorithm: LoadBalancerConsistentHash, Header: "X-User"},
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	proxy.Spec.LoadBalancer.Algorithm = "random"
+	assert.Equal("load balancer algorithm random is not supported", store.Update(proxy).Error())
+}
+
+func TestAPIProxyProtocol(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "grpc", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:    "/grpc",
+			Service: Service{Name: "primary"},
+		},
+	}
+	assert.Equal(ProtocolHTTP1, proxy.GetProtocol())
+	proxy.Spec.Protocol = ProtocolGRPC
+	assert.Equal(ProtocolGRPC, proxy.GetProtocol())
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	proxy.Spec.Protocol = "spdy"
+	assert.Equal("protocol spdy is not supported", store.Update(proxy).Error())
+
+	// HTTP/2 is only negotiated over TLS
+	proxy.Spec.Protocol = ProtocolH2
+	assert.Equal("protocol h2 requires ssl to be configured - use h2c for HTTP/2 over cleartext", store.Update(proxy).Error())
+	proxy.Spec.Hosts = []Host{{Name: "foo.bar.com", SSL: SSL{SecretName: "mysecretname"}}, {Name: "bar.foo.com"}}
+	assert.NotNil(store.Update(proxy))
+	proxy.Spec.Hosts = proxy.Spec.Hosts[:1]
+	assert.Nil(store.Update(proxy))
+	proxy.Spec.Hosts = nil
+	proxy.Spec.SSL = SSL{SecretName: "mysecretname"}
+	assert.Nil(store.Update(proxy))
+}
+
+func TestAPIProxyHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	proxy := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "checked", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path:    "/checked",
+			Service: Service{Name: "primary"},
+			HealthCheck: &HealthCheck{
+				ConsecutiveFailures: 5,
+				Active:              &ActiveHealthCheck{Path: "/health", Interval: "5s"},
+			},
+		},
+	}
+
+	store.Clear()
+	assert.Nil(store.Set(proxy))
+	proxy.Spec.HealthCheck.Active.Interval = "often"
+	assert.Equal("health check duration often is not valid", store.Update(proxy).Error())
+	proxy.Spec.HealthCheck.Active.Path = "health"
+	assert.Equal("health check path health must start with a /", store.Update(proxy).Error())
+	proxy.Spec.HealthCheck.ConsecutiveFailures = -1
+	assert.Equal("health check consecutive failures -1 must not be negative", store.Update(proxy).Error())
+}
+
+func TestAPIProxyList(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	store.Clear()
+	assert.Equal(0, len(store.List()))
+
+	store.Set(APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "two", Namespace: "foo"},
+		Spec:       APIProxySpec{Path: "/two", VirtualHosts: []string{"a.example.com", "b.example.com"}},
+	})
+	store.Set(APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "one", Namespace: "foo"},
+		Spec:       APIProxySpec{Path: "/one/two"},
+	})
+	store.Set(APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "three", Namespace: "bar"},
+		Spec:       APIProxySpec{Path: "/one"},
+	})
+
+	proxies := store.List()
+	assert.Equal(3, len(proxies))
+	assert.Equal(3, store.Size())
+	assert.Equal("three", proxies[0].ObjectMeta.Name)
+	assert.Equal("one", proxies[1].ObjectMeta.Name)
+	assert.Equal("two", proxies[2].ObjectMeta.Name)
+}
+
+func TestAPIProxyMarshalJSON(t *testing.T) {
+	assert := assert.New(t)
+	store := ProxyStore
+	defer store.Clear()
+
+	store.Clear()
+	store.Set(APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "one", Namespace: "foo"},
+		Spec:       APIProxySpec{Path: "/one"},
+	})
+	store.Set(APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "two", Namespace: "foo"},
+		Spec:       APIProxySpec{Path: "/two", VirtualHosts: []string{"a.example.com"}},
+	})
+
+	raw, err := json.Marshal(store)
+	assert.Nil(err)
+
+	var dump struct {
+		Default proxyNode            `json:"default"`
+		Hosts   map[string]proxyNode `json:"hosts"`
+	}
+	assert.Nil(json.Unmarshal(raw, &dump))
+	assert.Equal("one", dump.Default.Children["one"].Value.ObjectMeta.Name)
+	assert.Nil(dump.Default.Children["two"])
+	assert.Equal("two", dump.Hosts["a.example.com"].Children["two"].Value.ObjectMeta.Name)
+}
+
+func TestHostCandidates(t *testing.T) {
+	assert.Nil(t, hostCandidates(""))
+	assert.Equal(t, []string{"localhost"}, hostCandidates("localhost:8080"))
+	assert.Equal(t, []string{"a.b.example.com", "*.b.example.com", "*.example.com", "*.com"}, hostCandidates("A.B.Example.com"))
+}
+
 func TestAPIProxyDelete(t *testing.T) {
 	assert := assert.New(t)
 	store := ProxyStore
@@ -272,6 +770,56 @@ func TestGetSSLCertificates(t *testing.T) {
 	assert.Equal(SSL{"mySecret"}, *result.GetSSLCertificates("bar.foo.com"), message)
 }
 
+func TestAPIProxyHostSSL(t *testing.T) {
+	store := ProxyStore
+	defer store.Clear()
+	store.Clear()
+
+	exact := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "exact", Namespace: "foo"},
+		Spec: APIProxySpec{
+			Path: "/exact",
+			Hosts: []Host{
+				{Name: "API.bar.com", SSL: SSL{SecretName: "exactSecret"}},
+				{Name: "plain.bar.com"},
+			},
+		},
+	}
+	wildcard := APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "wildcard", Namespace: "bar"},
+		Spec: APIProxySpec{
+			Path:  "/wildcard",
+			Hosts: []Host{{Name: "*.bar.com", SSL: SSL{SecretName: "wildcardSecret"}}},
+		},
+	}
+	assert.Nil(t, store.Set(exact))
+	assert.Nil(t, store.Set(wildcard))
+
+	namespace, ssl := store.HostSSL("api.bar.com")
+	assert.Equal(t, "foo", namespace)
+	assert.Equal(t, SSL{"exactSecret"}, *ssl)
+	namespace, ssl = store.HostSSL("other.bar.com")
+	assert.Equal(t, "bar", namespace)
+	assert.Equal(t, SSL{"wildcardSecret"}, *ssl)
+	namespace, ssl = store.HostSSL("plain.bar.com")
+	assert.Equal(t, SSL{"wildcardSecret"}, *ssl)
+	_, ssl = store.HostSSL("bar.com")
+	assert.Nil(t, ssl)
+
+	// the index follows updates and deletions
+	exact.Spec.Hosts = []Host{{Name: "api.bar.com", SSL: SSL{SecretName: "newSecret"}}}
+	assert.Nil(t, store.Update(exact))
+	_, ssl = store.HostSSL("api.bar.com")
+	assert.Equal(t, SSL{"newSecret"}, *ssl)
+	store.Delete(exact)
+	_, ssl = store.HostSSL("api.bar.com")
+	assert.Equal(t, SSL{"wildcardSecret"}, *ssl)
+	store.Delete(wildcard)
+	_, ssl = store.HostSSL("api.bar.com")
+	assert.Nil(t, ssl)
+	assert.Equal(t, 0, len(store.sslHosts))
+}
+
 func TestNormalize(t *testing.T) {
 	p1 := APIProxy{
 		Spec: APIProxySpec{
@@ -0,0 +1,229 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerState represents the state of a circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed means that requests flow to the upstream service
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen means that requests to the upstream service are rejected
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen means that a limited number of trial requests
+	// are let through to decide whether the breaker should close again
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+var (
+	defaultBreakerOpenDuration     = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// CircuitBreaker defines when requests to an upstream service are short-circuited
+type CircuitBreaker struct {
+	FailureThreshold int    `json:"failureThreshold"`
+	OpenDuration     string `json:"openDuration,omitempty"`
+	HalfOpenRequests int    `json:"halfOpenRequests,omitempty"`
+}
+
+// GetOpenDuration returns how long the breaker stays open before
+// letting trial requests through. It defaults to 30s.
+func (c CircuitBreaker) GetOpenDuration() time.Duration {
+	return parseDurationOrDefault(c.OpenDuration, defaultBreakerOpenDuration)
+}
+
+// GetHalfOpenRequests returns the number of concurrent trial requests
+// let through while the breaker is half-open. It defaults to 1.
+func (c CircuitBreaker) GetHalfOpenRequests() int {
+	if c.HalfOpenRequests <= 0 {
+		return defaultBreakerHalfOpenRequests
+	}
+	return c.HalfOpenRequests
+}
+
+// BreakerStatus is a snapshot of the circuit breaker for an upstream service
+type BreakerStatus struct {
+	Namespace string       `json:"namespace"`
+	Service   string       `json:"service"`
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"consecutiveFailures"`
+	Since     time.Time    `json:"since"`
+}
+
+type breakerKey struct {
+	namespace string
+	service   string
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	trials   int
+	since    time.Time
+}
+
+// BreakerFactory is factory that implements a concurrency safe store for
+// the circuit breakers of upstream services, keyed by namespace and service
+type BreakerFactory struct {
+	mutex    sync.Mutex
+	breakers map[breakerKey]*breaker
+}
+
+// BreakerStore holds the circuit breakers of every upstream service
+// that Kanali has proxied to. It should not be mutated directly!
+var BreakerStore *BreakerFactory
+
+func init() {
+	BreakerStore = &BreakerFactory{sync.Mutex{}, map[breakerKey]*breaker{}}
+}
+
+// Clear will remove all circuit breakers from the store
+func (s *BreakerFactory) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k := range s.breakers {
+		delete(s.breakers, k)
+	}
+}
+
+// IsEmpty reports whether the circuit breaker store is empty
+func (s *BreakerFactory) IsEmpty() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.breakers) == 0
+}
+
+// Allow reports whether a request may be sent to an upstream service. It
+// also returns the state of the breaker before and after the call so that
+// callers can report state changes.
+func (s *BreakerFactory) Allow(namespace, service string, c CircuitBreaker) (bool, BreakerState, BreakerState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b := s.get(namespace, service)
+	from := b.state
+
+	if b.state == BreakerOpen && time.Now().Sub(b.since) >= c.GetOpenDuration() {
+		b.transition(BreakerHalfOpen)
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		return false, from, b.state
+	case BreakerHalfOpen:
+		if b.trials >= c.GetHalfOpenRequests() {
+			return false, from, b.state
+		}
+		b.trials++
+	}
+	return true, from, b.state
+}
+
+// Record records the outcome of a request to an upstream service. It
+// returns the state of the breaker before and after the call.
+func (s *BreakerFactory) Record(namespace, service string, c CircuitBreaker, success bool) (BreakerState, BreakerState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b := s.get(namespace, service)
+	from := b.state
+
+	switch b.state {
+	case BreakerClosed:
+		if success {
+			b.failures = 0
+		} else if b.failures++; b.failures >= c.FailureThreshold {
+			b.transition(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if success {
+			b.transition(BreakerClosed)
+			b.failures = 0
+		} else {
+			b.failures++
+			b.transition(BreakerOpen)
+		}
+	}
+	return from, b.state
+}
+
+// Cancel records that a request allowed through a breaker completed without
+// an outcome, such as when its client went away. A half-open breaker
+// can then allow another trial request in its place.
+func (s *BreakerFactory) Cancel(namespace, service string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b := s.get(namespace, service)
+	if b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+// Evict removes the circuit breaker of an upstream service that no longer exists
+func (s *BreakerFactory) Evict(namespace, service string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.breakers, breakerKey{namespace, service})
+}
+
+// Status returns a snapshot of every circuit breaker, sorted by namespace and service
+func (s *BreakerFactory) Status() []BreakerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := make([]BreakerStatus, 0, len(s.breakers))
+	for k, b := range s.breakers {
+		status = append(status, BreakerStatus{
+			Namespace: k.namespace,
+			Service:   k.service,
+			State:     b.state,
+			Failures:  b.failures,
+			Since:     b.since,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		if status[i].Namespace != status[j].Namespace {
+			return status[i].Namespace < status[j].Namespace
+		}
+		return status[i].Service < status[j].Service
+	})
+	return status
+}
+
+func (s *BreakerFactory) get(namespace, service string) *breaker {
+	k := breakerKey{namespace, service}
+	b, ok := s.breakers[k]
+	if !ok {
+		b = &breaker{state: BreakerClosed, since: time.Now()}
+		s.breakers[k] = b
+	}
+	return b
+}
+
+func (b *breaker) transition(state BreakerState) {
+	b.state = state
+	b.trials = 0
+	b.since = time.Now()
+}
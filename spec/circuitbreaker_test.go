@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerDefaults(t *testing.T) {
+	c := CircuitBreaker{}
+	assert.Equal(t, 30*time.Second, c.GetOpenDuration())
+	assert.Equal(t, 1, c.GetHalfOpenRequests())
+
+	c = CircuitBreaker{OpenDuration: "5s", HalfOpenRequests: 3}
+	assert.Equal(t, 5*time.Second, c.GetOpenDuration())
+	assert.Equal(t, 3, c.GetHalfOpenRequests())
+}
+
+func TestBreakerStore(t *testing.T) {
+	assert := assert.New(t)
+	store := BreakerStore
+	defer store.Clear()
+	c := CircuitBreaker{FailureThreshold: 2, OpenDuration: "20ms"}
+
+	store.Clear()
+	assert.True(store.IsEmpty())
+
+	allowed, from, to := store.Allow("foo", "bar", c)
+	assert.True(allowed)
+	assert.Equal(BreakerClosed, from)
+	assert.Equal(BreakerClosed, to)
+	assert.False(store.IsEmpty())
+
+	// a success resets the consecutive failures
+	store.Record("foo", "bar", c, false)
+	store.Record("foo", "bar", c, true)
+	from, to = store.Record("foo", "bar", c, false)
+	assert.Equal(BreakerClosed, to)
+
+	from, to = store.Record("foo", "bar", c, false)
+	assert.Equal(BreakerClosed, from)
+	assert.Equal(BreakerOpen, to)
+
+	allowed, _, to = store.Allow("foo", "bar", c)
+	assert.False(allowed)
+	assert.Equal(BreakerOpen, to)
+
+	// other services are not affected
+	allowed, _, _ = store.Allow("foo", "baz", c)
+	assert.True(allowed)
+
+	// once the open duration elapses a single trial request is let through
+	time.Sleep(25 * time.Millisecond)
+	allowed, from, to = store.Allow("foo", "bar", c)
+	assert.True(allowed)
+	assert.Equal(BreakerOpen, from)
+	assert.Equal(BreakerHalfOpen, to)
+	allowed, _, _ = store.Allow("foo", "bar", c)
+	assert.False(allowed)
+
+	from, to = store.Record("foo", "bar", c, false)
+	assert.Equal(BreakerHalfOpen, from)
+	assert.Equal(BreakerOpen, to)
+
+	// a canceled trial request makes room for another
+	time.Sleep(25 * time.Millisecond)
+	allowed, _, _ = store.Allow("foo", "bar", c)
+	assert.True(allowed)
+	store.Cancel("foo", "bar")
+	allowed, _, to = store.Allow("foo", "bar", c)
+	assert.True(allowed)
+	assert.Equal(BreakerHalfOpen, to)
+	from, to = store.Record("foo", "bar", c, true)
+	assert.Equal(BreakerHalfOpen, from)
+	assert.Equal(BreakerClosed, to)
+
+	status := store.Status()
+	assert.Equal(2, len(status))
+	assert.Equal("bar", status[0].Service)
+	assert.Equal(BreakerClosed, status[0].State)
+	assert.Equal(0, status[0].Failures)
+	assert.Equal("baz", status[1].Service)
+
+	store.Evict("foo", "baz")
+	status = store.Status()
+	assert.Equal(1, len(status))
+	assert.Equal("bar", status[0].Service)
+}
@@ -20,11 +20,181 @@
 
 package spec
 
-import "k8s.io/kubernetes/pkg/api"
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"k8s.io/kubernetes/pkg/api"
+)
 
 // KanaliEndpoints represents the endpoints of all running instances of Kanali
 var KanaliEndpoints *api.Endpoints
 
+// EndpointsFactory is factory that implements a concurrency safe store for Kubernetes endpoints
+type EndpointsFactory struct {
+	mutex        sync.RWMutex
+	endpointsMap map[string]map[string]api.Endpoints
+}
+
+// EndpointsStore holds the endpoints of all Kubernetes services that Kanali
+// has discovered in a cluster. It should not be mutated directly!
+var EndpointsStore *EndpointsFactory
+
 func init() {
 	KanaliEndpoints = &api.Endpoints{}
+	EndpointsStore = &EndpointsFactory{sync.RWMutex{}, map[string]map[string]api.Endpoints{}}
+}
+
+// Clear will remove all endpoints from the store
+func (s *EndpointsFactory) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k := range s.endpointsMap {
+		delete(s.endpointsMap, k)
+	}
+}
+
+// Update will update endpoints
+func (s *EndpointsFactory) Update(obj interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	endpoints, ok := obj.(api.Endpoints)
+	if !ok {
+		return errors.New("grrr - you're only allowed add endpoints to the endpoints store.... duh")
+	}
+	return s.set(endpoints)
+}
+
+// Set takes Endpoints and either adds them to the store
+// or updates them
+func (s *EndpointsFactory) Set(obj interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	endpoints, ok := obj.(api.Endpoints)
+	if !ok {
+		return errors.New("grrr - you're only allowed add endpoints to the endpoints store.... duh")
+	}
+	return s.set(endpoints)
+}
+
+func (s *EndpointsFactory) set(endpoints api.Endpoints) error {
+	logrus.Debugf("Adding new Endpoints named %s", endpoints.ObjectMeta.Name)
+	if _, ok := s.endpointsMap[endpoints.ObjectMeta.Namespace]; !ok {
+		s.endpointsMap[endpoints.ObjectMeta.Namespace] = map[string]api.Endpoints{}
+	}
+	s.endpointsMap[endpoints.ObjectMeta.Namespace][endpoints.ObjectMeta.Name] = endpoints
+	return nil
+}
+
+// Get retrieves the endpoints of a particular service. If not found, nil is returned.
+func (s *EndpointsFactory) Get(params ...interface{}) (interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(params) != 2 {
+		return nil, errors.New("should should take 2 params, name and namespace")
+	}
+	name, ok := params[0].(string)
+	if !ok {
+		return nil, errors.New("endpoints name must be of type string")
+	}
+	namespace, ok := params[1].(string)
+	if !ok {
+		return nil, errors.New("endpoints namespace must be of type string")
+	}
+	endpoints, ok := s.endpointsMap[namespace][name]
+	if !ok {
+		return nil, nil
+	}
+	return endpoints, nil
+}
+
+// Delete will remove the endpoints of a particular service from the store
+func (s *EndpointsFactory) Delete(obj interface{}) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if obj == nil {
+		return nil, nil
+	}
+	endpoints, ok := obj.(api.Endpoints)
+	if !ok {
+		return nil, errors.New("there's no way these endpoints could've gotten in here")
+	}
+	old, ok := s.endpointsMap[endpoints.ObjectMeta.Namespace][endpoints.ObjectMeta.Name]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.endpointsMap[endpoints.ObjectMeta.Namespace], endpoints.ObjectMeta.Name)
+	if len(s.endpointsMap[endpoints.ObjectMeta.Namespace]) == 0 {
+		delete(s.endpointsMap, endpoints.ObjectMeta.Namespace)
+	}
+	return old, nil
+}
+
+// IsEmpty reports whether the endpoints store is empty
+func (s *EndpointsFactory) IsEmpty() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.endpointsMap) == 0
+}
+
+// EndpointAddresses returns the sorted host:port addresses of the ready pods
+// backing a port of a service. Within each subset, the endpoint port is the one
+// named after the service port or, failing that, the one matching its target
+// port. If the service port is unknown, the endpoint port with the same number
+// or, failing that, the only endpoint port is used.
+func EndpointAddresses(endpoints api.Endpoints, svc Service, port int64) []string {
+	addresses := []string{}
+	servicePort, known := svc.port(port)
+	for _, subset := range endpoints.Subsets {
+		var p int32
+		var ok bool
+		if known {
+			p, ok = targetEndpointPort(subset.Ports, servicePort)
+		} else {
+			p, ok = endpointPort(subset.Ports, port)
+		}
+		if !ok {
+			continue
+		}
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, net.JoinHostPort(address.IP, strconv.Itoa(int(p))))
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// targetEndpointPort finds the endpoint port that a service port forwards to.
+// Kubernetes names endpoint ports after the service port they belong to, and
+// leaves both unnamed when a service exposes a single port.
+func targetEndpointPort(ports []api.EndpointPort, servicePort ServicePort) (int32, bool) {
+	for _, p := range ports {
+		if p.Name == servicePort.Name {
+			return p.Port, true
+		}
+	}
+	if target, err := strconv.ParseInt(servicePort.TargetPort, 10, 32); err == nil {
+		for _, p := range ports {
+			if int64(p.Port) == target {
+				return p.Port, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func endpointPort(ports []api.EndpointPort, port int64) (int32, bool) {
+	for _, p := range ports {
+		if int64(p.Port) == port {
+			return p.Port, true
+		}
+	}
+	if len(ports) == 1 {
+		return ports[0].Port, true
+	}
+	return 0, false
 }
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestEndpointsStore(t *testing.T) {
+	assert := assert.New(t)
+	store := EndpointsStore
+	defer store.Clear()
+	endpoints := getTestEndpoints()
+
+	store.Clear()
+	assert.True(store.IsEmpty())
+	assert.Equal("grrr - you're only allowed add endpoints to the endpoints store.... duh", store.Set(APIProxy{}).Error())
+	assert.Equal("grrr - you're only allowed add endpoints to the endpoints store.... duh", store.Update(APIProxy{}).Error())
+
+	assert.Nil(store.Set(endpoints))
+	assert.False(store.IsEmpty())
+	result, err := store.Get("foo", "bar")
+	assert.Nil(err)
+	assert.Equal(endpoints, result)
+	result, _ = store.Get("foo", "baz")
+	assert.Nil(result)
+	_, err = store.Get("foo")
+	assert.Equal("should should take 2 params, name and namespace", err.Error())
+	_, err = store.Get(5, "bar")
+	assert.Equal("endpoints name must be of type string", err.Error())
+	_, err = store.Get("foo", 5)
+	assert.Equal("endpoints namespace must be of type string", err.Error())
+
+	endpoints.Subsets = nil
+	assert.Nil(store.Update(endpoints))
+	result, _ = store.Get("foo", "bar")
+	assert.Equal(endpoints, result)
+
+	_, err = store.Delete(APIProxy{})
+	assert.Equal("there's no way these endpoints could've gotten in here", err.Error())
+	result, _ = store.Delete(nil)
+	assert.Nil(result)
+	result, _ = store.Delete(endpoints)
+	assert.Equal(endpoints, result)
+	result, _ = store.Delete(endpoints)
+	assert.Nil(result)
+	assert.True(store.IsEmpty())
+}
+
+func TestEndpointAddresses(t *testing.T) {
+	endpoints := getTestEndpoints()
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8080"}, EndpointAddresses(endpoints, Service{}, 80))
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.1.1:9090"}, EndpointAddresses(endpoints, Service{}, 9090))
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.1.1:8443"}, EndpointAddresses(endpoints, Service{}, 8443))
+	assert.Equal(t, []string{}, EndpointAddresses(api.Endpoints{}, Service{}, 80))
+
+	// the ports of a known service are matched by name or target port
+	svc := Service{Ports: []ServicePort{
+		{Name: "http", Port: 80, TargetPort: "http"},
+		{Name: "https", Port: 443, TargetPort: "8443"},
+		{Name: "admin", Port: 9000, TargetPort: "9090"},
+	}}
+	assert.Equal(t, []string{"10.0.1.1:9090"}, EndpointAddresses(endpoints, svc, 80))
+	assert.Equal(t, []string{"10.0.1.1:8443"}, EndpointAddresses(endpoints, svc, 443))
+	assert.Equal(t, []string{"10.0.1.1:9090"}, EndpointAddresses(endpoints, svc, 9000))
+	single := Service{Ports: []ServicePort{{Port: 80, TargetPort: "8080"}}}
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8080"}, EndpointAddresses(endpoints, single, 80))
+}
+
+func getTestEndpoints() api.Endpoints {
+	return api.Endpoints{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "foo",
+			Namespace: "bar",
+		},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.0.0.2"}, {IP: "10.0.0.1"}},
+				Ports:     []api.EndpointPort{{Port: 8080}},
+			},
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.0.1.1"}},
+				Ports:     []api.EndpointPort{{Name: "http", Port: 9090}, {Name: "https", Port: 8443}},
+			},
+		},
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+var (
+	defaultEjectionDuration    = 30 * time.Second
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = time.Second
+	defaultUnhealthyThreshold  = 3
+	defaultHealthyThreshold    = 2
+)
+
+// HealthCheck defines how unhealthy pods of the upstream service are detected
+// and ejected. It only applies when a LoadBalancer is defined. Passive checks
+// observe the outcome of proxied requests while active checks probe every pod.
+type HealthCheck struct {
+	ConsecutiveFailures int                `json:"consecutiveFailures,omitempty"`
+	EjectionDuration    string             `json:"ejectionDuration,omitempty"`
+	Active              *ActiveHealthCheck `json:"active,omitempty"`
+}
+
+// ActiveHealthCheck defines an HTTP probe that is periodically sent to every pod
+type ActiveHealthCheck struct {
+	Path               string `json:"path"`
+	Interval           string `json:"interval,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	UnhealthyThreshold int    `json:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int    `json:"healthyThreshold,omitempty"`
+}
+
+// GetEjectionDuration returns the cool-down after which an
+// ejected pod is restored. It defaults to 30s.
+func (h HealthCheck) GetEjectionDuration() time.Duration {
+	return parseDurationOrDefault(h.EjectionDuration, defaultEjectionDuration)
+}
+
+// GetInterval returns the time between probes. It defaults to 10s.
+func (a ActiveHealthCheck) GetInterval() time.Duration {
+	return parseDurationOrDefault(a.Interval, defaultHealthCheckInterval)
+}
+
+// GetTimeout returns how long to wait for a probe response. It defaults to 1s.
+func (a ActiveHealthCheck) GetTimeout() time.Duration {
+	return parseDurationOrDefault(a.Timeout, defaultHealthCheckTimeout)
+}
+
+// GetUnhealthyThreshold returns the number of consecutive failed
+// probes after which a pod is ejected. It defaults to 3.
+func (a ActiveHealthCheck) GetUnhealthyThreshold() int {
+	if a.UnhealthyThreshold <= 0 {
+		return defaultUnhealthyThreshold
+	}
+	return a.UnhealthyThreshold
+}
+
+// GetHealthyThreshold returns the number of consecutive successful
+// probes after which an ejected pod is restored. It defaults to 2.
+func (a ActiveHealthCheck) GetHealthyThreshold() int {
+	if a.HealthyThreshold <= 0 {
+		return defaultHealthyThreshold
+	}
+	return a.HealthyThreshold
+}
+
+// Endpoint identifies a pod backing a Kubernetes service. As the address
+// of a pod may be reused, the service it backs is part of its identity.
+type Endpoint struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+	Address   string `json:"address"`
+}
+
+// Ejection describes a pod that is not sent any requests
+type Ejection struct {
+	Endpoint
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+}
+
+// String identifies an endpoint in logs
+func (e Endpoint) String() string {
+	return e.Namespace + "/" + e.Service + "/" + e.Address
+}
+
+type endpointHealth struct {
+	failures  int
+	successes int
+	ejection  *Ejection
+}
+
+// HealthFactory is factory that implements a concurrency safe store
+// for the health of the pods backing upstream services, keyed by endpoint
+type HealthFactory struct {
+	mutex     sync.Mutex
+	healthMap map[Endpoint]*endpointHealth
+}
+
+// HealthStore holds the health of every pod that Kanali
+// has proxied to. It should not be mutated directly!
+var HealthStore *HealthFactory
+
+func init() {
+	HealthStore = &HealthFactory{sync.Mutex{}, map[Endpoint]*endpointHealth{}}
+}
+
+// Clear will remove all health information from the store
+func (s *HealthFactory) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k := range s.healthMap {
+		delete(s.healthMap, k)
+	}
+}
+
+// IsEmpty reports whether the health store is empty
+func (s *HealthFactory) IsEmpty() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.healthMap) == 0
+}
+
+// IsEjected reports whether an endpoint is currently ejected. Ejections
+// whose cool-down has elapsed are removed, restoring the endpoint.
+func (s *HealthFactory) IsEjected(e Endpoint) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	h, ok := s.healthMap[e]
+	if !ok || h.ejection == nil {
+		return false
+	}
+	if time.Now().After(h.ejection.Until) {
+		logrus.Infof("restoring endpoint %s after its ejection expired", e)
+		h.ejection = nil
+		return false
+	}
+	return true
+}
+
+// RecordPassive records the outcome of a proxied request to an endpoint and
+// ejects it once it reaches the configured number of consecutive failures
+func (s *HealthFactory) RecordPassive(e Endpoint, h HealthCheck, success bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	health := s.get(e)
+	if success {
+		health.failures = 0
+		return
+	}
+	health.failures++
+	if h.ConsecutiveFailures > 0 && health.failures >= h.ConsecutiveFailures {
+		health.failures = 0
+		s.eject(e, health, "consecutive failures", h.GetEjectionDuration())
+	}
+}
+
+// RecordActive records the outcome of an active health check of an endpoint.
+// It is ejected once it fails the unhealthy threshold of consecutive probes
+// and restored once it passes the healthy threshold of consecutive probes.
+func (s *HealthFactory) RecordActive(e Endpoint, h HealthCheck, success bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	health := s.get(e)
+	if success {
+		health.failures = 0
+		health.successes++
+		if health.ejection != nil && health.successes >= h.Active.GetHealthyThreshold() {
+			logrus.Infof("restoring endpoint %s after passing health checks", e)
+			health.ejection = nil
+		}
+		return
+	}
+	health.successes = 0
+	health.failures++
+	if health.failures >= h.Active.GetUnhealthyThreshold() {
+		s.eject(e, health, "failed health checks", h.GetEjectionDuration())
+	}
+}
+
+// Evict removes the health of every pod of a service, e.g. once it is deleted
+func (s *HealthFactory) Evict(namespace, service string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for e := range s.healthMap {
+		if e.Namespace == namespace && e.Service == service {
+			delete(s.healthMap, e)
+		}
+	}
+}
+
+// Prune removes the health of every pod of a service that is no longer
+// one of its endpoints so that a pod reusing its address starts afresh
+func (s *HealthFactory) Prune(endpoints api.Endpoints) {
+	ips := map[string]bool{}
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			ips[address.IP] = true
+		}
+		for _, address := range subset.NotReadyAddresses {
+			ips[address.IP] = true
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for e := range s.healthMap {
+		if e.Namespace != endpoints.ObjectMeta.Namespace || e.Service != endpoints.ObjectMeta.Name {
+			continue
+		}
+		if ip, _, err := net.SplitHostPort(e.Address); err != nil || !ips[ip] {
+			delete(s.healthMap, e)
+		}
+	}
+}
+
+// Status returns every current ejection, sorted by namespace, service and address
+func (s *HealthFactory) Status() []Ejection {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ejections := []Ejection{}
+	now := time.Now()
+	for _, h := range s.healthMap {
+		if h.ejection != nil && now.Before(h.ejection.Until) {
+			ejections = append(ejections, *h.ejection)
+		}
+	}
+	sort.Slice(ejections, func(i, j int) bool {
+		return ejections[i].String() < ejections[j].String()
+	})
+	return ejections
+}
+
+func (s *HealthFactory) get(e Endpoint) *endpointHealth {
+	h, ok := s.healthMap[e]
+	if !ok {
+		h = &endpointHealth{}
+		s.healthMap[e] = h
+	}
+	return h
+}
+
+func (s *HealthFactory) eject(e Endpoint, h *endpointHealth, reason string, d time.Duration) {
+	now := time.Now()
+	if h.ejection == nil {
+		logrus.Warnf("ejecting endpoint %s because of %s", e, reason)
+		h.ejection = &Ejection{Endpoint: e, Reason: reason, Since: now}
+	}
+	h.ejection.Until = now.Add(d)
+}
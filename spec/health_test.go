@@ -0,0 +1,122 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestHealthCheckDefaults(t *testing.T) {
+	h := HealthCheck{Active: &ActiveHealthCheck{}}
+	assert.Equal(t, 30*time.Second, h.GetEjectionDuration())
+	assert.Equal(t, 10*time.Second, h.Active.GetInterval())
+	assert.Equal(t, time.Second, h.Active.GetTimeout())
+	assert.Equal(t, 3, h.Active.GetUnhealthyThreshold())
+	assert.Equal(t, 2, h.Active.GetHealthyThreshold())
+}
+
+func TestHealthStorePassive(t *testing.T) {
+	assert := assert.New(t)
+	store := HealthStore
+	defer store.Clear()
+	h := HealthCheck{ConsecutiveFailures: 2, EjectionDuration: "20ms"}
+	one := Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.1:8080"}
+	two := Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.2:8080"}
+	reused := Endpoint{Namespace: "foo", Service: "baz", Address: "10.0.0.1:8080"}
+
+	store.Clear()
+	assert.True(store.IsEmpty())
+	assert.False(store.IsEjected(one))
+
+	store.RecordPassive(one, h, false)
+	store.RecordPassive(one, h, true)
+	store.RecordPassive(one, h, false)
+	assert.False(store.IsEjected(one))
+	store.RecordPassive(one, h, false)
+	assert.True(store.IsEjected(one))
+	assert.False(store.IsEjected(two))
+	assert.False(store.IsEjected(reused), "the address of a pod is only ejected for the service it backs")
+
+	status := store.Status()
+	assert.Equal(1, len(status))
+	assert.Equal(one, status[0].Endpoint)
+	assert.Equal("consecutive failures", status[0].Reason)
+
+	// the endpoint is restored after the cool-down
+	time.Sleep(25 * time.Millisecond)
+	assert.Equal(0, len(store.Status()))
+	assert.False(store.IsEjected(one))
+}
+
+func TestHealthStoreActive(t *testing.T) {
+	assert := assert.New(t)
+	store := HealthStore
+	defer store.Clear()
+	h := HealthCheck{Active: &ActiveHealthCheck{Path: "/health", UnhealthyThreshold: 2, HealthyThreshold: 2}}
+	one := Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.1:8080"}
+
+	store.Clear()
+	store.RecordActive(one, h, false)
+	assert.False(store.IsEjected(one))
+	store.RecordActive(one, h, false)
+	assert.True(store.IsEjected(one))
+	assert.Equal("failed health checks", store.Status()[0].Reason)
+
+	store.RecordActive(one, h, true)
+	assert.True(store.IsEjected(one))
+	store.RecordActive(one, h, true)
+	assert.False(store.IsEjected(one))
+}
+
+func TestHealthStoreEviction(t *testing.T) {
+	assert := assert.New(t)
+	store := HealthStore
+	defer store.Clear()
+	h := HealthCheck{ConsecutiveFailures: 1}
+	one := Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.1:8080"}
+	two := Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.2:8080"}
+	other := Endpoint{Namespace: "foo", Service: "baz", Address: "10.0.0.3:8080"}
+
+	store.Clear()
+	store.RecordPassive(one, h, false)
+	store.RecordPassive(two, h, false)
+	store.RecordPassive(other, h, false)
+
+	// only the pods that left the service are forgotten
+	store.Prune(api.Endpoints{
+		ObjectMeta: api.ObjectMeta{Name: "bar", Namespace: "foo"},
+		Subsets: []api.EndpointSubset{
+			{NotReadyAddresses: []api.EndpointAddress{{IP: "10.0.0.2"}}},
+		},
+	})
+	assert.False(store.IsEjected(one))
+	assert.True(store.IsEjected(two))
+	assert.True(store.IsEjected(other))
+
+	store.Evict("foo", "bar")
+	assert.False(store.IsEjected(two))
+	assert.True(store.IsEjected(other))
+	assert.Equal(1, len(store.Status()))
+}
@@ -34,8 +34,8 @@ import (
 type mock []Route
 
 type routeNode struct {
-	Children map[string]*routeNode
-	Value    *Route
+	Children map[string]*routeNode `json:"children,omitempty"`
+	Value    *Route                `json:"value,omitempty"`
 }
 
 // Route represents the details for a mock response route
@@ -60,6 +60,14 @@ func init() {
 	MockResponseStore = &MockResponseFactory{sync.RWMutex{}, map[string]map[string]map[string]*routeNode{}}
 }
 
+// MarshalJSON returns the JSON encoding of the mock response routes of
+// every ConfigMap in the store, keyed by namespace, name and HTTP method
+func (s *MockResponseFactory) MarshalJSON() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return json.Marshal(s.mockRespTree)
+}
+
 // Clear will remove all configmaps from the store
 func (s *MockResponseFactory) Clear() {
 	s.mutex.Lock()
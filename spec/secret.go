@@ -29,10 +29,15 @@ import (
 	"k8s.io/kubernetes/pkg/api"
 )
 
+// SecretObserver is notified with the namespace and name of
+// a secret whenever that secret is changed or removed
+type SecretObserver func(namespace, name string)
+
 // SecretFactory is factory that implements a concurrency safe store for Kubernetes secrets
 type SecretFactory struct {
 	mutex     sync.RWMutex
 	secretMap map[string]map[string]api.Secret
+	observers []SecretObserver
 }
 
 // SecretStore holds all Kubernetes secrets that Kanali has discovered
@@ -40,7 +45,21 @@ type SecretFactory struct {
 var SecretStore *SecretFactory
 
 func init() {
-	SecretStore = &SecretFactory{sync.RWMutex{}, map[string]map[string]api.Secret{}}
+	SecretStore = &SecretFactory{sync.RWMutex{}, map[string]map[string]api.Secret{}, nil}
+}
+
+// Observe registers an observer that will be notified of changes to secrets.
+// Observers are notified while the store is locked and so must not use it.
+func (s *SecretFactory) Observe(o SecretObserver) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.observers = append(s.observers, o)
+}
+
+func (s *SecretFactory) notify(namespace, name string) {
+	for _, o := range s.observers {
+		o(namespace, name)
+	}
 }
 
 // Clear will remove all secrets from the store
@@ -48,6 +67,9 @@ func (s *SecretFactory) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	for k := range s.secretMap {
+		for name := range s.secretMap[k] {
+			s.notify(k, name)
+		}
 		delete(s.secretMap, k)
 	}
 }
@@ -84,6 +106,7 @@ func (s *SecretFactory) set(secret api.Secret) error {
 			secret.ObjectMeta.Name: secret,
 		}
 	}
+	s.notify(secret.ObjectMeta.Namespace, secret.ObjectMeta.Name)
 	return nil
 }
 
@@ -128,6 +151,7 @@ func (s *SecretFactory) Delete(obj interface{}) (interface{}, error) {
 		return nil, nil
 	}
 	delete(s.secretMap[secret.ObjectMeta.Namespace], secret.ObjectMeta.Name)
+	s.notify(secret.ObjectMeta.Namespace, secret.ObjectMeta.Name)
 	if len(s.secretMap[secret.ObjectMeta.Namespace]) == 0 {
 		delete(s.secretMap, secret.ObjectMeta.Namespace)
 	}
@@ -147,6 +147,24 @@ func TestSecretDelete(t *testing.T) {
 	assert.Equal(1, len(store.secretMap), "should have 1 namespace represented")
 }
 
+func TestSecretObserve(t *testing.T) {
+	assert := assert.New(t)
+	store := &SecretFactory{secretMap: map[string]map[string]api.Secret{}}
+	secretList := getTestSecretList()
+
+	notified := []string{}
+	store.Observe(func(namespace, name string) {
+		notified = append(notified, namespace+"/"+name)
+	})
+
+	store.Set(secretList[0])
+	store.Update(secretList[1])
+	store.Delete(secretList[0])
+	store.Delete(secretList[0])
+	store.Clear()
+	assert.Equal([]string{"foo/secret-one", "foo/secret-two", "foo/secret-one", "foo/secret-two"}, notified)
+}
+
 func TestX509KeyPair(t *testing.T) {
 	assert := assert.New(t)
 	store := SecretStore
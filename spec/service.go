@@ -21,6 +21,7 @@
 package spec
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strings"
@@ -34,11 +35,20 @@ import (
 
 // Service in an internal representation of a Kubernetes Service
 type Service struct {
-	Name      string `json:"name,omitempty"`
-	Namespace string `json:"namespace,omitempty"`
-	ClusterIP string `json:"clusterIP,omitempty"`
-	Port      int64  `json:"port,omitempty"`
-	Labels    Labels `json:"labels,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	Namespace string        `json:"namespace,omitempty"`
+	ClusterIP string        `json:"clusterIP,omitempty"`
+	Port      int64         `json:"port,omitempty"`
+	Ports     []ServicePort `json:"ports,omitempty"`
+	Labels    Labels        `json:"labels,omitempty"`
+}
+
+// ServicePort represents a port exposed by a Kubernetes service. TargetPort
+// is either the number or the name of the port on the pods backing it.
+type ServicePort struct {
+	Name       string `json:"name,omitempty"`
+	Port       int64  `json:"port,omitempty"`
+	TargetPort string `json:"targetPort,omitempty"`
 }
 
 // Labels represents labels on a Kubernetes service
@@ -69,6 +79,13 @@ func init() {
 	ServiceStore = &ServiceFactory{sync.RWMutex{}, map[string]services{}}
 }
 
+// MarshalJSON returns the JSON encoding of every service in the store, keyed by namespace
+func (s *ServiceFactory) MarshalJSON() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return json.Marshal(s.serviceMap)
+}
+
 // Clear will remove all services from the store
 func (s *ServiceFactory) Clear() {
 	s.mutex.Lock()
@@ -188,10 +205,19 @@ func CreateService(s api.Service) Service {
 	for k, v := range s.ObjectMeta.Labels {
 		l = append(l, Label{Name: k, Value: v})
 	}
+	var ports []ServicePort
+	for _, p := range s.Spec.Ports {
+		ports = append(ports, ServicePort{
+			Name:       p.Name,
+			Port:       int64(p.Port),
+			TargetPort: p.TargetPort.String(),
+		})
+	}
 	return Service{
 		Name:      s.ObjectMeta.Name,
 		Namespace: s.ObjectMeta.Namespace,
 		ClusterIP: s.Spec.ClusterIP,
+		Ports:     ports,
 		Labels:    l,
 	}
 }
@@ -238,3 +264,13 @@ func (a services) indexOf(s Service) (int, *Service) {
 	}
 	return -1, nil
 }
+
+// port returns the service port with the given number
+func (s Service) port(port int64) (ServicePort, bool) {
+	for _, p := range s.Ports {
+		if p.Port == port {
+			return p, true
+		}
+	}
+	return ServicePort{}, false
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/util/intstr"
 )
 
 func TestGetServiceStore(t *testing.T) {
@@ -77,10 +78,19 @@ func TestCreateService(t *testing.T) {
 				"three": "four",
 			},
 		},
-		Spec: api.ServiceSpec{},
+		Spec: api.ServiceSpec{
+			Ports: []api.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("web")},
+				{Name: "https", Port: 443, TargetPort: intstr.FromInt(8443)},
+			},
+		},
 	})
 
 	assert.Equal("foo", svc.Name, message)
+	assert.Equal([]ServicePort{
+		{Name: "http", Port: 80, TargetPort: "web"},
+		{Name: "https", Port: 443, TargetPort: "8443"},
+	}, svc.Ports, message)
 	assert.Equal("bar", svc.Namespace, message)
 	assert.Equal(2, len(svc.Labels), message)
 	assert.True((svc.Labels[0] == Label{
@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+)
+
+// circuitBreaker returns the circuit breaker configuration of an APIProxy
+// or nil if requests to the given backend are not short-circuited. As
+// breakers are kept per service, a backend that could not be resolved
+// to a Kubernetes service never is.
+func circuitBreaker(proxy *spec.APIProxy, backend string) *spec.CircuitBreaker {
+	c := proxy.Spec.CircuitBreaker
+	if c == nil || c.FailureThreshold <= 0 || backend == unknownBackend {
+		return nil
+	}
+	return c
+}
+
+// breakerAllow returns an error if the circuit breaker
+// for the chosen backend of an APIProxy is open
+func breakerAllow(proxy *spec.APIProxy, backend string, span opentracing.Span) error {
+	c := circuitBreaker(proxy, backend)
+	if c == nil {
+		return nil
+	}
+
+	allowed, from, to := spec.BreakerStore.Allow(proxy.ObjectMeta.Namespace, backend, *c)
+	reportBreakerTransition(proxy.ObjectMeta.Namespace, backend, from, to, span)
+	if !allowed {
+		return utils.StatusError{
+			Code: http.StatusServiceUnavailable,
+			Err:  fmt.Errorf("circuit breaker for service %s is %s", backend, to),
+		}
+	}
+	return nil
+}
+
+// breakerRecord records the outcome of an upstream request with the circuit
+// breaker for the chosen backend of an APIProxy. Connection errors and 5xx
+// responses count as failures.
+func breakerRecord(proxy *spec.APIProxy, backend string, resp *http.Response, err error, span opentracing.Span) {
+	c := circuitBreaker(proxy, backend)
+	if c == nil {
+		return
+	}
+
+	success := err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError
+	from, to := spec.BreakerStore.Record(proxy.ObjectMeta.Namespace, backend, *c, success)
+	reportBreakerTransition(proxy.ObjectMeta.Namespace, backend, from, to, span)
+}
+
+// breakerCancel releases the trial, if any, taken by an upstream
+// request whose outcome is unknown because it was canceled
+func breakerCancel(proxy *spec.APIProxy, backend string) {
+	if circuitBreaker(proxy, backend) == nil {
+		return
+	}
+	spec.BreakerStore.Cancel(proxy.ObjectMeta.Namespace, backend)
+}
+
+func reportBreakerTransition(namespace, service string, from, to spec.BreakerState, span opentracing.Span) {
+	if from == to {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"namespace": namespace,
+		"service":   service,
+		"from":      from,
+		"to":        to,
+	}).Warn("circuit breaker state changed")
+
+	span.LogKV(
+		"event", "circuit breaker state change",
+		"service", service,
+		"from", string(from),
+		"to", string(to),
+	)
+}
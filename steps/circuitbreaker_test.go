@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	defer spec.BreakerStore.Clear()
+	spec.BreakerStore.Clear()
+
+	mockTracer := mocktracer.New()
+	span := mockTracer.StartSpan("test span")
+
+	proxy := &spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "exampleAPIProxyOne",
+			Namespace: "foo",
+		},
+	}
+
+	// no circuit breaker configured
+	assert.Nil(t, breakerAllow(proxy, "bar", span))
+	breakerRecord(proxy, "bar", nil, errors.New("connection refused"), span)
+	assert.True(t, spec.BreakerStore.IsEmpty())
+
+	proxy.Spec.CircuitBreaker = &spec.CircuitBreaker{FailureThreshold: 2}
+	assert.Nil(t, breakerAllow(proxy, "bar", span))
+	breakerRecord(proxy, "bar", &http.Response{StatusCode: http.StatusServiceUnavailable}, nil, span)
+	assert.Nil(t, breakerAllow(proxy, "bar", span))
+	breakerRecord(proxy, "bar", nil, errors.New("connection refused"), span)
+
+	err := breakerAllow(proxy, "bar", span)
+	assert.Equal(t, "circuit breaker for service bar is open", err.Error())
+	assert.Equal(t, http.StatusServiceUnavailable, err.(utils.StatusError).Status())
+
+	// services that could not be resolved do not share a breaker
+	breakerRecord(proxy, unknownBackend, nil, errors.New("connection refused"), span)
+	breakerRecord(proxy, unknownBackend, nil, errors.New("connection refused"), span)
+	assert.Nil(t, breakerAllow(proxy, unknownBackend, span))
+	assert.Equal(t, 1, len(spec.BreakerStore.Status()))
+
+	span.Finish()
+	logs := mockTracer.FinishedSpans()[0].Logs()
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, "circuit breaker state change", logs[0].Fields[0].ValueString)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/spf13/viper"
+)
+
+// responseBodyWriter writes the body of an upstream response to the client.
+// Responses of unknown length, e.g. chunked responses, are flushed at the
+// configured interval and event streams are flushed after every write so
+// that clients receive data as it is produced by the upstream service.
+type responseBodyWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+	timer    *time.Timer
+	pending  bool
+}
+
+func newResponseBodyWriter(w http.ResponseWriter, resp *http.Response) *responseBodyWriter {
+	writer := &responseBodyWriter{w: w}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return writer
+	}
+
+	if isEventStream(resp.Header.Get("Content-Type")) {
+		writer.flusher = flusher
+	} else if resp.ContentLength < 0 {
+		writer.flusher = flusher
+		writer.interval = viper.GetDuration(config.FlagProxyFlushInterval.GetLong())
+	}
+
+	return writer
+}
+
+func (bw *responseBodyWriter) Write(p []byte) (int, error) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	n, err := bw.w.Write(p)
+	if err != nil || bw.flusher == nil {
+		return n, err
+	}
+
+	if bw.interval <= 0 {
+		bw.flusher.Flush()
+		return n, nil
+	}
+
+	if !bw.pending {
+		bw.pending = true
+		bw.timer = time.AfterFunc(bw.interval, bw.delayedFlush)
+	}
+
+	return n, nil
+}
+
+func (bw *responseBodyWriter) delayedFlush() {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	if !bw.pending {
+		return
+	}
+	bw.flusher.Flush()
+	bw.pending = false
+}
+
+// stop cancels a pending flush. It must be called once the body has been
+// written as the response writer can no longer be used afterwards.
+func (bw *responseBodyWriter) stop() {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	if bw.timer != nil {
+		bw.timer.Stop()
+	}
+	bw.pending = false
+}
+
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/event-stream"
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseBodyWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := newResponseBodyWriter(recorder, &http.Response{ContentLength: 4, Header: http.Header{}})
+	io.WriteString(writer, "test")
+	writer.stop()
+	assert.False(t, recorder.Flushed, "responses of known length should not be flushed")
+
+	recorder = httptest.NewRecorder()
+	writer = newResponseBodyWriter(recorder, &http.Response{ContentLength: 4, Header: http.Header{
+		"Content-Type": []string{"text/event-stream; charset=utf-8"},
+	}})
+	io.WriteString(writer, "data: test\n\n")
+	assert.True(t, recorder.Flushed, "event streams should be flushed after every write")
+	writer.stop()
+
+	viper.SetDefault(config.FlagProxyFlushInterval.GetLong(), 10*time.Millisecond)
+	defer viper.SetDefault(config.FlagProxyFlushInterval.GetLong(), 0)
+
+	recorder = httptest.NewRecorder()
+	writer = newResponseBodyWriter(recorder, &http.Response{ContentLength: -1, Header: http.Header{}})
+	io.WriteString(writer, "test")
+	writer.mu.Lock()
+	assert.False(t, recorder.Flushed, "responses of unknown length should be flushed after an interval")
+	writer.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	writer.mu.Lock()
+	assert.True(t, recorder.Flushed, "responses of unknown length should be flushed after an interval")
+	writer.mu.Unlock()
+	writer.stop()
+}
+
+func TestIsEventStream(t *testing.T) {
+	assert.True(t, isEventStream("text/event-stream"))
+	assert.True(t, isEventStream("text/event-stream; charset=utf-8"))
+	assert.False(t, isEventStream("text/plain"))
+	assert.False(t, isEventStream(""))
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/northwesternmutual/kanali/utils"
+)
+
+// trustedProxies holds the networks of the proxies in front of Kanali
+// whose forwarding headers are trusted. It is set by LoadTrustedProxies.
+var trustedProxies []*net.IPNet
+
+// hopByHopHeaders only apply to a single connection and are
+// never forwarded by a proxy (RFC 7230, section 6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// forwardingHeaders describe the hops that a request has taken
+// and are only trusted if they were set by a trusted proxy
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+}
+
+// removeHopByHopHeaders removes every hop-by-hop header,
+// including the headers listed by the Connection header
+func removeHopByHopHeaders(h http.Header) {
+	for _, value := range h["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				h.Del(token)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// sanitizeRequestHeaders removes the hop-by-hop headers of an upstream
+// request. The headers needed to switch protocols and to receive trailers,
+// which gRPC relies on, are preserved.
+func sanitizeRequestHeaders(original *http.Request, h http.Header) {
+	upgrade := utils.IsUpgradeRequest(original)
+	trailers := acceptsTrailers(original.Header)
+
+	removeHopByHopHeaders(h)
+
+	if upgrade {
+		h.Set("Connection", "Upgrade")
+		h.Set("Upgrade", original.Header.Get("Upgrade"))
+	}
+	if trailers {
+		h.Set("Te", "trailers")
+	}
+}
+
+func acceptsTrailers(h http.Header) bool {
+	for _, value := range h["Te"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setForwardingHeaders describes the hop from the client to Kanali in the
+// X-Forwarded-* and Forwarded headers of an upstream request. The headers
+// sent by a trusted proxy are extended while those sent by any other
+// client are replaced.
+func setForwardingHeaders(original *http.Request, h http.Header) {
+	peer := RemoteIP(original)
+	proto := "http"
+	if original.TLS != nil {
+		proto = "https"
+	}
+
+	if !isTrustedProxy(peer) {
+		for _, name := range forwardingHeaders {
+			h.Del(name)
+		}
+	}
+
+	if prior := h.Get("X-Forwarded-For"); prior != "" {
+		h.Set("X-Forwarded-For", prior+", "+peer)
+	} else {
+		h.Set("X-Forwarded-For", peer)
+	}
+	if h.Get("X-Forwarded-Proto") == "" {
+		h.Set("X-Forwarded-Proto", proto)
+	}
+	if h.Get("X-Forwarded-Host") == "" {
+		h.Set("X-Forwarded-Host", original.Host)
+	}
+
+	element := "for=" + forwardedNode(peer) + ";host=" + forwardedValue(original.Host) + ";proto=" + proto
+	if prior := h.Get("Forwarded"); prior != "" {
+		element = prior + ", " + element
+	}
+	h.Set("Forwarded", element)
+}
+
+// forwardedNode formats an IP address as a node of the Forwarded header.
+// IPv6 addresses are enclosed in brackets and quoted (RFC 7239, section 6).
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return forwardedValue(ip)
+}
+
+// forwardedValue quotes a value of the Forwarded header if it is not a token
+func forwardedValue(value string) string {
+	for _, c := range value {
+		if !isTokenChar(c) {
+			return `"` + strings.Replace(value, `"`, `\"`, -1) + `"`
+		}
+	}
+	return value
+}
+
+func isTokenChar(c rune) bool {
+	return c > ' ' && c < 0x7f && !strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c)
+}
+
+// RemoteIP returns the IP address of the peer that sent a request. If the
+// PROXY protocol is enabled, this is the address of the original client.
+func RemoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ClientIP returns the IP address of the client that sent a request. The
+// X-Forwarded-For hops added by trusted proxies are skipped to find it.
+func ClientIP(r *http.Request) string {
+	ip := RemoteIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// LoadTrustedProxies parses the IP addresses and CIDR ranges of the proxies
+// in front of Kanali whose forwarding headers are trusted. It should be
+// called once at startup, before any request is served.
+func LoadTrustedProxies(entries []string) error {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return fmt.Errorf("trusted proxy %s is neither an IP address nor a CIDR range", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	trustedProxies = networks
+	return nil
+}
+
+// isTrustedProxy reports whether an IP address belongs to one of the
+// networks of the trusted proxies
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
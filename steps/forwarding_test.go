@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveHopByHopHeaders(t *testing.T) {
+	h := http.Header{
+		"Connection":        []string{"close, X-Foo"},
+		"Keep-Alive":        []string{"timeout=5"},
+		"Transfer-Encoding": []string{"chunked"},
+		"X-Foo":             []string{"bar"},
+		"X-Bar":             []string{"foo"},
+	}
+	removeHopByHopHeaders(h)
+	assert.Equal(t, http.Header{"X-Bar": []string{"foo"}}, h)
+}
+
+func TestSanitizeRequestHeaders(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Te", "gzip, trailers")
+	r.Header.Set("Proxy-Authorization", "secret")
+	h := http.Header{}
+	for k, v := range r.Header {
+		h[k] = v
+	}
+	sanitizeRequestHeaders(r, h)
+	assert.Equal(t, http.Header{
+		"Connection": []string{"Upgrade"},
+		"Upgrade":    []string{"websocket"},
+		"Te":         []string{"trailers"},
+	}, h)
+
+	r.Header = http.Header{"Connection": []string{"close"}, "Te": []string{"gzip"}}
+	h = http.Header{"Connection": []string{"close"}, "Te": []string{"gzip"}}
+	sanitizeRequestHeaders(r, h)
+	assert.Equal(t, http.Header{}, h)
+}
+
+func TestSetForwardingHeaders(t *testing.T) {
+	defer LoadTrustedProxies(nil)
+
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	h := http.Header{
+		"X-Forwarded-For":   []string{"6.6.6.6"},
+		"X-Forwarded-Proto": []string{"https"},
+		"Forwarded":         []string{"for=6.6.6.6"},
+	}
+
+	// headers sent by an untrusted client are replaced
+	setForwardingHeaders(r, h)
+	assert.Equal(t, "1.2.3.4", h.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", h.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "foo.bar.com", h.Get("X-Forwarded-Host"))
+	assert.Equal(t, "for=1.2.3.4;host=foo.bar.com;proto=http", h.Get("Forwarded"))
+
+	// headers sent by a trusted proxy are extended
+	assert.Nil(t, LoadTrustedProxies([]string{"1.2.3.0/24"}))
+	h = http.Header{
+		"X-Forwarded-For":   []string{"6.6.6.6"},
+		"X-Forwarded-Proto": []string{"https"},
+		"X-Forwarded-Host":  []string{"example.com"},
+		"Forwarded":         []string{"for=6.6.6.6;proto=https"},
+	}
+	setForwardingHeaders(r, h)
+	assert.Equal(t, "6.6.6.6, 1.2.3.4", h.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", h.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "example.com", h.Get("X-Forwarded-Host"))
+	assert.Equal(t, "for=6.6.6.6;proto=https, for=1.2.3.4;host=foo.bar.com;proto=http", h.Get("Forwarded"))
+
+	// IPv6 addresses and hosts with a port are quoted
+	r.RemoteAddr = "[2001:db8::1]:5678"
+	r.Host = "foo.bar.com:8443"
+	r.TLS = &tls.ConnectionState{}
+	h = http.Header{}
+	setForwardingHeaders(r, h)
+	assert.Equal(t, "2001:db8::1", h.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", h.Get("X-Forwarded-Proto"))
+	assert.Equal(t, `for="[2001:db8::1]";host="foo.bar.com:8443";proto=https`, h.Get("Forwarded"))
+}
+
+func TestIsTrustedProxy(t *testing.T) {
+	defer LoadTrustedProxies(nil)
+	assert.False(t, isTrustedProxy("10.0.0.1"))
+
+	assert.Equal(t, "trusted proxy invalid is neither an IP address nor a CIDR range", LoadTrustedProxies([]string{"invalid"}).Error())
+	assert.Nil(t, LoadTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::1"}))
+	assert.True(t, isTrustedProxy("10.1.2.3"))
+	assert.True(t, isTrustedProxy("192.168.1.1"))
+	assert.False(t, isTrustedProxy("192.168.1.2"))
+	assert.True(t, isTrustedProxy("2001:db8::1"))
+	assert.False(t, isTrustedProxy("2001:db8::2"))
+	assert.False(t, isTrustedProxy("not an ip"))
+}
+
+func TestClientIP(t *testing.T) {
+	defer LoadTrustedProxies(nil)
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	r.RemoteAddr = "10.0.0.1:5678"
+	r.Header.Set("X-Forwarded-For", "6.6.6.6, 1.2.3.4, 10.0.0.2")
+
+	// forwarding headers sent by untrusted clients are ignored
+	assert.Equal(t, "10.0.0.1", ClientIP(r))
+
+	assert.Nil(t, LoadTrustedProxies([]string{"10.0.0.0/8"}))
+	assert.Equal(t, "1.2.3.4", ClientIP(r))
+
+	r.Header.Set("X-Forwarded-For", "10.0.0.3")
+	assert.Equal(t, "10.0.0.3", ClientIP(r))
+
+	r.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.1", ClientIP(r))
+}
+
+func TestRemoteIP(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	assert.Equal(t, "1.2.3.4", RemoteIP(r))
+	r.RemoteAddr = "[::1]:5678"
+	assert.Equal(t, "::1", RemoteIP(r))
+	r.RemoteAddr = "1.2.3.4"
+	assert.Equal(t, "1.2.3.4", RemoteIP(r))
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+)
+
+// RequestHeadersStep is factory that defines a step responsible for
+// transforming the headers of a request as declared by its APIProxy
+type RequestHeadersStep struct{}
+
+// GetName retruns the name of the RequestHeadersStep step
+func (step RequestHeadersStep) GetName() string {
+	return "Request Headers"
+}
+
+// Do executes the logic of the RequestHeadersStep step
+func (step RequestHeadersStep) Do(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, span opentracing.Span) error {
+	if proxy.Spec.RequestHeaders == nil {
+		return nil
+	}
+	data := newHeaderTemplateData(proxy, m, r)
+	return transformHeaders(r.Header, proxy.Spec.RequestHeaders, data)
+}
+
+// ResponseHeadersStep is factory that defines a step responsible for
+// transforming the headers of a response as declared by its APIProxy
+type ResponseHeadersStep struct{}
+
+// GetName retruns the name of the ResponseHeadersStep step
+func (step ResponseHeadersStep) GetName() string {
+	return "Response Headers"
+}
+
+// Do executes the logic of the ResponseHeadersStep step
+func (step ResponseHeadersStep) Do(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, span opentracing.Span) error {
+	if proxy.Spec.ResponseHeaders == nil {
+		return nil
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	data := newHeaderTemplateData(proxy, m, r)
+	data.ResponseHeader = cloneHeader(resp.Header)
+	return transformHeaders(resp.Header, proxy.Spec.ResponseHeaders, data)
+}
+
+// headerTemplateData is available to the templates of header values, e.g.
+// {{.ClientIP}}, {{.PathParams.id}}, {{.APIKeyName}} or {{.Header.Get "Accept"}}
+type headerTemplateData struct {
+	ClientIP       string
+	PathParams     map[string]string
+	APIKeyName     string
+	Header         http.Header
+	ResponseHeader http.Header
+}
+
+func newHeaderTemplateData(proxy *spec.APIProxy, m *metrics.Metrics, r *http.Request) *headerTemplateData {
+	data := &headerTemplateData{
+		ClientIP:       ClientIP(r),
+		PathParams:     proxy.PathParams,
+		Header:         cloneHeader(r.Header),
+		ResponseHeader: http.Header{},
+	}
+	// the name of the API key is recorded by the API key plugin
+	if m != nil {
+		if metric := m.Get("api_key_name"); metric != nil {
+			data.APIKeyName = fmt.Sprintf("%v", metric.Value)
+		}
+	}
+	return data
+}
+
+// transformHeaders removes, sets and then adds headers. Templates are rendered
+// with the headers as they were before the transformation. A value that
+// renders empty is not set.
+func transformHeaders(h http.Header, t *spec.HeaderTransform, data *headerTemplateData) error {
+	for _, name := range t.Remove {
+		h.Del(name)
+	}
+	for name, value := range t.Set {
+		rendered, err := renderHeaderTemplate(value, data)
+		if err != nil {
+			return err
+		}
+		if rendered != "" {
+			h.Set(name, rendered)
+		}
+	}
+	for name, value := range t.Add {
+		rendered, err := renderHeaderTemplate(value, data)
+		if err != nil {
+			return err
+		}
+		if rendered != "" {
+			h.Add(name, rendered)
+		}
+	}
+	return nil
+}
+
+// headerTemplates caches parsed templates as the
+// same values are rendered for every request
+var headerTemplates = struct {
+	sync.Mutex
+	templates map[string]*template.Template
+}{templates: map[string]*template.Template{}}
+
+func renderHeaderTemplate(value string, data *headerTemplateData) (string, error) {
+	headerTemplates.Lock()
+	tmpl, ok := headerTemplates.templates[value]
+	if !ok {
+		parsed, err := spec.ParseHeaderTemplate(value)
+		if err != nil {
+			headerTemplates.Unlock()
+			return "", utils.StatusError{Code: http.StatusInternalServerError, Err: err}
+		}
+		headerTemplates.templates[value] = parsed
+		tmpl = parsed
+	}
+	headerTemplates.Unlock()
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", utils.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+	return buf.String(), nil
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for k, v := range h {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadersGetName(t *testing.T) {
+	assert.Equal(t, "Request Headers", RequestHeadersStep{}.GetName())
+	assert.Equal(t, "Response Headers", ResponseHeadersStep{}.GetName())
+}
+
+func TestRequestHeadersDo(t *testing.T) {
+	span := opentracing.StartSpan("test span")
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/accounts/123", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.Header.Set("X-Tenant", "acme")
+	r.Header.Set("X-Debug", "true")
+	r.Header.Set("X-Custom", "original")
+	m := &metrics.Metrics{}
+	m.Add(metrics.Metric{Name: "api_key_name", Value: "my-key", Index: true})
+
+	// nothing changes without a transformation
+	assert.Nil(t, RequestHeadersStep{}.Do(context.Background(), &spec.APIProxy{}, m, nil, r, nil, span))
+	assert.Equal(t, "true", r.Header.Get("X-Debug"))
+
+	proxy := &spec.APIProxy{
+		PathParams: map[string]string{"id": "123"},
+		Spec: spec.APIProxySpec{
+			RequestHeaders: &spec.HeaderTransform{
+				Remove: []string{"X-Debug", "X-Custom"},
+				Set: map[string]string{
+					"X-Client-IP":  "{{.ClientIP}}",
+					"X-Account-ID": "{{.PathParams.id}}",
+					"X-Consumer":   "{{.APIKeyName}}",
+					"X-Custom":     "{{.Header.Get \"X-Custom\"}}-changed",
+					"X-Missing":    "{{.Header.Get \"X-Missing\"}}",
+				},
+				Add: map[string]string{
+					"X-Tenant": "{{.Header.Get \"X-Tenant\"}}-eu",
+				},
+			},
+		},
+	}
+	assert.Nil(t, RequestHeadersStep{}.Do(context.Background(), proxy, m, nil, r, nil, span))
+	assert.Equal(t, "", r.Header.Get("X-Debug"))
+	assert.Equal(t, "1.2.3.4", r.Header.Get("X-Client-IP"))
+	assert.Equal(t, "123", r.Header.Get("X-Account-ID"))
+	assert.Equal(t, "my-key", r.Header.Get("X-Consumer"))
+	assert.Equal(t, "original-changed", r.Header.Get("X-Custom"))
+	assert.Equal(t, []string{"acme", "acme-eu"}, r.Header["X-Tenant"])
+	_, ok := r.Header["X-Missing"]
+	assert.False(t, ok)
+
+	proxy.Spec.RequestHeaders = &spec.HeaderTransform{Set: map[string]string{"X-Foo": "{{.Unknown}}"}}
+	err := RequestHeadersStep{}.Do(context.Background(), proxy, m, nil, r, nil, span)
+	assert.Equal(t, http.StatusInternalServerError, err.(utils.Error).Status())
+}
+
+func TestResponseHeadersDo(t *testing.T) {
+	span := opentracing.StartSpan("test span")
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	resp := &http.Response{Header: http.Header{
+		"Server":       []string{"upstream"},
+		"Content-Type": []string{"text/plain"},
+	}}
+
+	proxy := &spec.APIProxy{
+		Spec: spec.APIProxySpec{
+			ResponseHeaders: &spec.HeaderTransform{
+				Remove: []string{"Server"},
+				Set: map[string]string{
+					"X-Correlation-ID": "{{.Header.Get \"X-Request-ID\"}}",
+					"X-Content-Type":   "{{.ResponseHeader.Get \"Content-Type\"}}",
+				},
+			},
+		},
+	}
+	assert.Nil(t, ResponseHeadersStep{}.Do(context.Background(), proxy, &metrics.Metrics{}, nil, r, resp, span))
+	assert.Equal(t, "", resp.Header.Get("Server"))
+	assert.Equal(t, "abc-123", resp.Header.Get("X-Correlation-ID"))
+	assert.Equal(t, "text/plain", resp.Header.Get("X-Content-Type"))
+
+	resp = &http.Response{}
+	assert.Nil(t, ResponseHeadersStep{}.Do(context.Background(), proxy, &metrics.Metrics{}, nil, r, resp, span))
+	assert.Equal(t, "abc-123", resp.Header.Get("X-Correlation-ID"))
+}
+
+func TestResponseHeadersWritten(t *testing.T) {
+	span := opentracing.StartSpan("test span")
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Set-Cookie": []string{"a=1", "b=2"},
+			"Vary":       []string{"Accept"},
+		},
+		Body: ioutil.NopCloser(bytes.NewReader(nil)),
+	}
+	proxy := &spec.APIProxy{
+		Spec: spec.APIProxySpec{
+			ResponseHeaders: &spec.HeaderTransform{
+				Add: map[string]string{"Vary": "Accept-Encoding"},
+			},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	assert.Nil(t, ResponseHeadersStep{}.Do(context.Background(), proxy, &metrics.Metrics{}, w, r, resp, span))
+	assert.Nil(t, WriteResponseStep{}.Do(context.Background(), proxy, &metrics.Metrics{}, w, r, resp, span))
+	assert.Equal(t, []string{"a=1", "b=2"}, w.Result().Header["Set-Cookie"])
+	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, w.Result().Header["Vary"])
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/spec"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// RunHealthChecks periodically probes the pods of the upstream services
+// of every APIProxy that defines an active health check. It never returns.
+func RunHealthChecks() {
+	checker := &healthChecker{last: map[string]time.Time{}}
+	for now := range time.Tick(time.Second) {
+		checker.check(now)
+	}
+}
+
+type healthChecker struct {
+	last map[string]time.Time
+}
+
+// check starts a probe of every pod whose APIProxy is due to be checked.
+// A pod backing the services of several ApiProxies is only probed once,
+// using the health check of the first of them that is due.
+func (c *healthChecker) check(now time.Time) {
+	probes := map[spec.Endpoint]spec.APIProxy{}
+	endpoints := []spec.Endpoint{}
+	seen := map[string]bool{}
+	for _, proxy := range spec.ProxyStore.List() {
+		key := proxy.ObjectMeta.Namespace + "/" + proxy.ObjectMeta.Name
+		seen[key] = true
+		h := proxy.Spec.HealthCheck
+		if h == nil || h.Active == nil || proxy.Spec.LoadBalancer == nil {
+			continue
+		}
+		if now.Sub(c.last[key]) < h.Active.GetInterval() {
+			continue
+		}
+		c.last[key] = now
+
+		for _, e := range proxyEndpoints(proxy) {
+			if _, ok := probes[e]; !ok {
+				probes[e] = proxy
+				endpoints = append(endpoints, e)
+			}
+		}
+	}
+
+	// ApiProxies that have been removed are forgotten
+	for key := range c.last {
+		if !seen[key] {
+			delete(c.last, key)
+		}
+	}
+
+	for _, e := range endpoints {
+		go func(proxy spec.APIProxy, e spec.Endpoint) {
+			if err := probeEndpoint(&proxy, e, *proxy.Spec.HealthCheck); err != nil {
+				logrus.Errorf("could not health check endpoint %s: %s", e, err.Error())
+			}
+		}(probes[e], e)
+	}
+}
+
+// proxyEndpoints returns the pods of every upstream service of an APIProxy
+func proxyEndpoints(proxy spec.APIProxy) []spec.Endpoint {
+	services := []spec.Service{proxy.Spec.Service}
+	for _, backend := range proxy.Spec.Backends {
+		services = append(services, backend.Service)
+	}
+
+	result := []spec.Endpoint{}
+	for _, svc := range services {
+		if svc.Name == "" && len(svc.Labels) == 0 {
+			continue
+		}
+		untypedSvc, err := spec.ServiceStore.Get(svc, nil)
+		if err != nil || untypedSvc == nil {
+			continue
+		}
+		resolved, _ := untypedSvc.(spec.Service)
+		untypedEndpoints, err := spec.EndpointsStore.Get(resolved.Name, resolved.Namespace)
+		if err != nil || untypedEndpoints == nil {
+			continue
+		}
+		endpoints, _ := untypedEndpoints.(api.Endpoints)
+		for _, address := range spec.EndpointAddresses(endpoints, resolved, svc.Port) {
+			result = append(result, spec.Endpoint{Namespace: resolved.Namespace, Service: resolved.Name, Address: address})
+		}
+	}
+	return result
+}
+
+// probeEndpoint sends an active health check to a pod and records its outcome.
+// Any response with a 2xx or 3xx status code is considered healthy.
+func probeEndpoint(proxy *spec.APIProxy, e spec.Endpoint, h spec.HealthCheck) error {
+	// a probe is sent the way a proxied request for one of the hosts
+	// of the APIProxy would be so that it is configured with the same SSL
+	host := probeHost(proxy)
+	scheme := "http"
+	if *proxy.GetSSLCertificates(host) != (spec.SSL{}) {
+		scheme = "https"
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s://%s%s", scheme, e.Address, h.Active.Path), nil)
+	if err != nil {
+		return err
+	}
+	if host != "" {
+		req.Host = host
+	}
+
+	upstream := *proxy
+	upstream.Spec.Service.Name = e.Service
+	transport, err := getTargetTransport(&upstream, req)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout:   h.Active.GetTimeout(),
+		Transport: transport,
+	}
+
+	spec.HealthStore.RecordActive(e, h, sendProbe(client, req))
+	return nil
+}
+
+// probeHost returns the first host of an APIProxy that has its own SSL
+// configuration, or an empty string if none does
+func probeHost(proxy *spec.APIProxy) string {
+	for _, h := range proxy.Spec.Hosts {
+		if h.SSL != (spec.SSL{}) {
+			return h.Name
+		}
+	}
+	return ""
+}
+
+func sendProbe(client httpClient, req *http.Request) bool {
+	resp, err := client.Do(req)
+	if err != nil {
+		logrus.Debugf("health check of %s failed: %s", req.URL.Host, err.Error())
+		return false
+	}
+	defer func() {
+		if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+			logrus.Debugf("error discarding health check response: %s", err.Error())
+		}
+		if err := resp.Body.Close(); err != nil {
+			logrus.Debugf("error closing health check response: %s", err.Error())
+		}
+	}()
+	return resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest
+}
+
+// recordEndpointHealth passively records the outcome of a proxied request to
+// a pod of the resolved service of an APIProxy, see selectUpstream.
+// Connection errors and 5xx responses count as failures.
+func recordEndpointHealth(proxy *spec.APIProxy, address string, resp *http.Response, err error) {
+	h := proxy.Spec.HealthCheck
+	if h == nil || proxy.Spec.LoadBalancer == nil || h.ConsecutiveFailures <= 0 {
+		return
+	}
+	success := err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError
+	e := spec.Endpoint{Namespace: proxy.Spec.Service.Namespace, Service: proxy.Spec.Service.Name, Address: address}
+	spec.HealthStore.RecordPassive(e, *h, success)
+}
+
+// healthyAddresses removes every address of a service that is ejected. If
+// every address is ejected, all of them are returned as sending traffic to a
+// possibly unhealthy pod is preferable to not sending it anywhere.
+func healthyAddresses(svc spec.Service, addresses []string) []string {
+	healthy := []string{}
+	for _, address := range addresses {
+		if !spec.HealthStore.IsEjected(spec.Endpoint{Namespace: svc.Namespace, Service: svc.Name, Address: address}) {
+			healthy = append(healthy, address)
+		}
+	}
+	if len(healthy) == 0 {
+		return addresses
+	}
+	return healthy
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestHealthyAddresses(t *testing.T) {
+	defer spec.HealthStore.Clear()
+	spec.HealthStore.Clear()
+	svc := spec.Service{Name: "bar", Namespace: "foo"}
+	addresses := []string{"10.0.0.1:8080", "10.0.0.2:8080"}
+	h := spec.HealthCheck{ConsecutiveFailures: 1}
+
+	assert.Equal(t, addresses, healthyAddresses(svc, addresses))
+	spec.HealthStore.RecordPassive(spec.Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.1:8080"}, h, false)
+	assert.Equal(t, []string{"10.0.0.2:8080"}, healthyAddresses(svc, addresses))
+	assert.Equal(t, addresses, healthyAddresses(spec.Service{Name: "baz", Namespace: "foo"}, addresses))
+	spec.HealthStore.RecordPassive(spec.Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.2:8080"}, h, false)
+	assert.Equal(t, addresses, healthyAddresses(svc, addresses))
+}
+
+func TestRecordEndpointHealth(t *testing.T) {
+	defer spec.HealthStore.Clear()
+	spec.HealthStore.Clear()
+
+	proxy := &spec.APIProxy{Spec: spec.APIProxySpec{Service: spec.Service{Name: "bar", Namespace: "foo"}}}
+	e := spec.Endpoint{Namespace: "foo", Service: "bar", Address: "10.0.0.1:8080"}
+	recordEndpointHealth(proxy, "10.0.0.1:8080", nil, errors.New("connection refused"))
+	assert.True(t, spec.HealthStore.IsEmpty())
+
+	proxy.Spec.LoadBalancer = &spec.LoadBalancer{Algorithm: spec.LoadBalancerRoundRobin}
+	proxy.Spec.HealthCheck = &spec.HealthCheck{ConsecutiveFailures: 2}
+	recordEndpointHealth(proxy, "10.0.0.1:8080", &http.Response{StatusCode: http.StatusBadGateway}, nil)
+	assert.False(t, spec.HealthStore.IsEjected(e))
+	recordEndpointHealth(proxy, "10.0.0.1:8080", nil, errors.New("connection refused"))
+	assert.True(t, spec.HealthStore.IsEjected(e))
+}
+
+func TestProbeEndpoint(t *testing.T) {
+	defer spec.HealthStore.Clear()
+	defer transports.clear()
+	spec.HealthStore.Clear()
+
+	healthy := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+	e := spec.Endpoint{Namespace: "foo", Service: "bar", Address: upstream.Listener.Addr().String()}
+
+	proxy := &spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "exampleAPIProxyOne", Namespace: "foo"},
+	}
+	h := spec.HealthCheck{Active: &spec.ActiveHealthCheck{Path: "/health", UnhealthyThreshold: 1, HealthyThreshold: 1}}
+
+	assert.Nil(t, probeEndpoint(proxy, e, h))
+	assert.False(t, spec.HealthStore.IsEjected(e))
+	healthy = false
+	assert.Nil(t, probeEndpoint(proxy, e, h))
+	assert.True(t, spec.HealthStore.IsEjected(e))
+	healthy = true
+	assert.Nil(t, probeEndpoint(proxy, e, h))
+	assert.False(t, spec.HealthStore.IsEjected(e))
+}
+
+func TestHealthCheckerCheck(t *testing.T) {
+	defer spec.HealthStore.Clear()
+	defer spec.ProxyStore.Clear()
+	defer spec.ServiceStore.Clear()
+	defer spec.EndpointsStore.Clear()
+	defer transports.clear()
+
+	probed := make(chan string, 10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed <- r.URL.Path
+	}))
+	defer upstream.Close()
+	host, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	spec.ServiceStore.Set(spec.Service{Name: "bar", Namespace: "foo"})
+	spec.EndpointsStore.Set(api.Endpoints{
+		ObjectMeta: api.ObjectMeta{Name: "bar", Namespace: "foo"},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: host}},
+				Ports:     []api.EndpointPort{{Port: int32(p)}},
+			},
+		},
+	})
+	// both ApiProxies share the pods of the same service
+	for name, path := range map[string]string{"exampleAPIProxyOne": "/api/v1/accounts", "exampleAPIProxyTwo": "/api/v1/users"} {
+		spec.ProxyStore.Set(spec.APIProxy{
+			ObjectMeta: api.ObjectMeta{Name: name, Namespace: "foo"},
+			Spec: spec.APIProxySpec{
+				Path:         path,
+				Service:      spec.Service{Name: "bar", Port: int64(p)},
+				LoadBalancer: &spec.LoadBalancer{Algorithm: spec.LoadBalancerRoundRobin},
+				HealthCheck:  &spec.HealthCheck{Active: &spec.ActiveHealthCheck{Path: "/health", Interval: "1m"}},
+			},
+		})
+	}
+
+	checker := &healthChecker{last: map[string]time.Time{}}
+	now := time.Now()
+	checker.check(now)
+	select {
+	case path := <-probed:
+		assert.Equal(t, "/health", path)
+	case <-time.After(time.Second):
+		assert.Fail(t, "endpoint was not probed")
+	}
+	assert.Equal(t, 2, len(checker.last))
+
+	// a shared pod is probed once and not again until the interval has elapsed
+	checker.check(now.Add(time.Second))
+	select {
+	case <-probed:
+		assert.Fail(t, "endpoint was probed before the interval elapsed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// removed ApiProxies are forgotten
+	spec.ProxyStore.Delete(spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{Name: "exampleAPIProxyTwo", Namespace: "foo"},
+		Spec:       spec.APIProxySpec{Path: "/api/v1/users"},
+	})
+	checker.check(now.Add(2 * time.Second))
+	assert.Equal(t, 1, len(checker.last))
+}
+
+func TestProbeHost(t *testing.T) {
+	proxy := &spec.APIProxy{}
+	assert.Equal(t, "", probeHost(proxy))
+
+	proxy.Spec.Hosts = []spec.Host{
+		{Name: "foo.bar.com"},
+		{Name: "bar.foo.com", SSL: spec.SSL{SecretName: "mysecretname"}},
+	}
+	assert.Equal(t, "bar.foo.com", probeHost(proxy))
+	assert.Equal(t, "mysecretname", proxy.GetSSLCertificates(probeHost(proxy)).SecretName)
+}
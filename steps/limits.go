@@ -0,0 +1,158 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+	"github.com/spf13/viper"
+)
+
+var errRequestBodyTooLarge = utils.StatusError{Code: http.StatusRequestEntityTooLarge, Err: errors.New("request body too large")}
+
+// LimitsStep is factory that defines a step responsible for enforcing
+// the request size limits of an APIProxy
+type LimitsStep struct{}
+
+// GetName retruns the name of the LimitsStep step
+func (step LimitsStep) GetName() string {
+	return "Limits"
+}
+
+// Do executes the logic of the LimitsStep step
+func (step LimitsStep) Do(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, span opentracing.Span) error {
+
+	if max := maxHeaderBytes(proxy); max > 0 && headerSize(r.Header) > max {
+		return utils.StatusError{
+			Code: http.StatusRequestHeaderFieldsTooLarge,
+			Err:  fmt.Errorf("request headers exceed %d bytes", max),
+		}
+	}
+
+	max := maxRequestBodyBytes(proxy)
+	if max <= 0 || r.Body == nil {
+		return nil
+	}
+	if r.ContentLength > max {
+		return errRequestBodyTooLarge
+	}
+	// the length of a body may not be known in advance
+	// so it is also enforced while the body is read
+	r.Body = &limitedBody{ReadCloser: r.Body, remaining: max}
+	return nil
+
+}
+
+// WithProxyDeadline returns a copy of ctx that expires once the request
+// timeout of an APIProxy has elapsed. The returned cancel function must be
+// called once the request is complete.
+func WithProxyDeadline(ctx context.Context, proxy *spec.APIProxy) (context.Context, context.CancelFunc) {
+	timeout := proxyTimeout(proxy)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func proxyTimeout(proxy *spec.APIProxy) time.Duration {
+	return proxy.Spec.Limits.GetTimeout(viper.GetDuration(config.FlagProxyUpstreamTimeout.GetLong()))
+}
+
+func connectTimeout(proxy *spec.APIProxy) time.Duration {
+	return proxy.Spec.Limits.GetConnectTimeout(viper.GetDuration(config.FlagProxyConnectTimeout.GetLong()))
+}
+
+func responseHeaderTimeout(proxy *spec.APIProxy) time.Duration {
+	return proxy.Spec.Limits.GetResponseHeaderTimeout(viper.GetDuration(config.FlagProxyResponseHeaderTimeout.GetLong()))
+}
+
+func maxRequestBodyBytes(proxy *spec.APIProxy) int64 {
+	return proxy.Spec.Limits.GetMaxRequestBodyBytes(viper.GetInt64(config.FlagProxyMaxRequestBodyBytes.GetLong()))
+}
+
+func maxBufferedBodyBytes() int64 {
+	return viper.GetInt64(config.FlagProxyMaxBufferedBodyBytes.GetLong())
+}
+
+func maxHeaderBytes(proxy *spec.APIProxy) int {
+	return proxy.Spec.Limits.GetMaxHeaderBytes(viper.GetInt(config.FlagProxyMaxHeaderBytes.GetLong()))
+}
+
+// headerSize approximates the size of headers as they were sent on the wire
+func headerSize(h http.Header) int {
+	size := 0
+	for k, v := range h {
+		for _, value := range v {
+			size += len(k) + len(value) + len(": \r\n")
+		}
+	}
+	return size
+}
+
+// limitedBody is a request body that fails once more than
+// a given number of bytes have been read from it
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  int32
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.isExceeded() {
+		return 0, errRequestBodyTooLarge
+	}
+	// one more byte than allowed is read to tell
+	// a body that is too large from one that is not
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		atomic.StoreInt32(&b.exceeded, 1)
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, errRequestBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) isExceeded() bool {
+	return atomic.LoadInt32(&b.exceeded) == 1
+}
+
+// bodyLimitExceeded reports whether more of the body of
+// a request was read than its APIProxy allows
+func bodyLimitExceeded(r *http.Request) bool {
+	b, ok := r.Body.(*limitedBody)
+	return ok && b.isExceeded()
+}
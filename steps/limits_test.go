@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsGetName(t *testing.T) {
+	assert.Equal(t, "Limits", LimitsStep{}.GetName())
+}
+
+func TestLimitsDo(t *testing.T) {
+	defer viper.Reset()
+	step := LimitsStep{}
+	span := opentracing.StartSpan("test span")
+
+	// no limits are enforced by default
+	r, _ := http.NewRequest("POST", "http://foo.bar.com/", strings.NewReader("test data"))
+	r.Header.Set("X-Foo", strings.Repeat("a", 100))
+	assert.Nil(t, step.Do(context.Background(), &spec.APIProxy{}, nil, nil, r, nil, span))
+	body, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "test data", string(body))
+
+	// the global limits apply to every proxy
+	viper.Set(config.FlagProxyMaxHeaderBytes.GetLong(), 50)
+	r, _ = http.NewRequest("POST", "http://foo.bar.com/", strings.NewReader("test data"))
+	r.Header.Set("X-Foo", strings.Repeat("a", 100))
+	err = step.Do(context.Background(), &spec.APIProxy{}, nil, nil, r, nil, span)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, err.(utils.Error).Status())
+
+	// unless they are overridden
+	proxy := &spec.APIProxy{Spec: spec.APIProxySpec{Limits: &spec.Limits{MaxHeaderBytes: 200, MaxRequestBodyBytes: 4}}}
+	err = step.Do(context.Background(), proxy, nil, nil, r, nil, span)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, err.(utils.Error).Status())
+
+	// a body of unknown length fails once it exceeds the limit
+	r, _ = http.NewRequest("POST", "http://foo.bar.com/", ioutil.NopCloser(strings.NewReader("test data")))
+	assert.Nil(t, step.Do(context.Background(), proxy, nil, nil, r, nil, span))
+	assert.False(t, bodyLimitExceeded(r))
+	body, err = ioutil.ReadAll(r.Body)
+	assert.Equal(t, errRequestBodyTooLarge, err)
+	assert.Equal(t, "test", string(body))
+	assert.True(t, bodyLimitExceeded(r))
+}
+
+func TestLimitedBody(t *testing.T) {
+	b := &limitedBody{ReadCloser: ioutil.NopCloser(bytes.NewReader([]byte("test"))), remaining: 4}
+	body, err := ioutil.ReadAll(b)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", string(body))
+	assert.False(t, b.isExceeded())
+
+	b = &limitedBody{ReadCloser: ioutil.NopCloser(bytes.NewReader([]byte("tests"))), remaining: 4}
+	_, err = ioutil.ReadAll(b)
+	assert.Equal(t, errRequestBodyTooLarge, err)
+	assert.True(t, b.isExceeded())
+	n, err := b.Read(make([]byte, 10))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, errRequestBodyTooLarge, err)
+}
+
+func TestHeaderSize(t *testing.T) {
+	assert.Equal(t, 0, headerSize(http.Header{}))
+	assert.Equal(t, 20, headerSize(http.Header{"Foo": []string{"bar", "baz"}}))
+}
+
+func TestWithProxyDeadline(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set(config.FlagProxyUpstreamTimeout.GetLong(), "0s")
+	ctx, cancel := WithProxyDeadline(context.Background(), &spec.APIProxy{})
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	viper.Set(config.FlagProxyUpstreamTimeout.GetLong(), "1m")
+	ctx, cancel = WithProxyDeadline(context.Background(), &spec.APIProxy{})
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// the timeout of an APIProxy takes precedence
+	proxy := &spec.APIProxy{Spec: spec.APIProxySpec{Limits: &spec.Limits{Timeout: "2m"}}}
+	ctx, cancel = WithProxyDeadline(context.Background(), proxy)
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), deadline, time.Second)
+}
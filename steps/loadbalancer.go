@@ -0,0 +1,146 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"github.com/northwesternmutual/kanali/spec"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// endpointBalancer keeps the state needed to balance
+// requests across the pods of upstream services
+type endpointBalancer struct {
+	mutex       sync.Mutex
+	next        map[string]int
+	outstanding map[string]int
+}
+
+var balancer = &endpointBalancer{next: map[string]int{}, outstanding: map[string]int{}}
+
+// pickEndpoint chooses the address of a ready pod backing the given service
+// port using the algorithm of the load balancer. If the service does not
+// have any ready pods, an empty string is returned.
+func pickEndpoint(lb *spec.LoadBalancer, svc spec.Service, port int64, r *http.Request) string {
+	untypedEndpoints, err := spec.EndpointsStore.Get(svc.Name, svc.Namespace)
+	if err != nil || untypedEndpoints == nil {
+		return ""
+	}
+	endpoints, _ := untypedEndpoints.(api.Endpoints)
+
+	addresses := healthyAddresses(svc, spec.EndpointAddresses(endpoints, svc, port))
+	if len(addresses) == 0 {
+		return ""
+	}
+
+	switch lb.Algorithm {
+	case spec.LoadBalancerLeastOutstanding:
+		return balancer.leastOutstanding(addresses)
+	case spec.LoadBalancerConsistentHash:
+		return consistentHash(addresses, hashKey(lb, r))
+	default:
+		return balancer.roundRobin(svc.Namespace+"/"+svc.Name, addresses)
+	}
+}
+
+func (b *endpointBalancer) roundRobin(service string, addresses []string) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	i := b.next[service] % len(addresses)
+	b.next[service] = i + 1
+	return addresses[i]
+}
+
+// leastOutstanding chooses the address with the fewest requests in flight.
+// Ties are broken starting from a random address so that an idle
+// service does not send every request to the same pod.
+func (b *endpointBalancer) leastOutstanding(addresses []string) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	start := rand.Intn(len(addresses))
+	best := addresses[start]
+	for i := 1; i < len(addresses); i++ {
+		address := addresses[(start+i)%len(addresses)]
+		if b.outstanding[address] < b.outstanding[best] {
+			best = address
+		}
+	}
+	return best
+}
+
+// acquire records a request in flight to an address. The returned
+// function must be called once the request has completed.
+func (b *endpointBalancer) acquire(address string) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.outstanding[address]++
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if b.outstanding[address]--; b.outstanding[address] <= 0 {
+			delete(b.outstanding, address)
+		}
+	}
+}
+
+// releasingBody is the body of an upstream response that releases the
+// slot its request holds with the load balancer once it has been closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the body and releases the slot of its request
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// consistentHash uses rendezvous hashing so that a key keeps being sent to
+// the same address and only the keys of a removed address are redistributed
+func consistentHash(addresses []string, key string) string {
+	var best string
+	var bestScore uint32
+	for _, address := range addresses {
+		if score := crc32.ChecksumIEEE([]byte(key + "/" + address)); best == "" || score > bestScore {
+			best, bestScore = address, score
+		}
+	}
+	return best
+}
+
+// hashKey returns the value of the configured header or,
+// if it is not present, the IP address of the client
+func hashKey(lb *spec.LoadBalancer, r *http.Request) string {
+	if lb.Header != "" {
+		if value := r.Header.Get(lb.Header); value != "" {
+			return value
+		}
+	}
+	return ClientIP(r)
+}
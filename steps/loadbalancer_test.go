@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestPickEndpoint(t *testing.T) {
+	defer spec.EndpointsStore.Clear()
+	spec.EndpointsStore.Clear()
+
+	svc := spec.Service{Name: "bar", Namespace: "foo"}
+	req, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	lb := &spec.LoadBalancer{Algorithm: spec.LoadBalancerRoundRobin}
+
+	assert.Equal(t, "", pickEndpoint(lb, svc, 8080, req))
+
+	spec.EndpointsStore.Set(api.Endpoints{
+		ObjectMeta: api.ObjectMeta{Name: "bar", Namespace: "foo"},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}, {IP: "10.0.0.3"}},
+				Ports:     []api.EndpointPort{{Port: 8080}},
+			},
+		},
+	})
+
+	first := pickEndpoint(lb, svc, 8080, req)
+	second := pickEndpoint(lb, svc, 8080, req)
+	third := pickEndpoint(lb, svc, 8080, req)
+	assert.NotEqual(t, first, second)
+	assert.NotEqual(t, second, third)
+	assert.NotEqual(t, first, third)
+	assert.Equal(t, first, pickEndpoint(lb, svc, 8080, req))
+
+	lb.Algorithm = spec.LoadBalancerConsistentHash
+	address := pickEndpoint(lb, svc, 8080, req)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, address, pickEndpoint(lb, svc, 8080, req))
+	}
+
+	lb.Algorithm = spec.LoadBalancerLeastOutstanding
+	releaseOne := balancer.acquire("10.0.0.1:8080")
+	releaseTwo := balancer.acquire("10.0.0.2:8080")
+	assert.Equal(t, "10.0.0.3:8080", pickEndpoint(lb, svc, 8080, req))
+	releaseOne()
+	releaseTwo()
+	assert.Equal(t, 0, len(balancer.outstanding))
+}
+
+func TestReleasingBody(t *testing.T) {
+	body := &releasingBody{
+		ReadCloser: ioutil.NopCloser(strings.NewReader("foo")),
+		release:    balancer.acquire("10.0.0.1:8080"),
+	}
+	assert.Equal(t, 1, balancer.outstanding["10.0.0.1:8080"])
+
+	// the request stays in flight until its body has been closed
+	data, _ := ioutil.ReadAll(body)
+	assert.Equal(t, "foo", string(data))
+	assert.Equal(t, 1, balancer.outstanding["10.0.0.1:8080"])
+
+	assert.Nil(t, body.Close())
+	assert.Nil(t, body.Close())
+	assert.Equal(t, 0, len(balancer.outstanding))
+}
+
+func TestConsistentHash(t *testing.T) {
+	addresses := []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"}
+	chosen := map[string]string{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		chosen[key] = consistentHash(addresses, key)
+	}
+
+	// removing an address only moves the keys that were sent to it
+	for key, address := range chosen {
+		if address != "10.0.0.3:8080" {
+			assert.Equal(t, address, consistentHash(addresses[:2], key))
+		}
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+
+	assert.Equal(t, "1.2.3.4", hashKey(&spec.LoadBalancer{}, req))
+	assert.Equal(t, "1.2.3.4", hashKey(&spec.LoadBalancer{Header: "X-User"}, req))
+	req.Header.Set("X-User", "frank")
+	assert.Equal(t, "frank", hashKey(&spec.LoadBalancer{Header: "X-User"}, req))
+}
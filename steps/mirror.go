@@ -0,0 +1,159 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/tracer"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+)
+
+// errMirrorBodyTooLarge is returned when a request body is too large to be
+// buffered for the mirror
+var errMirrorBodyTooLarge = errors.New("request body too large to mirror")
+
+// mirrorTraffic fires a copy of the request at the mirror service of an
+// APIProxy, if one is defined and the request falls within its sample.
+// The mirrored request runs in the background and its response is discarded.
+// Its latency and status are collected by the pending metrics of the request.
+func mirrorTraffic(ctx context.Context, proxy *spec.APIProxy, r *http.Request, span opentracing.Span) {
+	pending := metrics.PendingFromContext(ctx)
+	if pending == nil || !shouldMirror(proxy.Spec.Mirror) {
+		return
+	}
+
+	mirrorProxy := *proxy
+	mirrorProxy.Spec.Service = proxy.Spec.Mirror.Service
+	mirrorProxy.Spec.Backends = nil
+
+	mirrorRequest, err := createMirrorRequest(ctx, &mirrorProxy, r)
+	if err == errMirrorBodyTooLarge {
+		logrus.Debugf("request body exceeds %d bytes - the request will not be mirrored", maxBufferedBodyBytes())
+		return
+	} else if err != nil {
+		logrus.Warnf("error creating mirror request: %s", err.Error())
+		return
+	}
+
+	mirrorClient, err := createTargetClient(&mirrorProxy, r)
+	if err != nil {
+		logrus.Warnf("error creating mirror client: %s", err.Error())
+		return
+	}
+
+	// the mirror is not canceled along with the request
+	// but is still bounded by the timeout of the proxy
+	mirrorCtx, cancel := WithProxyDeadline(mirrorRequest.Context(), &mirrorProxy)
+	mirrorRequest = mirrorRequest.WithContext(mirrorCtx)
+
+	pending.Go(func() metrics.Metrics {
+		defer cancel()
+		return preformMirrorProxy(mirrorClient, mirrorRequest, span)
+	})
+}
+
+func shouldMirror(mirror *spec.Mirror) bool {
+	if mirror == nil || mirror.Percent <= 0 {
+		return false
+	}
+	return rand.Intn(100) < mirror.Percent
+}
+
+// createMirrorRequest creates a copy of the original request, targeting the
+// mirror service, that does not share a body or headers with the original
+// request and that will not be canceled along with it. The mirror carries
+// the same request ID as the original request.
+func createMirrorRequest(ctx context.Context, mirrorProxy *spec.APIProxy, originalRequest *http.Request) (*http.Request, error) {
+	var body []byte
+	if originalRequest.Body != nil {
+		buf, ok, err := bufferBody(originalRequest, maxBufferedBodyBytes())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errMirrorBodyTooLarge
+		}
+		body = buf
+		originalRequest.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	// the headers are copied by createTargetRequest
+	clone := *originalRequest
+	clone.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	detached := utils.WithRequestID(context.Background(), utils.RequestIDFromContext(ctx))
+	return createTargetRequest(detached, mirrorProxy, &clone)
+}
+
+// preformMirrorProxy may outlive the request being mirrored, so its
+// span follows from, rather than being a child of, the request span
+func preformMirrorProxy(client httpClient, request *http.Request, span opentracing.Span) metrics.Metrics {
+	sp := span.Tracer().StartSpan(fmt.Sprintf("MIRROR: %s %s",
+		request.Method,
+		utils.ComputeURLPath(request.URL),
+	), opentracing.FollowsFrom(span.Context()))
+	defer sp.Finish()
+
+	if err := sp.Tracer().Inject(
+		sp.Context(),
+		opentracing.TextMap,
+		opentracing.HTTPHeadersCarrier(request.Header),
+	); err != nil {
+		logrus.Error("error injecting headers")
+	}
+
+	tracer.HydrateSpanFromRequest(request, sp)
+
+	t0 := time.Now()
+	resp, err := client.Do(request)
+	m := metrics.Metrics{
+		metrics.Metric{Name: "mirror_target_time", Value: int(time.Now().Sub(t0) / time.Millisecond), Index: false},
+	}
+	if err != nil {
+		logrus.Debugf("error mirroring request: %s", err.Error())
+		sp.SetTag(tracer.Error, err.Error())
+		m.Add(metrics.Metric{Name: "mirror_response_code", Value: "error", Index: true})
+		return m
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		logrus.Debugf("error discarding mirror response: %s", err.Error())
+	}
+
+	sp.SetTag(tracer.HTTPResponseStatusCode, resp.StatusCode)
+	m.Add(metrics.Metric{Name: "mirror_response_code", Value: strconv.Itoa(resp.StatusCode), Index: true})
+	return m
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestShouldMirror(t *testing.T) {
+	assert.False(t, shouldMirror(nil))
+	assert.False(t, shouldMirror(&spec.Mirror{Percent: 0}))
+	assert.True(t, shouldMirror(&spec.Mirror{Percent: 100}))
+}
+
+func TestCreateMirrorRequest(t *testing.T) {
+	defer spec.ServiceStore.Clear()
+	spec.ServiceStore.Set(spec.Service{
+		Name:      "shadow",
+		Namespace: "foo",
+		Port:      8080,
+	})
+
+	mirrorProxy := &spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "exampleAPIProxyOne",
+			Namespace: "foo",
+		},
+		Spec: spec.APIProxySpec{
+			Path:   "/api/v1/accounts",
+			Target: "/",
+			Service: spec.Service{
+				Name:      "shadow",
+				Namespace: "foo",
+				Port:      8080,
+			},
+		},
+	}
+
+	originalReq, _ := http.NewRequest("POST", "http://foo.bar.com/api/v1/accounts", bytes.NewReader([]byte("test data")))
+	originalReq.Header.Set("apikey", "abc123")
+
+	mirrorReq, err := createMirrorRequest(utils.WithRequestID(context.Background(), "abc-123"), mirrorProxy, originalReq)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc-123", mirrorReq.Header.Get("X-Request-ID"))
+	assert.Equal(t, "", originalReq.Header.Get("X-Request-ID"))
+	assert.Equal(t, "shadow.foo.svc.cluster.local:8080", mirrorReq.URL.Host)
+	assert.Equal(t, "", mirrorReq.Header.Get("apikey"))
+	assert.Equal(t, "abc123", originalReq.Header.Get("apikey"))
+	assert.Nil(t, mirrorReq.Context().Done())
+
+	mirrorBody, _ := ioutil.ReadAll(mirrorReq.Body)
+	originalBody, _ := ioutil.ReadAll(originalReq.Body)
+	assert.Equal(t, "test data", string(mirrorBody))
+	assert.Equal(t, "test data", string(originalBody))
+
+	// bodies too large to buffer are not mirrored but are still sent in full
+	viper.Set(config.FlagProxyMaxBufferedBodyBytes.GetLong(), 4)
+	defer viper.Set(config.FlagProxyMaxBufferedBodyBytes.GetLong(), config.FlagProxyMaxBufferedBodyBytes.Value)
+	originalReq, _ = http.NewRequest("POST", "http://foo.bar.com/api/v1/accounts", bytes.NewReader([]byte("test data")))
+	_, err = createMirrorRequest(context.Background(), mirrorProxy, originalReq)
+	assert.Equal(t, errMirrorBodyTooLarge, err)
+	originalBody, _ = ioutil.ReadAll(originalReq.Body)
+	assert.Equal(t, "test data", string(originalBody))
+
+	mirrorProxy.Spec.Service.Name = "missing"
+	_, err = createMirrorRequest(context.Background(), mirrorProxy, originalReq)
+	assert.Equal(t, "no matching services", err.Error())
+}
+
+func TestPreformMirrorProxy(t *testing.T) {
+	mockTracer := mocktracer.New()
+	parent := mockTracer.StartSpan("parent")
+	parent.Finish()
+
+	reqOne, _ := http.NewRequest("GET", "https://foo.bar.com/", bytes.NewReader([]byte("test data")))
+	m := preformMirrorProxy(&mockHTTPClient{}, reqOne, parent)
+	assert.Equal(t, 2, len(m))
+	assert.False(t, m.Get("mirror_target_time").Index)
+	assert.Equal(t, "200", m.Get("mirror_response_code").Value)
+	assert.True(t, m.Get("mirror_response_code").Index)
+
+	reqTwo, _ := http.NewRequest("GET", "https://foo.bar.com/error", bytes.NewReader([]byte("test data")))
+	m = preformMirrorProxy(&mockHTTPClient{}, reqTwo, parent)
+	assert.Equal(t, "error", m.Get("mirror_response_code").Value)
+}
+
+func TestMirrorTraffic(t *testing.T) {
+	mockTracer := mocktracer.New()
+	span := mockTracer.StartSpan("test span")
+	defer span.Finish()
+
+	proxy := &spec.APIProxy{
+		Spec: spec.APIProxySpec{
+			Path:   "/api/v1/accounts",
+			Mirror: &spec.Mirror{Service: spec.Service{Name: "missing"}, Percent: 100},
+		},
+	}
+	req, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts", bytes.NewReader([]byte("test data")))
+
+	// without pending metrics there is nowhere to record the mirror
+	mirrorTraffic(context.Background(), proxy, req, span)
+
+	ctx, pending := metrics.WithPending(context.Background())
+	mirrorTraffic(ctx, proxy, req, span)
+	assert.Equal(t, 0, len(pending.Wait()))
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, "test data", string(body))
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/northwesternmutual/kanali/metrics"
 	"github.com/northwesternmutual/kanali/plugins"
 	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
 	"github.com/opentracing/opentracing-go"
 )
 
@@ -46,11 +47,17 @@ func (step PluginsOnRequestStep) GetName() string {
 func (step PluginsOnRequestStep) Do(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, trace opentracing.Span) error {
 
 	for _, plugin := range proxy.Spec.Plugins {
+		// a plugin may take long enough for the
+		// request to be canceled or to time out
+		if err := utils.ContextError(ctx); err != nil {
+			return err
+		}
 		p, err := plugins.GetPlugin(plugin)
 		if err != nil {
 			return err
 		}
 		if err := doOnRequest(ctx, m, plugin.Name, *proxy, r, trace, *p); err != nil {
+			m.Add(metrics.Metric{Name: "plugin_error", Value: plugin.Name, Index: false})
 			return err
 		}
 	}
@@ -40,3 +40,15 @@ func TestDoOnRequest(t *testing.T) {
 	assert.Equal(t, doOnRequest(context.Background(), nil, "name", spec.APIProxy{}, nil, opentracing.StartSpan("test span"), fakeErrorPlugin{}).Error(), "error")
 	assert.Nil(t, doOnRequest(context.Background(), nil, "name", spec.APIProxy{}, nil, opentracing.StartSpan("test span"), fakeSuccessPlugin{}))
 }
+
+func TestPluginsOnRequestDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	proxy := &spec.APIProxy{
+		Spec: spec.APIProxySpec{
+			Plugins: []spec.Plugin{{Name: "apikey"}},
+		},
+	}
+	err := PluginsOnRequestStep{}.Do(ctx, proxy, nil, nil, nil, nil, opentracing.StartSpan("test span"))
+	assert.Equal(t, "client closed request", err.Error())
+}
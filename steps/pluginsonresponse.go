@@ -51,6 +51,7 @@ func (step PluginsOnResponseStep) Do(ctx context.Context, proxy *spec.APIProxy,
 			return err
 		}
 		if err := doOnResponse(ctx, m, plugin.Name, *proxy, r, resp, trace, *p); err != nil {
+			m.Add(metrics.Metric{Name: "plugin_error", Value: plugin.Name, Index: false})
 			return err
 		}
 	}
@@ -26,9 +26,10 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"math/rand"
 	"net/http"
 	"net/url"
-	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/northwesternmutual/kanali/config"
@@ -41,6 +42,9 @@ import (
 	"k8s.io/kubernetes/pkg/api"
 )
 
+// unknownBackend names an upstream service that could not be resolved
+const unknownBackend = "unknown"
+
 type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -57,30 +61,64 @@ func (step ProxyPassStep) GetName() string {
 // Do executes the logic of the ProxyPassStep step
 func (step ProxyPassStep) Do(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, span opentracing.Span) error {
 
-	targetRequest, err := createTargetRequest(proxy, r)
+	// the mirror is started first as it needs
+	// to read the body of the original request
+	mirrorTraffic(ctx, proxy, r, span)
+
+	// the remainder of this step only needs to know about the
+	// single backend service chosen for this request
+	proxy, backend := selectUpstream(proxy, m, r, span)
+
+	targetRequest, err := createTargetRequest(ctx, proxy, r)
 	if err != nil {
 		return err
 	}
+	m.Add(metrics.Metric{Name: "upstream_host", Value: targetRequest.URL.Host, Index: false})
 
 	targetClient, err := createTargetClient(proxy, r)
 	if err != nil {
 		return err
 	}
 
-	targetResponse, err := preformTargetProxy(targetClient, targetRequest, m, span)
+	if err := breakerAllow(proxy, backend, span); err != nil {
+		return err
+	}
+
+	// a request is in flight until the body of its response has been
+	// written to the client, which happens after this step has returned
+	release := func() {}
+	if proxy.Spec.LoadBalancer != nil {
+		release = balancer.acquire(targetRequest.URL.Host)
+	}
+
+	targetResponse, err := retryTargetProxy(targetClient, targetRequest, proxy.Spec.Retry, m, span)
+	// neither a client that goes away nor one that sends too large
+	// a body says anything about the health of the upstream service
+	if ctx.Err() == context.Canceled || bodyLimitExceeded(r) {
+		breakerCancel(proxy, backend)
+	} else {
+		breakerRecord(proxy, backend, targetResponse, err, span)
+		recordEndpointHealth(proxy, targetRequest.URL.Host, targetResponse, err)
+	}
 	if err != nil {
+		release()
+		if bodyLimitExceeded(r) {
+			return errRequestBodyTooLarge
+		}
 		return err
 	}
 
+	targetResponse.Body = &releasingBody{ReadCloser: targetResponse.Body, release: release}
 	*resp = *targetResponse
 	return nil
 
 }
 
-func createTargetRequest(proxy *spec.APIProxy, originalRequest *http.Request) (*http.Request, error) {
-	targetRequest := &http.Request{}
-	*targetRequest = *originalRequest
+func createTargetRequest(ctx context.Context, proxy *spec.APIProxy, originalRequest *http.Request) (*http.Request, error) {
+	// the upstream request is canceled along with the context of the flow
+	targetRequest := originalRequest.WithContext(ctx)
 	targetRequest.RequestURI = ""
+	targetRequest.Header = cloneHeader(originalRequest.Header)
 
 	u, err := getTargetURL(proxy, originalRequest)
 	if err != nil {
@@ -90,45 +128,33 @@ func createTargetRequest(proxy *spec.APIProxy, originalRequest *http.Request) (*
 	targetRequest.URL = u
 
 	targetRequest.Header.Del("apikey")
-	targetRequest.Header.Add("X-Forwarded-For", originalRequest.RemoteAddr)
+	sanitizeRequestHeaders(originalRequest, targetRequest.Header)
+	setForwardingHeaders(originalRequest, targetRequest.Header)
+	if id := utils.RequestIDFromContext(ctx); id != "" {
+		targetRequest.Header.Set(utils.RequestIDHeader, id)
+	}
 
 	return targetRequest, nil
 }
 
 func createTargetClient(proxy *spec.APIProxy, originalRequest *http.Request) (*http.Client, error) {
-	client := &http.Client{
-		Timeout: viper.GetDuration(config.FlagProxyUpstreamTimeout.GetLong()),
-	}
-
-	transport, err := configureTargetTLS(proxy, originalRequest)
+	transport, err := getTargetTransport(proxy, originalRequest)
 	if err != nil {
 		return nil, err
 	}
 
-	if transport != nil {
-		client.Transport = transport
-	}
-
-	return client, nil
+	// the request is bounded by the deadline of its context, see WithProxyDeadline,
+	// so that retries and streamed responses share a single timeout
+	return &http.Client{
+		Transport: transport,
+	}, nil
 }
 
-func configureTargetTLS(proxy *spec.APIProxy, originalRequest *http.Request) (*http.Transport, error) {
-
-	untypedSecret, err := spec.SecretStore.Get(proxy.GetSSLCertificates(originalRequest.Host).SecretName, proxy.ObjectMeta.Namespace)
-	if err != nil {
-		return nil, utils.StatusError{Code: http.StatusInternalServerError, Err: err}
-	}
-
-	if untypedSecret == nil {
-		logrus.Debug("TLS not configured for this proxy")
-		return nil, nil
-	}
+func configureTargetTLS(secret api.Secret) (*tls.Config, error) {
 
 	tlsConfig := &tls.Config{}
 	caCertPool := x509.NewCertPool()
 
-	secret, _ := untypedSecret.(api.Secret)
-
 	// server side tls must be configured
 	cert, err := spec.X509KeyPair(secret)
 	if err != nil {
@@ -157,11 +183,11 @@ func configureTargetTLS(proxy *spec.APIProxy, originalRequest *http.Request) (*h
 
 	tlsConfig.RootCAs = caCertPool
 	tlsConfig.BuildNameToCertificate()
-	return &http.Transport{TLSClientConfig: tlsConfig}, nil
+	return tlsConfig, nil
 
 }
 
-func preformTargetProxy(client httpClient, request *http.Request, m *metrics.Metrics, span opentracing.Span) (*http.Response, error) {
+func preformTargetProxy(client httpClient, request *http.Request, span opentracing.Span) (*http.Response, error) {
 	if err := span.Tracer().Inject(
 		span.Context(),
 		opentracing.TextMap,
@@ -170,7 +196,7 @@ func preformTargetProxy(client httpClient, request *http.Request, m *metrics.Met
 		logrus.Error("error injecting headers")
 	}
 
-	sp := opentracing.StartSpan(fmt.Sprintf("%s %s",
+	sp := span.Tracer().StartSpan(fmt.Sprintf("%s %s",
 		request.Method,
 		utils.ComputeURLPath(request.URL),
 	), opentracing.ChildOf(span.Context()))
@@ -178,21 +204,108 @@ func preformTargetProxy(client httpClient, request *http.Request, m *metrics.Met
 
 	tracer.HydrateSpanFromRequest(request, sp)
 
-	t0 := time.Now()
 	resp, err := client.Do(request)
 	if err != nil {
+		if ctxErr := utils.ContextError(request.Context()); ctxErr != nil {
+			sp.SetTag(tracer.Error, true)
+			sp.SetTag(tracer.HTTPResponseStatusCode, ctxErr.Status())
+			return nil, ctxErr
+		}
 		return nil, utils.StatusError{Code: http.StatusInternalServerError, Err: err}
 	}
 
-	m.Add(
-		metrics.Metric{Name: "total_target_time", Value: int(time.Now().Sub(t0) / time.Millisecond), Index: false},
-	)
-
 	tracer.HydrateSpanFromResponse(resp, sp)
 
 	return resp, nil
 }
 
+// selectUpstream returns a copy of an APIProxy whose service is the backend
+// chosen for this request, along with the name of that backend
+func selectUpstream(proxy *spec.APIProxy, m *metrics.Metrics, r *http.Request, span opentracing.Span) (*spec.APIProxy, string) {
+	upstream := *proxy
+	upstream.Spec.Service = resolveService(selectBackend(proxy, r), r.Header)
+
+	backend := backendName(upstream.Spec.Service)
+	span.SetTag(tracer.KanaliBackendName, backend)
+	m.Add(metrics.Metric{Name: "upstream_backend", Value: backend, Index: true})
+
+	return &upstream, backend
+}
+
+// selectBackend chooses the service that a request will be proxied to. If
+// weighted backends are defined, one is chosen at random in proportion to
+// its weight unless stickiness is configured and the request carries the
+// sticky header or cookie, in which case its value determines the backend.
+func selectBackend(proxy *spec.APIProxy, r *http.Request) spec.Service {
+	total := 0
+	for _, backend := range proxy.Spec.Backends {
+		total += backend.Weight
+	}
+	if total <= 0 {
+		return proxy.Spec.Service
+	}
+
+	var pick int
+	if key := stickyKey(proxy.Spec.Stickiness, r); key != "" {
+		pick = int(crc32.ChecksumIEEE([]byte(key)) % uint32(total))
+	} else {
+		pick = rand.Intn(total)
+	}
+
+	for _, backend := range proxy.Spec.Backends {
+		if pick < backend.Weight {
+			return backend.Service
+		}
+		pick -= backend.Weight
+	}
+	return proxy.Spec.Service
+}
+
+func stickyKey(stickiness *spec.Stickiness, r *http.Request) string {
+	if stickiness == nil {
+		return ""
+	}
+	if stickiness.Header != "" {
+		if value := r.Header.Get(stickiness.Header); value != "" {
+			return value
+		}
+	}
+	if stickiness.Cookie != "" {
+		if cookie, err := r.Cookie(stickiness.Cookie); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// resolveService names a service discovered by labels after the matching
+// Kubernetes service so that every part of a request refers to the same one
+func resolveService(svc spec.Service, headers http.Header) spec.Service {
+	if svc.Name != "" {
+		return svc
+	}
+	untypedSvc, err := spec.ServiceStore.Get(svc, headers)
+	if err != nil || untypedSvc == nil {
+		return svc
+	}
+	resolved, _ := untypedSvc.(spec.Service)
+	svc.Name = resolved.Name
+	return svc
+}
+
+// backendName identifies a resolved upstream service for metrics and tracing
+func backendName(svc spec.Service) string {
+	if svc.Name == "" {
+		return unknownBackend
+	}
+	return svc.Name
+}
+
+// serviceHost returns the cluster DNS name of a Kubernetes service
+func serviceHost(name, namespace string) string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", name, namespace)
+}
+
 func getTargetURL(proxy *spec.APIProxy, originalRequest *http.Request) (*url.URL, error) {
 
 	scheme := "http"
@@ -209,10 +322,7 @@ func getTargetURL(proxy *spec.APIProxy, originalRequest *http.Request) (*url.URL
 
 	svc, _ := untypedSvc.(spec.Service)
 
-	uri := fmt.Sprintf("%s.%s.svc.cluster.local",
-		svc.Name,
-		proxy.ObjectMeta.Namespace,
-	)
+	uri := serviceHost(svc.Name, proxy.ObjectMeta.Namespace)
 
 	if viper.GetBool(config.FlagProxyEnableClusterIP.GetLong()) {
 		uri = svc.ClusterIP
@@ -223,12 +333,22 @@ func getTargetURL(proxy *spec.APIProxy, originalRequest *http.Request) (*url.URL
 		return nil, err
 	}
 
+	host := fmt.Sprintf("%s:%d",
+		uri,
+		proxy.Spec.Service.Port,
+	)
+
+	if proxy.Spec.LoadBalancer != nil {
+		if address := pickEndpoint(proxy.Spec.LoadBalancer, svc, proxy.Spec.Service.Port, originalRequest); address != "" {
+			host = address
+		} else {
+			logrus.Warnf("no ready endpoints found for service %s in namespace %s, falling back to %s", svc.Name, svc.Namespace, host)
+		}
+	}
+
 	return &url.URL{
-		Scheme: scheme,
-		Host: fmt.Sprintf("%s:%d",
-			uri,
-			proxy.Spec.Service.Port,
-		),
+		Scheme:     scheme,
+		Host:       host,
 		Path:       u.Path,
 		RawPath:    u.RawPath,
 		ForceQuery: originalRequest.URL.ForceQuery,
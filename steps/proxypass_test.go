@@ -22,6 +22,7 @@ package steps
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
 	"errors"
 	"net/http"
@@ -31,8 +32,8 @@ import (
 	"time"
 
 	"github.com/northwesternmutual/kanali/config"
-	"github.com/northwesternmutual/kanali/metrics"
 	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/spf13/viper"
@@ -69,21 +70,18 @@ func TestProxyPassGetName(t *testing.T) {
 }
 
 func TestPreformTargetProxy(t *testing.T) {
-	testMetrics := &metrics.Metrics{}
 	mockTracer := mocktracer.New()
 	testReqOne, _ := http.NewRequest("GET", "https://foo.bar.com/?foo=bar", bytes.NewReader([]byte("test data")))
 	testReqTwo, _ := http.NewRequest("GET", "https://foo.bar.com/error", bytes.NewReader([]byte("test data")))
 
 	testSpanOne := mockTracer.StartSpan("test span one")
-	resp, err := preformTargetProxy(&mockHTTPClient{}, testReqOne, testMetrics, testSpanOne)
+	resp, err := preformTargetProxy(&mockHTTPClient{}, testReqOne, testSpanOne)
 	testSpanOne.Finish()
 	assert.Nil(t, err)
 	assert.Equal(t, resp.StatusCode, 200)
-	assert.Equal(t, (*testMetrics)[0].Name, "total_target_time")
-	assert.False(t, (*testMetrics)[0].Index)
 
 	testSpanTwo := mockTracer.StartSpan("test span two")
-	_, err = preformTargetProxy(&mockHTTPClient{}, testReqTwo, testMetrics, testSpanTwo)
+	_, err = preformTargetProxy(&mockHTTPClient{}, testReqTwo, testSpanTwo)
 	testSpanTwo.Finish()
 	assert.Equal(t, err.Error(), "expected error")
 }
@@ -107,7 +105,7 @@ func TestCreateTargetRequest(t *testing.T) {
 		},
 	}
 
-	_, err := createTargetRequest(proxyOne, originalReq)
+	_, err := createTargetRequest(context.Background(), proxyOne, originalReq)
 	assert.Equal(t, err.Error(), "no matching services")
 
 	spec.ServiceStore.Set(spec.Service{
@@ -117,7 +115,17 @@ func TestCreateTargetRequest(t *testing.T) {
 		Port:      8080,
 	})
 
-	targetReq, _ := createTargetRequest(proxyOne, originalReq)
+	originalReq.RemoteAddr = "1.2.3.4:5678"
+	originalReq.Header.Set("apikey", "abc123")
+	originalReq.Header.Set("Connection", "close")
+	targetReq, _ := createTargetRequest(utils.WithRequestID(context.Background(), "abc-123"), proxyOne, originalReq)
+	assert.Equal(t, "abc-123", targetReq.Header.Get("X-Request-ID"))
+	assert.Equal(t, "1.2.3.4", targetReq.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "", targetReq.Header.Get("apikey"))
+	assert.Equal(t, "", targetReq.Header.Get("Connection"))
+	// the headers of the original request are left untouched
+	assert.Equal(t, "abc123", originalReq.Header.Get("apikey"))
+	assert.Equal(t, "", originalReq.Header.Get("X-Forwarded-For"))
 	assert.Equal(t, targetReq.URL, &url.URL{
 		Scheme:     "http",
 		Host:       "bar.foo.svc.cluster.local:8080",
@@ -146,42 +154,35 @@ func TestCreateTargetClient(t *testing.T) {
 		},
 	}
 
-	duration, _ := time.ParseDuration("1m0s")
-	viper.SetDefault(config.FlagProxyUpstreamTimeout.GetLong(), duration)
+	// requests are bounded by the deadline of their context rather than by the client
 	cli, err := createTargetClient(proxyOne, originalReq)
-	assert.Equal(t, cli.Timeout, viper.GetDuration(config.FlagProxyUpstreamTimeout.GetLong()))
+	assert.Equal(t, time.Duration(0), cli.Timeout)
 	assert.Nil(t, err)
-	assert.Nil(t, cli.Transport)
+	assert.NotNil(t, cli.Transport)
 }
 
 func TestConfigureTargetTLS(t *testing.T) {
-	originalReq, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts", nil)
+	testSecret := getTestTLSSecret()
+	cert, _ := spec.X509KeyPair(testSecret)
 
-	proxyOne := &spec.APIProxy{
-		ObjectMeta: api.ObjectMeta{
-			Name:      "exampleAPIProxyOne",
-			Namespace: "foo",
-		},
-		Spec: spec.APIProxySpec{
-			Path:   "/api/v1/accounts",
-			Target: "/",
-			Service: spec.Service{
-				Name:      "bar",
-				Namespace: "foo",
-				Port:      8080,
-			},
-		},
-	}
+	tlsConfig, err := configureTargetTLS(testSecret)
+	assert.Nil(t, err)
+	assert.Equal(t, tlsConfig.Certificates[0], *cert)
+	assert.Equal(t, tlsConfig.RootCAs, x509.NewCertPool())
+
+	viper.SetDefault(config.FlagProxyTLSCommonNameValidation.GetLong(), false)
+	defer viper.Reset()
 
-	transport, err := configureTargetTLS(proxyOne, originalReq)
+	tlsConfig, err = configureTargetTLS(testSecret)
 	assert.Nil(t, err)
-	assert.Nil(t, transport)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
 
-	proxyOne.Spec.SSL = spec.SSL{
-		SecretName: "mysecretname",
-	}
+	_, err = configureTargetTLS(api.Secret{})
+	assert.NotNil(t, err)
+}
 
-	testSecret := api.Secret{
+func getTestTLSSecret() api.Secret {
+	return api.Secret{
 		ObjectMeta: api.ObjectMeta{
 			Name:      "mysecretname",
 			Namespace: "foo",
@@ -236,22 +237,6 @@ GbTccols89QEcA4=
 -----END CERTIFICATE-----`),
 		},
 	}
-
-	spec.SecretStore.Set(testSecret)
-	cert, _ := spec.X509KeyPair(testSecret)
-
-	transport, err = configureTargetTLS(proxyOne, originalReq)
-	assert.Nil(t, err)
-	assert.Equal(t, transport.TLSClientConfig.Certificates[0], *cert)
-	assert.Equal(t, transport.TLSClientConfig.RootCAs, x509.NewCertPool())
-
-	viper.SetDefault(config.FlagProxyTLSCommonNameValidation.GetLong(), false)
-	defer viper.Reset()
-
-	transport, err = configureTargetTLS(proxyOne, originalReq)
-	assert.Nil(t, err)
-	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
-
 }
 
 func TestGetTargetURL(t *testing.T) {
@@ -334,3 +319,56 @@ func TestGetTargetURL(t *testing.T) {
 		ForceQuery: false,
 	})
 }
+
+func TestSelectBackend(t *testing.T) {
+	stable := spec.Service{Name: "stable", Namespace: "foo", Port: 8080}
+	canary := spec.Service{Name: "canary", Namespace: "foo", Port: 8080}
+	proxyOne := &spec.APIProxy{
+		Spec: spec.APIProxySpec{
+			Service: spec.Service{Name: "default", Namespace: "foo", Port: 8080},
+		},
+	}
+	req, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts", nil)
+
+	assert.Equal(t, proxyOne.Spec.Service, selectBackend(proxyOne, req))
+
+	proxyOne.Spec.Backends = []spec.Backend{{Service: stable, Weight: 0}, {Service: canary, Weight: 0}}
+	assert.Equal(t, proxyOne.Spec.Service, selectBackend(proxyOne, req))
+
+	proxyOne.Spec.Backends = []spec.Backend{{Service: stable, Weight: 0}, {Service: canary, Weight: 10}}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, canary, selectBackend(proxyOne, req))
+	}
+
+	proxyOne.Spec.Backends = []spec.Backend{{Service: stable, Weight: 90}, {Service: canary, Weight: 10}}
+	proxyOne.Spec.Stickiness = &spec.Stickiness{Header: "X-User", Cookie: "session"}
+	req.Header.Set("X-User", "frank")
+	first := selectBackend(proxyOne, req)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, selectBackend(proxyOne, req))
+	}
+
+	req.Header.Del("X-User")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+	first = selectBackend(proxyOne, req)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, selectBackend(proxyOne, req))
+	}
+}
+
+func TestResolveService(t *testing.T) {
+	spec.ServiceStore.Clear()
+	defer spec.ServiceStore.Clear()
+	spec.ServiceStore.Set(spec.Service{
+		Name:      "canary",
+		Namespace: "foo",
+		Labels:    spec.Labels{{Name: "release", Value: "canary"}},
+	})
+
+	assert.Equal(t, "stable", backendName(resolveService(spec.Service{Name: "stable", Namespace: "foo"}, nil)))
+	canary := resolveService(spec.Service{Namespace: "foo", Port: 8080, Labels: spec.Labels{{Name: "release", Value: "canary"}}}, nil)
+	assert.Equal(t, "canary", canary.Name)
+	assert.Equal(t, int64(8080), canary.Port)
+	assert.Equal(t, "canary", backendName(canary))
+	assert.Equal(t, "unknown", backendName(resolveService(spec.Service{Namespace: "foo", Labels: spec.Labels{{Name: "release", Value: "stable"}}}, nil)))
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+)
+
+// retryTargetProxy performs the upstream request, retrying it according
+// to the retry policy of an APIProxy. Each attempt is recorded as a child
+// span of the given span while the number of attempts and the time spent
+// across all of them are recorded as metrics.
+func retryTargetProxy(client httpClient, request *http.Request, policy *spec.Retry, m *metrics.Metrics, span opentracing.Span) (*http.Response, error) {
+
+	maxAttempts := 1
+	if policy != nil && policy.MaxAttempts > 1 && policy.IsRetryableMethod(request.Method) {
+		maxAttempts = policy.MaxAttempts
+	}
+
+	// a request body can only be read once so it
+	// must be buffered if the request may be replayed
+	var body []byte
+	if maxAttempts > 1 && request.Body != nil {
+		buf, ok, err := bufferBody(request, maxBufferedBodyBytes())
+		if err != nil {
+			return nil, utils.StatusError{Code: http.StatusInternalServerError, Err: err}
+		}
+		if ok {
+			body = buf
+		} else {
+			logrus.Debugf("request body exceeds %d bytes - the request will not be retried", maxBufferedBodyBytes())
+			maxAttempts = 1
+		}
+	}
+
+	t0 := time.Now()
+	record := func(attempts int) {
+		m.Add(
+			metrics.Metric{Name: "upstream_attempts", Value: attempts, Index: false},
+			metrics.Metric{Name: "total_target_time", Value: int(time.Now().Sub(t0) / time.Millisecond), Index: false},
+		)
+	}
+
+	var deadline time.Time
+	if maxAttempts > 1 && policy.GetBudget() > 0 {
+		deadline = time.Now().Add(policy.GetBudget())
+	}
+
+	for attempt := 1; ; attempt++ {
+		if body != nil {
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := preformTargetProxy(client, request, span)
+		if attempt >= maxAttempts || request.Context().Err() != nil || !isRetryable(policy, resp, err) {
+			record(attempt)
+			return resp, err
+		}
+
+		wait := retryBackoff(policy, attempt)
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			logrus.Debugf("retry budget exhausted after %d attempts", attempt)
+			record(attempt)
+			return resp, err
+		}
+
+		// the response of an attempt that is going to be
+		// retried must be discarded to release its connection
+		if resp != nil {
+			if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+				logrus.Debugf("error discarding upstream response: %s", err.Error())
+			}
+			if err := resp.Body.Close(); err != nil {
+				logrus.Debugf("error closing upstream response: %s", err.Error())
+			}
+		}
+
+		logrus.Debugf("retrying upstream request in %s after attempt %d", wait, attempt)
+		select {
+		case <-time.After(wait):
+		case <-request.Context().Done():
+			record(attempt)
+			return nil, utils.ContextError(request.Context())
+		}
+	}
+
+}
+
+func isRetryable(policy *spec.Retry, resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return policy.IsRetryableStatus(resp.StatusCode)
+}
+
+// retryBackoff computes an exponential backoff, capped at the maximum
+// backoff, with jitter so that concurrent retries are spread out
+func retryBackoff(policy *spec.Retry, attempt int) time.Duration {
+	d := policy.GetBackoff()
+	max := policy.GetMaxBackoff()
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// bufferBody reads a request body into memory so that it can be replayed. If
+// the body is larger than limit bytes, it is left to be streamed and false is
+// returned. A limit of zero means that the body is always buffered.
+func bufferBody(request *http.Request, limit int64) ([]byte, bool, error) {
+	if limit <= 0 {
+		buf, err := ioutil.ReadAll(request.Body)
+		return buf, err == nil, err
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(request.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(buf)) <= limit {
+		return buf, true, nil
+	}
+	// the bytes already read must still be sent upstream
+	request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), request.Body), request.Body}
+	return nil, false, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRetryHTTPClient struct {
+	responses []int
+	bodies    []string
+}
+
+func (cli *mockRetryHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(req.Body)
+	cli.bodies = append(cli.bodies, string(body))
+
+	code := cli.responses[0]
+	if len(cli.responses) > 1 {
+		cli.responses = cli.responses[1:]
+	}
+	if code == 0 {
+		return nil, errors.New("connection refused")
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	responseRecorder.WriteHeader(code)
+	return responseRecorder.Result(), nil
+}
+
+func TestRetryTargetProxy(t *testing.T) {
+	mockTracer := mocktracer.New()
+	span := mockTracer.StartSpan("test span")
+	policy := &spec.Retry{MaxAttempts: 3, Backoff: "1ms", MaxBackoff: "2ms"}
+
+	// no policy means a single attempt
+	cli := &mockRetryHTTPClient{responses: []int{0}}
+	req, _ := http.NewRequest("GET", "http://foo.bar.com/", bytes.NewReader([]byte("test data")))
+	m := &metrics.Metrics{}
+	_, err := retryTargetProxy(cli, req, nil, m, span)
+	assert.Equal(t, "connection refused", err.Error())
+	assert.Equal(t, 1, m.Get("upstream_attempts").Value)
+
+	// connection errors and retryable status codes are retried and the body is replayed
+	cli = &mockRetryHTTPClient{responses: []int{0, 503, 200}}
+	req, _ = http.NewRequest("PUT", "http://foo.bar.com/", bytes.NewReader([]byte("test data")))
+	m = &metrics.Metrics{}
+	resp, err := retryTargetProxy(cli, req, policy, m, span)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, m.Get("upstream_attempts").Value)
+	assert.Equal(t, []string{"test data", "test data", "test data"}, cli.bodies)
+	assert.Equal(t, 2, len(*m), "the time spent upstream is recorded once per request")
+	assert.NotNil(t, m.Get("total_target_time"))
+
+	// attempts are capped
+	cli = &mockRetryHTTPClient{responses: []int{503}}
+	req, _ = http.NewRequest("GET", "http://foo.bar.com/", bytes.NewReader(nil))
+	m = &metrics.Metrics{}
+	resp, err = retryTargetProxy(cli, req, policy, m, span)
+	assert.Nil(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 3, m.Get("upstream_attempts").Value)
+
+	// non retryable status codes are not retried
+	cli = &mockRetryHTTPClient{responses: []int{500, 200}}
+	req, _ = http.NewRequest("GET", "http://foo.bar.com/", bytes.NewReader(nil))
+	m = &metrics.Metrics{}
+	resp, _ = retryTargetProxy(cli, req, policy, m, span)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Equal(t, 1, m.Get("upstream_attempts").Value)
+
+	// non idempotent methods are not retried by default
+	cli = &mockRetryHTTPClient{responses: []int{503, 200}}
+	req, _ = http.NewRequest("POST", "http://foo.bar.com/", bytes.NewReader([]byte("test data")))
+	m = &metrics.Metrics{}
+	resp, _ = retryTargetProxy(cli, req, policy, m, span)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 1, m.Get("upstream_attempts").Value)
+
+	// retries stop once the budget is exhausted
+	cli = &mockRetryHTTPClient{responses: []int{503, 200}}
+	req, _ = http.NewRequest("GET", "http://foo.bar.com/", bytes.NewReader(nil))
+	m = &metrics.Metrics{}
+	resp, _ = retryTargetProxy(cli, req, &spec.Retry{MaxAttempts: 3, Backoff: "1s", Budget: "10ms"}, m, span)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 1, m.Get("upstream_attempts").Value)
+
+	// requests with bodies too large to buffer are not retried but are sent in full
+	viper.Set(config.FlagProxyMaxBufferedBodyBytes.GetLong(), 4)
+	defer viper.Set(config.FlagProxyMaxBufferedBodyBytes.GetLong(), config.FlagProxyMaxBufferedBodyBytes.Value)
+	cli = &mockRetryHTTPClient{responses: []int{503, 200}}
+	req, _ = http.NewRequest("PUT", "http://foo.bar.com/", bytes.NewReader([]byte("test data")))
+	m = &metrics.Metrics{}
+	resp, _ = retryTargetProxy(cli, req, policy, m, span)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 1, m.Get("upstream_attempts").Value)
+	assert.Equal(t, []string{"test data"}, cli.bodies)
+
+	// one span per attempt plus the parent span
+	span.Finish()
+	assert.Equal(t, 12, len(mockTracer.FinishedSpans()))
+}
+
+func TestRetryTargetProxyCanceled(t *testing.T) {
+	span := mocktracer.New().StartSpan("test span")
+	policy := &spec.Retry{MaxAttempts: 3, Backoff: "1s", MaxBackoff: "1s"}
+
+	// a canceled request is not retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cli := &mockRetryHTTPClient{responses: []int{503, 200}}
+	req, _ := http.NewRequest("GET", "http://foo.bar.com/", bytes.NewReader(nil))
+	m := &metrics.Metrics{}
+	resp, _ := retryTargetProxy(cli, req.WithContext(ctx), policy, m, span)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 1, m.Get("upstream_attempts").Value)
+
+	// a request that expires while backing off is not retried
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	cli = &mockRetryHTTPClient{responses: []int{503, 200}}
+	m = &metrics.Metrics{}
+	t0 := time.Now()
+	resp, err := retryTargetProxy(cli, req.WithContext(ctx), policy, m, span)
+	assert.True(t, time.Now().Sub(t0) < 400*time.Millisecond)
+	assert.Nil(t, resp)
+	assert.Equal(t, "request timed out", err.Error())
+	assert.Equal(t, 1, m.Get("upstream_attempts").Value)
+}
+
+func TestPreformTargetProxyCanceled(t *testing.T) {
+	mockTracer := mocktracer.New()
+	span := mockTracer.StartSpan("test span")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("GET", "http://foo.bar.com/", bytes.NewReader(nil))
+	_, err := preformTargetProxy(&mockRetryHTTPClient{responses: []int{0}}, req.WithContext(ctx), span)
+	assert.Equal(t, "client closed request", err.Error())
+	assert.Equal(t, 499, err.(utils.Error).Status())
+	assert.Equal(t, 499, mockTracer.FinishedSpans()[0].Tag("http.response.status.code"))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &spec.Retry{Backoff: "100ms", MaxBackoff: "300ms"}
+	for i := 0; i < 10; i++ {
+		d := retryBackoff(policy, 1)
+		assert.True(t, d >= 50*time.Millisecond && d <= 100*time.Millisecond)
+		d = retryBackoff(policy, 2)
+		assert.True(t, d >= 100*time.Millisecond && d <= 200*time.Millisecond)
+		d = retryBackoff(policy, 5)
+		assert.True(t, d >= 150*time.Millisecond && d <= 300*time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(0), retryBackoff(&spec.Retry{Backoff: "0s"}, 3))
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/spf13/viper"
+	"golang.org/x/net/http2"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// transportKey identifies the upstream transport for an APIProxy. The
+// resource version ensures that a transport is never shared across
+// different versions of the same secret.
+type transportKey struct {
+	namespace             string
+	proxy                 string
+	protocol              string
+	secret                string
+	resourceVersion       string
+	connectTimeout        time.Duration
+	responseHeaderTimeout time.Duration
+	// serverName is the name that the certificate of the upstream
+	// service is verified against when it is not the request host
+	serverName string
+}
+
+// idleConnectionCloser is implemented by every upstream transport
+type idleConnectionCloser interface {
+	CloseIdleConnections()
+}
+
+// transportFactory is a concurrency safe cache of upstream transports so
+// that upstream connections, and their TLS sessions, can be reused
+type transportFactory struct {
+	mutex      sync.Mutex
+	transports map[transportKey]http.RoundTripper
+}
+
+var transports = &transportFactory{transports: map[transportKey]http.RoundTripper{}}
+
+func init() {
+	spec.SecretStore.Observe(transports.invalidate)
+	spec.ProxyStore.Observe(transports.evict)
+}
+
+// getTargetTransport retrieves the transport to use for the upstream request of
+// an APIProxy, creating and caching a new transport if one does not exist yet
+func getTargetTransport(proxy *spec.APIProxy, originalRequest *http.Request) (http.RoundTripper, error) {
+	return getProtocolTransport(proxy, originalRequest, proxy.GetProtocol())
+}
+
+// getProtocolTransport retrieves the transport to use for the upstream
+// request of an APIProxy using the given protocol rather than its own
+func getProtocolTransport(proxy *spec.APIProxy, originalRequest *http.Request, protocol string) (http.RoundTripper, error) {
+
+	untypedSecret, err := spec.SecretStore.Get(proxy.GetSSLCertificates(originalRequest.Host).SecretName, proxy.ObjectMeta.Namespace)
+	if err != nil {
+		return nil, utils.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+
+	key := transportKey{
+		namespace:             proxy.ObjectMeta.Namespace,
+		proxy:                 proxy.ObjectMeta.Name,
+		protocol:              protocol,
+		connectTimeout:        connectTimeout(proxy),
+		responseHeaderTimeout: responseHeaderTimeout(proxy),
+	}
+
+	var secret *api.Secret
+	if untypedSecret == nil {
+		logrus.Debug("TLS not configured for this proxy")
+	} else {
+		typed, _ := untypedSecret.(api.Secret)
+		secret = &typed
+		key.secret = secret.ObjectMeta.Name
+		key.resourceVersion = secret.ObjectMeta.ResourceVersion
+		// a load balanced request is sent to the address of a pod
+		// which its certificate is not issued for
+		if proxy.Spec.LoadBalancer != nil && proxy.Spec.Service.Name != "" {
+			key.serverName = serviceHost(proxy.Spec.Service.Name, proxy.ObjectMeta.Namespace)
+		}
+	}
+
+	return transports.get(key, secret)
+
+}
+
+func (f *transportFactory) get(key transportKey, secret *api.Secret) (http.RoundTripper, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if transport, ok := f.transports[key]; ok {
+		return transport, nil
+	}
+
+	var tlsConfig *tls.Config
+	if secret != nil {
+		config, err := configureTargetTLS(*secret)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = key.serverName
+		tlsConfig = config
+	}
+
+	transport, err := newProtocolTransport(key, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	f.transports[key] = transport
+	return transport, nil
+}
+
+// invalidate removes every transport that was configured using
+// the given secret so that the next request will use a transport
+// configured with the latest version of that secret
+func (f *transportFactory) invalidate(namespace, name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key, transport := range f.transports {
+		if key.namespace == namespace && key.secret == name {
+			logrus.Debugf("closing upstream connections that use secret %s", name)
+			closeIdleConnections(transport)
+			delete(f.transports, key)
+		}
+	}
+}
+
+// evict removes every transport of the given APIProxy so that transports
+// configured for a previous version of that APIProxy are not kept around
+func (f *transportFactory) evict(namespace, name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key, transport := range f.transports {
+		if key.namespace == namespace && key.proxy == name {
+			logrus.Debugf("closing upstream connections of APIProxy %s", name)
+			closeIdleConnections(transport)
+			delete(f.transports, key)
+		}
+	}
+}
+
+// clear removes every transport
+func (f *transportFactory) clear() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key, transport := range f.transports {
+		closeIdleConnections(transport)
+		delete(f.transports, key)
+	}
+}
+
+func newTargetTransport(key transportKey) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   key.connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ResponseHeaderTimeout: key.responseHeaderTimeout,
+		MaxIdleConns:          viper.GetInt(config.FlagProxyMaxIdleConns.GetLong()),
+		MaxIdleConnsPerHost:   viper.GetInt(config.FlagProxyMaxIdleConnsPerHost.GetLong()),
+		IdleConnTimeout:       viper.GetDuration(config.FlagProxyIdleConnTimeout.GetLong()),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// newProtocolTransport creates an upstream transport for the protocol of the
+// given key. A gRPC upstream service is reached over TLS if it is configured
+// and over cleartext otherwise. The response header timeout only applies to
+// upstream services reached using HTTP/1.1.
+func newProtocolTransport(key transportKey, tlsConfig *tls.Config) (http.RoundTripper, error) {
+	protocol := key.protocol
+	if protocol == spec.ProtocolGRPC {
+		protocol = spec.ProtocolH2C
+		if tlsConfig != nil {
+			protocol = spec.ProtocolH2
+		}
+	}
+
+	switch protocol {
+	case spec.ProtocolH2C:
+		dialer := &net.Dialer{
+			Timeout:   key.connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		return &http2.Transport{
+			AllowHTTP: true,
+			// HTTP/2 over cleartext uses a plain connection
+			// where the transport would otherwise use TLS
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			},
+		}, nil
+	case spec.ProtocolH2:
+		transport := newTargetTransport(key)
+		transport.TLSClientConfig = tlsConfig
+		if err := http2.ConfigureTransport(transport); err != nil {
+			return nil, err
+		}
+		return transport, nil
+	default:
+		transport := newTargetTransport(key)
+		transport.TLSClientConfig = tlsConfig
+		return transport, nil
+	}
+}
+
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(idleConnectionCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestGetTargetTransport(t *testing.T) {
+	defer spec.SecretStore.Clear()
+	defer transports.clear()
+	originalReq, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts", nil)
+
+	proxyOne := &spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "exampleAPIProxyOne",
+			Namespace: "foo",
+		},
+		Spec: spec.APIProxySpec{
+			Path: "/api/v1/accounts",
+		},
+	}
+
+	transport, err := getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	assert.Nil(t, transport.(*http.Transport).TLSClientConfig)
+	cached, _ := getTargetTransport(proxyOne, originalReq)
+	assert.True(t, transport == cached)
+
+	proxyOne.Spec.SSL = spec.SSL{
+		SecretName: "mysecretname",
+	}
+
+	testSecret := getTestTLSSecret()
+	testSecret.ObjectMeta.ResourceVersion = "1"
+	spec.SecretStore.Set(testSecret)
+	cert, _ := spec.X509KeyPair(testSecret)
+
+	tlsTransport, err := getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	assert.Equal(t, tlsTransport.(*http.Transport).TLSClientConfig.Certificates[0], *cert)
+	assert.False(t, transport == tlsTransport)
+	cached, _ = getTargetTransport(proxyOne, originalReq)
+	assert.True(t, tlsTransport == cached)
+
+	// updating the secret invalidates every transport that uses it
+	testSecret.ObjectMeta.ResourceVersion = "2"
+	spec.SecretStore.Update(testSecret)
+	assert.Equal(t, 1, len(transports.transports))
+	updated, err := getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	assert.False(t, tlsTransport == updated)
+
+	testSecret.Data = map[string][]byte{}
+	spec.SecretStore.Update(testSecret)
+	_, err = getTargetTransport(proxyOne, originalReq)
+	assert.NotNil(t, err)
+
+	// the timeouts of an APIProxy are applied to its transport
+	proxyOne.Spec.SSL = spec.SSL{}
+	proxyOne.Spec.Limits = &spec.Limits{ResponseHeaderTimeout: "5s"}
+	limited, err := getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	assert.False(t, transport == limited)
+	assert.Equal(t, 5*time.Second, limited.(*http.Transport).ResponseHeaderTimeout)
+
+	// removing the APIProxy removes every one of its transports
+	assert.Equal(t, 2, len(transports.transports))
+	spec.ProxyStore.Delete(*proxyOne)
+	assert.Equal(t, 0, len(transports.transports))
+}
+
+func TestGetTargetTransportServerName(t *testing.T) {
+	defer spec.SecretStore.Clear()
+	defer transports.clear()
+	originalReq, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts", nil)
+	spec.SecretStore.Set(getTestTLSSecret())
+
+	proxyOne := &spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "exampleAPIProxyOne",
+			Namespace: "foo",
+		},
+		Spec: spec.APIProxySpec{
+			Path:    "/api/v1/accounts",
+			Service: spec.Service{Name: "accounts", Port: 8443},
+			SSL:     spec.SSL{SecretName: "mysecretname"},
+		},
+	}
+
+	transport, err := getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	assert.Equal(t, "", transport.(*http.Transport).TLSClientConfig.ServerName)
+
+	// load balanced requests are sent to a pod address but the
+	// certificate is still verified against the name of the service
+	proxyOne.Spec.LoadBalancer = &spec.LoadBalancer{Algorithm: spec.LoadBalancerRoundRobin}
+	balanced, err := getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	assert.Equal(t, "accounts.foo.svc.cluster.local", balanced.(*http.Transport).TLSClientConfig.ServerName)
+	assert.Equal(t, "", transport.(*http.Transport).TLSClientConfig.ServerName)
+}
+
+func TestGetProtocolTransport(t *testing.T) {
+	defer spec.SecretStore.Clear()
+	defer transports.clear()
+	originalReq, _ := http.NewRequest("GET", "http://foo.bar.com/api/v1/accounts", nil)
+
+	proxyOne := &spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "exampleAPIProxyOne",
+			Namespace: "foo",
+		},
+		Spec: spec.APIProxySpec{
+			Path:     "/api/v1/accounts",
+			Protocol: spec.ProtocolGRPC,
+		},
+	}
+
+	transport, err := getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	h2c, ok := transport.(*http2.Transport)
+	assert.True(t, ok, "grpc without TLS should use HTTP/2 over cleartext")
+	assert.True(t, h2c.AllowHTTP)
+
+	http1, err := getProtocolTransport(proxyOne, originalReq, spec.ProtocolHTTP1)
+	assert.Nil(t, err)
+	_, ok = http1.(*http.Transport)
+	assert.True(t, ok)
+
+	proxyOne.Spec.SSL = spec.SSL{
+		SecretName: "mysecretname",
+	}
+	spec.SecretStore.Set(getTestTLSSecret())
+
+	transport, err = getTargetTransport(proxyOne, originalReq)
+	assert.Nil(t, err)
+	h2, ok := transport.(*http.Transport)
+	assert.True(t, ok, "grpc with TLS should use HTTP/2 over TLS")
+	assert.Contains(t, h2.TLSClientConfig.NextProtos, "h2")
+	assert.Equal(t, 3, len(transports.transports))
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/northwesternmutual/kanali/tracer"
+	"github.com/northwesternmutual/kanali/utils"
+	"github.com/opentracing/opentracing-go"
+)
+
+// UpgradeStep is factory that defines a step responsible for proxying a
+// request that switches protocols, e.g. to WebSockets, to a dynamic upstream
+// service. Once the upstream service agrees to switch protocols, the client
+// connection is hijacked and spliced to the upstream connection.
+type UpgradeStep struct{}
+
+// GetName retruns the name of the UpgradeStep step
+func (step UpgradeStep) GetName() string {
+	return "Upgrade"
+}
+
+// Do executes the logic of the UpgradeStep step
+func (step UpgradeStep) Do(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, span opentracing.Span) error {
+
+	proxy, backend := selectUpstream(proxy, m, r, span)
+
+	targetRequest, err := createTargetRequest(ctx, proxy, r)
+	if err != nil {
+		return err
+	}
+
+	if proxy.Spec.LoadBalancer != nil {
+		defer balancer.acquire(targetRequest.URL.Host)()
+	}
+
+	if err := breakerAllow(proxy, backend, span); err != nil {
+		return err
+	}
+
+	upstreamConn, upstreamReader, targetResponse, err := openUpgrade(proxy, targetRequest, span)
+	// a client that goes away says nothing about the health of the upstream service
+	if ctx.Err() == context.Canceled {
+		breakerCancel(proxy, backend)
+	} else {
+		breakerRecord(proxy, backend, targetResponse, err, span)
+		recordEndpointHealth(proxy, targetRequest.URL.Host, targetResponse, err)
+	}
+	if err != nil {
+		if ctxErr := utils.ContextError(ctx); ctxErr != nil {
+			return ctxErr
+		}
+		return utils.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+	defer func() {
+		if err := upstreamConn.Close(); err != nil {
+			logrus.Debugf("error closing upstream connection: %s", err.Error())
+		}
+	}()
+
+	m.Add(metrics.Metric{Name: "http_response_code", Value: strconv.Itoa(targetResponse.StatusCode), Index: true})
+	span.SetTag(tracer.HTTPResponseStatusCode, targetResponse.StatusCode)
+
+	// the upstream service refused to switch
+	// protocols so its response is written as is
+	if targetResponse.StatusCode != http.StatusSwitchingProtocols {
+		for k, v := range targetResponse.Header {
+			for _, value := range v {
+				w.Header().Add(k, value)
+			}
+		}
+		w.WriteHeader(targetResponse.StatusCode)
+		if _, err := io.Copy(w, targetResponse.Body); err != nil {
+			logrus.Warnf("error copying data to http response: %s", err.Error())
+		}
+		return nil
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return utils.StatusError{Code: http.StatusInternalServerError, Err: errors.New("connection does not support protocol upgrades")}
+	}
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		return utils.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+	defer func() {
+		if err := clientConn.Close(); err != nil {
+			logrus.Debugf("error closing client connection: %s", err.Error())
+		}
+	}()
+
+	if err := writeUpgradeResponse(clientConn, targetResponse); err != nil {
+		logrus.Warnf("error writing upgrade response: %s", err.Error())
+		return nil
+	}
+
+	t0 := time.Now()
+	bytesIn, bytesOut := splice(clientConn, clientBuf.Reader, upstreamConn, upstreamReader)
+
+	m.Add(
+		metrics.Metric{Name: "upgrade_duration", Value: int(time.Now().Sub(t0) / time.Millisecond), Index: false},
+		metrics.Metric{Name: "upgrade_bytes_in", Value: bytesIn, Index: false},
+		metrics.Metric{Name: "upgrade_bytes_out", Value: bytesOut, Index: false},
+	)
+
+	return nil
+
+}
+
+// openUpgrade dials the upstream service, sends it the upgrade request and
+// reads its response. The returned reader must be used to read from the
+// upstream connection as it may have buffered data past the response. The
+// response must be received within the response header timeout of the
+// APIProxy and before the context of the request is done.
+func openUpgrade(proxy *spec.APIProxy, request *http.Request, span opentracing.Span) (net.Conn, *bufio.Reader, *http.Response, error) {
+	if err := span.Tracer().Inject(
+		span.Context(),
+		opentracing.TextMap,
+		opentracing.HTTPHeadersCarrier(request.Header),
+	); err != nil {
+		logrus.Error("error injecting headers")
+	}
+
+	conn, err := dialUpstream(proxy, request)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if timeout := responseHeaderTimeout(proxy); timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			closeQuietly(conn)
+			return nil, nil, nil, err
+		}
+	}
+	stop := closeOnDone(request.Context(), conn)
+
+	if err := request.Write(conn); err != nil {
+		stop()
+		closeQuietly(conn)
+		return nil, nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if closed := stop(); err != nil || closed {
+		closeQuietly(conn)
+		if err == nil {
+			err = request.Context().Err()
+		}
+		return nil, nil, nil, err
+	}
+
+	// the timeout only applies until the response has been received
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		closeQuietly(conn)
+		return nil, nil, nil, err
+	}
+
+	return conn, reader, response, nil
+}
+
+// closeOnDone closes a connection if the given context is done before the
+// returned function is called. That function reports whether it was closed.
+func closeOnDone(ctx context.Context, conn net.Conn) func() bool {
+	stop := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeQuietly(conn)
+			closed <- true
+		case <-stop:
+			closed <- false
+		}
+	}()
+	return func() bool {
+		close(stop)
+		return <-closed
+	}
+}
+
+func dialUpstream(proxy *spec.APIProxy, request *http.Request) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: connectTimeout(proxy),
+	}
+
+	if request.URL.Scheme != "https" {
+		return dialer.Dial("tcp", request.URL.Host)
+	}
+
+	// protocols can only be switched using HTTP/1.1
+	transport, err := getProtocolTransport(proxy, request, spec.ProtocolHTTP1)
+	if err != nil {
+		return nil, err
+	}
+	return tls.DialWithDialer(dialer, "tcp", request.URL.Host, transport.(*http.Transport).TLSClientConfig)
+}
+
+func writeUpgradeResponse(w io.Writer, response *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %s\r\n", response.Status); err != nil {
+		return err
+	}
+	if err := response.Header.Write(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// splice copies data in both directions between the client and the upstream
+// service. Once either side is done, both connections are interrupted. It
+// returns the number of bytes sent by the client and by the upstream service.
+func splice(client net.Conn, clientReader io.Reader, upstream net.Conn, upstreamReader io.Reader) (int64, int64) {
+	var bytesIn, bytesOut int64
+	done := make(chan struct{}, 2)
+
+	go func() {
+		bytesIn, _ = io.Copy(upstream, clientReader)
+		done <- struct{}{}
+	}()
+	go func() {
+		bytesOut, _ = io.Copy(client, upstreamReader)
+		done <- struct{}{}
+	}()
+
+	<-done
+	now := time.Now()
+	if err := client.SetDeadline(now); err != nil {
+		logrus.Debugf("error interrupting client connection: %s", err.Error())
+	}
+	if err := upstream.SetDeadline(now); err != nil {
+		logrus.Debugf("error interrupting upstream connection: %s", err.Error())
+	}
+	<-done
+
+	return bytesIn, bytesOut
+}
+
+func closeQuietly(c io.Closer) {
+	if err := c.Close(); err != nil {
+		logrus.Debugf("error closing connection: %s", err.Error())
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package steps
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/northwesternmutual/kanali/config"
+	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/spec"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestUpgradeStepGetName(t *testing.T) {
+	step := UpgradeStep{}
+	assert.Equal(t, step.GetName(), "Upgrade", "step name is incorrect")
+}
+
+func TestUpgradeStepDo(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "upgrade required")
+			return
+		}
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		io.Copy(conn, buf)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	_, port, _ := net.SplitHostPort(upstreamURL.Host)
+	portNumber, _ := strconv.Atoi(port)
+
+	defer spec.ServiceStore.Clear()
+	spec.ServiceStore.Set(spec.Service{
+		Name:      "echo",
+		Namespace: "foo",
+		ClusterIP: "127.0.0.1",
+		Port:      int64(portNumber),
+	})
+	viper.SetDefault(config.FlagProxyEnableClusterIP.GetLong(), true)
+	defer viper.SetDefault(config.FlagProxyEnableClusterIP.GetLong(), false)
+
+	proxy := &spec.APIProxy{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "exampleAPIProxyOne",
+			Namespace: "foo",
+		},
+		Spec: spec.APIProxySpec{
+			Path:   "/api/v1/echo",
+			Target: "/",
+			Service: spec.Service{
+				Name:      "echo",
+				Namespace: "foo",
+				Port:      int64(portNumber),
+			},
+		},
+	}
+
+	results := make(chan *metrics.Metrics, 1)
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := &metrics.Metrics{}
+		span := mocktracer.New().StartSpan("test span")
+		if err := (UpgradeStep{}).Do(context.Background(), proxy, m, w, r, nil, span); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		results <- m
+	}))
+	defer frontend.Close()
+
+	frontendURL, _ := url.Parse(frontend.URL)
+
+	// the upstream service refuses to switch protocols
+	conn, _ := net.Dial("tcp", frontendURL.Host)
+	io.WriteString(conn, "GET /api/v1/echo HTTP/1.1\r\nHost: foo.bar.com\r\nUpgrade: other\r\nConnection: Upgrade\r\n\r\n")
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	m := <-results
+	assert.Equal(t, "400", m.Get("http_response_code").Value)
+	assert.Nil(t, m.Get("upgrade_duration"))
+	conn.Close()
+
+	// the upstream service switches protocols
+	conn, _ = net.Dial("tcp", frontendURL.Host)
+	io.WriteString(conn, "GET /api/v1/echo HTTP/1.1\r\nHost: foo.bar.com\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	response, err = http.ReadResponse(reader, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	assert.Equal(t, "echo", response.Header.Get("Upgrade"))
+
+	io.WriteString(conn, "ping")
+	echoed := make([]byte, 4)
+	_, err = io.ReadFull(reader, echoed)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(echoed))
+	conn.Close()
+
+	m = <-results
+	assert.Equal(t, "101", m.Get("http_response_code").Value)
+	assert.NotNil(t, m.Get("upgrade_duration"))
+	assert.Equal(t, int64(4), m.Get("upgrade_bytes_in").Value)
+	assert.Equal(t, int64(4), m.Get("upgrade_bytes_out").Value)
+}
+
+func TestOpenUpgradeUnresponsiveUpstream(t *testing.T) {
+	// the upstream service accepts connections but never answers
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	proxy := &spec.APIProxy{
+		Spec: spec.APIProxySpec{
+			Limits: &spec.Limits{ResponseHeaderTimeout: "50ms"},
+		},
+	}
+	span := mocktracer.New().StartSpan("test span")
+
+	request, _ := http.NewRequest("GET", "http://"+listener.Addr().String()+"/", nil)
+	start := time.Now()
+	_, _, _, err := openUpgrade(proxy, request, span)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// a canceled request is abandoned
+	proxy.Spec.Limits = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	_, _, _, err = openUpgrade(proxy, request.WithContext(ctx), span)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
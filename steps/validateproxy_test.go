@@ -65,6 +65,15 @@ func TestValidateProxy(t *testing.T) {
 	assert.Equal(*proxy, proxyList.Proxies[1])
 	assert.Equal(utils.StatusError{Code: http.StatusNotFound, Err: errors.New("proxy not found")}, step.Do(context.Background(), nil, &metrics.Metrics{}, nil, &http.Request{URL: urlThree}, nil, opentracing.StartSpan("test span")), "expected proxy to not exist")
 	assert.Equal(utils.StatusError{Code: http.StatusNotFound, Err: errors.New("proxy not found")}, step.Do(context.Background(), nil, &metrics.Metrics{}, nil, &http.Request{URL: urlFour}, nil, opentracing.StartSpan("test span")), "expected proxy to not exist")
+
+	hostProxy := proxyList.Proxies[1]
+	hostProxy.ObjectMeta.Name = "exampleAPIProxyThree"
+	hostProxy.Spec.VirtualHosts = []string{"www.foo.bar.com"}
+	proxyStore.Set(hostProxy)
+	assert.Nil(step.Do(context.Background(), proxy, &metrics.Metrics{}, nil, &http.Request{URL: urlTwo, Host: "www.foo.bar.com"}, nil, opentracing.StartSpan("test span")), "expected proxy to be found")
+	assert.Equal(*proxy, hostProxy)
+	assert.Nil(step.Do(context.Background(), proxy, &metrics.Metrics{}, nil, &http.Request{URL: urlTwo, Host: "foo.bar.com"}, nil, opentracing.StartSpan("test span")), "expected proxy to be found")
+	assert.Equal(*proxy, proxyList.Proxies[1])
 }
 
 func getTestAPIProxyListForValidateProxy() *spec.APIProxyList {
@@ -30,6 +30,7 @@ import (
 	"github.com/northwesternmutual/kanali/metrics"
 	"github.com/northwesternmutual/kanali/spec"
 	"github.com/northwesternmutual/kanali/tracer"
+	"github.com/northwesternmutual/kanali/utils"
 	"github.com/opentracing/opentracing-go"
 )
 
@@ -45,21 +46,78 @@ func (step WriteResponseStep) GetName() string {
 // Do executes the logic of the WriteResponseStep step
 func (step WriteResponseStep) Do(ctx context.Context, proxy *spec.APIProxy, m *metrics.Metrics, w http.ResponseWriter, r *http.Request, resp *http.Response, span opentracing.Span) error {
 
+	// the connection to the client is managed by the server
+	// rather than by the upstream service
+	removeHopByHopHeaders(resp.Header)
+
 	for k, v := range resp.Header {
-		for _, value := range v {
-			w.Header().Set(k, value)
-		}
+		w.Header()[k] = append(w.Header()[k], v...)
 	}
 
-	m.Add(metrics.Metric{Name: "http_response_code", Value: strconv.Itoa(resp.StatusCode), Index: true})
+	// the client always receives the ID that Kanali assigned to the request
+	if id := utils.RequestIDFromContext(ctx); id != "" {
+		w.Header().Set(utils.RequestIDHeader, id)
+	}
+
+	// the outcome of a gRPC call is only known
+	// once its trailers have been received
+	grpc := utils.IsGRPC(resp.Header.Get("Content-Type"))
+	if !grpc {
+		m.Add(metrics.Metric{Name: "http_response_code", Value: strconv.Itoa(resp.StatusCode), Index: true})
+	}
 
 	tracer.HydrateSpanFromResponse(resp, span)
 
+	// trailers known in advance are announced so that
+	// their values can be set once the body is written
+	announcedTrailers := len(resp.Trailer)
+	for k := range resp.Trailer {
+		w.Header().Add("Trailer", k)
+	}
+
 	w.WriteHeader(resp.StatusCode)
 
-	if _, err := io.Copy(w, resp.Body); err != nil {
+	body := newResponseBodyWriter(w, resp)
+	defer body.stop()
+
+	if _, err := io.Copy(body, resp.Body); err != nil {
 		logrus.Warnf("error copying data to http response: %s", err.Error())
 	}
 
+	writeTrailers(w, resp, announcedTrailers)
+
+	if grpc {
+		// a trailers-only response carries its status in its headers
+		status := resp.Trailer
+		if status.Get("Grpc-Status") == "" {
+			status = resp.Header
+		}
+		code := utils.GRPCStatusFromHeader(status)
+		m.Add(
+			metrics.Metric{Name: "http_response_code", Value: strconv.Itoa(utils.GRPCStatusToHTTP(code)), Index: true},
+			metrics.Metric{Name: "grpc_status", Value: strconv.Itoa(code), Index: true},
+		)
+	}
+
 	return nil
 }
+
+// writeTrailers copies the trailers of an upstream response to the client.
+// Trailers that were not announced before the body was written are sent
+// using the http.TrailerPrefix convention.
+func writeTrailers(w http.ResponseWriter, resp *http.Response, announced int) {
+	if len(resp.Trailer) == announced {
+		for k, v := range resp.Trailer {
+			for _, value := range v {
+				w.Header().Add(k, value)
+			}
+		}
+		return
+	}
+
+	for k, v := range resp.Trailer {
+		for _, value := range v {
+			w.Header().Add(http.TrailerPrefix+k, value)
+		}
+	}
+}
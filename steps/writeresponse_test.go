@@ -29,6 +29,7 @@ import (
 	"testing"
 
 	"github.com/northwesternmutual/kanali/metrics"
+	"github.com/northwesternmutual/kanali/utils"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 )
@@ -61,3 +62,69 @@ func TestWriteResponseDo(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, string(bodyBytes), "this is my mock response body")
 }
+
+func TestWriteResponseDoHeaders(t *testing.T) {
+	step := WriteResponseStep{}
+	writer := httptest.NewRecorder()
+	response := &httptest.ResponseRecorder{
+		Code: 200,
+		HeaderMap: http.Header{
+			"X-Request-Id": []string{"upstream"},
+			"Connection":   []string{"X-Internal"},
+			"Keep-Alive":   []string{"timeout=5"},
+			"X-Internal":   []string{"secret"},
+		},
+		Body: bytes.NewBuffer(nil),
+	}
+	ctx := utils.WithRequestID(context.Background(), "abc-123")
+	err := step.Do(ctx, nil, &metrics.Metrics{}, writer, nil, response.Result(), opentracing.StartSpan("test span"))
+	assert.Nil(t, err)
+	assert.Equal(t, "abc-123", writer.Result().Header.Get("X-Request-ID"))
+	// hop-by-hop headers are not forwarded to the client
+	assert.Equal(t, "", writer.Result().Header.Get("Keep-Alive"))
+	assert.Equal(t, "", writer.Result().Header.Get("X-Internal"))
+}
+
+func TestWriteResponseDoGRPC(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("message"))
+		w.Header().Set("Grpc-Status", "5")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "not found")
+	}))
+	defer upstream.Close()
+
+	response, err := http.Get(upstream.URL)
+	assert.Nil(t, err)
+
+	step := WriteResponseStep{}
+	writer := httptest.NewRecorder()
+	m := &metrics.Metrics{}
+	err = step.Do(context.Background(), nil, m, writer, nil, response, opentracing.StartSpan("test span"))
+	assert.Nil(t, err)
+
+	result := writer.Result()
+	bodyBytes, _ := ioutil.ReadAll(result.Body)
+	assert.Equal(t, "message", string(bodyBytes))
+	assert.Equal(t, "5", result.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "not found", result.Trailer.Get("Grpc-Message"))
+	assert.Equal(t, "404", m.Get("http_response_code").Value)
+	assert.Equal(t, "5", m.Get("grpc_status").Value)
+
+	// a trailers-only response carries its status in its headers
+	response = &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Content-Type": []string{"application/grpc"},
+			"Grpc-Status":  []string{"14"},
+		},
+		Body: ioutil.NopCloser(bytes.NewReader(nil)),
+	}
+	m = &metrics.Metrics{}
+	err = step.Do(context.Background(), nil, m, httptest.NewRecorder(), nil, response, opentracing.StartSpan("test span"))
+	assert.Nil(t, err)
+	assert.Equal(t, "503", m.Get("http_response_code").Value)
+	assert.Equal(t, "14", m.Get("grpc_status").Value)
+}
@@ -28,6 +28,10 @@ const (
 	KanaliProxyName = "kanali.proxy.name"
 	// KanaliProxyNamespace is the opentracing tag name that represents an APIProxy namespace
 	KanaliProxyNamespace = "kanali.proxy.namespace"
+	// KanaliBackendName is the opentracing tag name that represents the upstream service chosen for a request
+	KanaliBackendName = "kanali.backend.name"
+	// KanaliRequestID is the opentracing tag name that represents the ID of a request
+	KanaliRequestID = "kanali.request.id"
 
 	// HTTPRequest is the opentracing tag name that represents the existence on an HTTP request
 	HTTPRequest = "http.request"
@@ -36,6 +40,8 @@ const (
 	HTTPRequestMethod = "http.request.method"
 	// HTTPRequestBody is the opentracing tag name that represents an HTTP request body
 	HTTPRequestBody = "http.request.body"
+	// HTTPRequestBodyTruncated is the opentracing tag name that represents whether an HTTP request body was truncated
+	HTTPRequestBodyTruncated = "http.request.body.truncated"
 	// HTTPRequestHeaders is the opentracing tag name that represents an HTTP request headers
 	HTTPRequestHeaders = "http.request.headers"
 
@@ -51,6 +57,8 @@ const (
 
 	// HTTPResponseBody is the opentracing tag name that represents an HTTP response body
 	HTTPResponseBody = "http.response.body"
+	// HTTPResponseBodyTruncated is the opentracing tag name that represents whether an HTTP response body was truncated
+	HTTPResponseBodyTruncated = "http.response.body.truncated"
 	// HTTPResponseHeaders is the opentracing tag name that represents an HTTP response headers
 	HTTPResponseHeaders = "http.response.headers"
 
@@ -27,7 +27,7 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/spf13/viper"
 	"io"
-	"io/ioutil"
+	"mime"
 	"net/http"
 	"strings"
 )
@@ -47,17 +47,7 @@ func HydrateSpanFromRequest(req *http.Request, span opentracing.Span) {
 	span.SetTag(HTTPRequestURLPath, req.URL.EscapedPath())
 	span.SetTag(HTTPRequestURLHost, req.Host)
 
-	if closerOne, closerTwo, err := dupReader(req.Body); err != nil {
-		span.SetTag(HTTPRequestBody, errorString)
-	} else {
-		buf, err := ioutil.ReadAll(closerOne)
-		if err != nil {
-			span.SetTag(HTTPRequestBody, errorString)
-		} else {
-			span.SetTag(HTTPRequestBody, string(buf))
-		}
-		req.Body = closerTwo
-	}
+	req.Body = hydrateSpanFromBody(req.Body, req.ContentLength, req.Header, HTTPRequestBody, HTTPRequestBodyTruncated, span)
 
 	jsonHeaders, err := json.Marshal(omitHeaderValues(
 		req.Header,
@@ -83,17 +73,7 @@ func HydrateSpanFromResponse(res *http.Response, span opentracing.Span) {
 		return
 	}
 
-	if closerOne, closerTwo, err := dupReader(res.Body); err != nil {
-		span.SetTag(HTTPResponseBody, errorString)
-	} else {
-		buf, err := ioutil.ReadAll(closerOne)
-		if err != nil {
-			span.SetTag(HTTPResponseBody, errorString)
-		} else {
-			span.SetTag(HTTPResponseBody, string(buf))
-		}
-		res.Body = closerTwo
-	}
+	res.Body = hydrateSpanFromBody(res.Body, res.ContentLength, res.Header, HTTPResponseBody, HTTPResponseBodyTruncated, span)
 
 	jsonHeaders, err := json.Marshal(omitHeaderValues(
 		res.Header,
@@ -107,18 +87,79 @@ func HydrateSpanFromResponse(res *http.Response, span opentracing.Span) {
 	span.SetTag(HTTPResponseStatusCode, res.StatusCode)
 }
 
-func dupReader(closer io.ReadCloser) (io.ReadCloser, io.ReadCloser, error) {
+// hydrateSpanFromBody records, at most, the configured maximum number of
+// bytes of a body on a span if its content type is allowed. Bodies of unknown
+// length, e.g. chunked or event streams, are not recorded as waiting for them
+// would delay streaming. As a body can only be read once, the returned body
+// must be used in place of the given one. It yields the entire original body
+// without buffering all of it.
+func hydrateSpanFromBody(body io.ReadCloser, length int64, header http.Header, bodyTag, truncatedTag string, span opentracing.Span) io.ReadCloser {
+	max := viper.GetInt(config.FlagTracingMaxBodyBytes.GetLong())
+	if body == nil || length < 0 || max <= 0 || !isCapturedContentType(
+		header.Get("Content-Type"),
+		viper.GetStringSlice(config.FlagTracingBodyContentTypes.GetLong()),
+	) {
+		return body
+	}
 
-	buf, err := ioutil.ReadAll(closer)
+	// one byte more than the maximum is read
+	// to detect whether the body was truncated
+	buf, rest, err := peekBody(body, max+1)
 	if err != nil {
-		return nil, nil, err
+		span.SetTag(bodyTag, errorString)
+		return rest
+	}
+
+	if len(buf) > max {
+		span.SetTag(bodyTag, string(buf[:max]))
+		span.SetTag(truncatedTag, true)
+	} else {
+		span.SetTag(bodyTag, string(buf))
 	}
 
-	rdr1 := ioutil.NopCloser(bytes.NewBuffer(buf))
-	rdr2 := ioutil.NopCloser(bytes.NewBuffer(buf))
+	return rest
+}
 
-	return rdr1, rdr2, nil
+// peekBody reads up to n bytes of a body. The returned body yields
+// the bytes that were read followed by the remainder of the body.
+func peekBody(body io.ReadCloser, n int) ([]byte, io.ReadCloser, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(body, buf)
+	buf = buf[:read]
 
+	rest := readCloser{
+		Reader: io.MultiReader(bytes.NewReader(buf), body),
+		Closer: body,
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf, rest, nil
+	}
+	return buf, rest, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// isCapturedContentType reports whether a content type matches one of the
+// allowed media types. An allowed media type may end in a wildcard subtype.
+func isCapturedContentType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == mediaType {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
 }
 
 func omitHeaderValues(h http.Header, msg string, keys ...string) http.Header {
@@ -25,15 +25,24 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/northwesternmutual/kanali/config"
 	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestHydrateSpanFromRequest(t *testing.T) {
+	viper.SetDefault(config.FlagTracingMaxBodyBytes.GetLong(), 4096)
+	viper.SetDefault(config.FlagTracingBodyContentTypes.GetLong(), []string{"text/plain"})
+	defer viper.SetDefault(config.FlagTracingMaxBodyBytes.GetLong(), 0)
+	defer viper.SetDefault(config.FlagTracingBodyContentTypes.GetLong(), []string{})
+
 	mockTracer := mocktracer.New()
 	testReqOne, _ := http.NewRequest("GET", "https://foo.bar.com/?foo=bar", bytes.NewReader([]byte("test data")))
+	testReqOne.Header.Add("Content-Type", "text/plain")
 	testReqOne.Header.Add("foo", "bar")
 	testReqOne.Header.Add("foo", "car")
 	testReqOne.Header.Add("bar", "foo")
@@ -45,23 +54,39 @@ func TestHydrateSpanFromRequest(t *testing.T) {
 	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPRequestURLPath], "/")
 	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPRequestURLHost], "foo.bar.com")
 	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPRequestBody], "test data")
-	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPRequestHeaders], `{"Bar":["foo"],"Foo":["bar","car"]}`)
+	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPRequestHeaders], `{"Bar":["foo"],"Content-Type":["text/plain"],"Foo":["bar","car"]}`)
 	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPRequestURLQuery], `{"foo":["bar"]}`)
 
 	testSpanTwo := mockTracer.StartSpan("test span two")
 	HydrateSpanFromRequest(nil, testSpanTwo)
 	testSpanTwo.Finish()
 	assert.Nil(t, mockTracer.FinishedSpans()[1].Tags()[HTTPRequest])
+
+	testReqThree, _ := http.NewRequest("POST", "https://foo.bar.com/", bytes.NewReader([]byte("test data")))
+	testReqThree.Header.Add("Content-Type", "application/octet-stream")
+	testSpanThree := mockTracer.StartSpan("test span three")
+	HydrateSpanFromRequest(testReqThree, testSpanThree)
+	testSpanThree.Finish()
+	assert.Nil(t, mockTracer.FinishedSpans()[2].Tags()[HTTPRequestBody])
+	data, _ := ioutil.ReadAll(testReqThree.Body)
+	assert.Equal(t, "test data", string(data))
 }
 
 func TestHydrateSpanFromResponse(t *testing.T) {
+	viper.SetDefault(config.FlagTracingMaxBodyBytes.GetLong(), 4)
+	viper.SetDefault(config.FlagTracingBodyContentTypes.GetLong(), []string{"text/*"})
+	defer viper.SetDefault(config.FlagTracingMaxBodyBytes.GetLong(), 0)
+	defer viper.SetDefault(config.FlagTracingBodyContentTypes.GetLong(), []string{})
+
 	mockTracer := mocktracer.New()
 	responseRecorder := &httptest.ResponseRecorder{
 		Code: 200,
 		Body: bytes.NewBuffer([]byte("test data")),
 		HeaderMap: http.Header{
-			"Foo": []string{"bar", "car"},
-			"Bar": []string{"foo"},
+			"Content-Type":   []string{"text/plain; charset=utf-8"},
+			"Content-Length": []string{"9"},
+			"Foo":            []string{"bar", "car"},
+			"Bar":            []string{"foo"},
 		},
 	}
 	mockResponseOne := responseRecorder.Result()
@@ -69,8 +94,11 @@ func TestHydrateSpanFromResponse(t *testing.T) {
 	testSpanOne := mockTracer.StartSpan("test span one")
 	HydrateSpanFromResponse(mockResponseOne, testSpanOne)
 	testSpanOne.Finish()
-	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPResponseBody], "test data")
-	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPResponseHeaders], `{"Bar":["foo"],"Foo":["bar","car"]}`)
+	data, _ := ioutil.ReadAll(mockResponseOne.Body)
+	assert.Equal(t, "test data", string(data))
+	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPResponseBody], "test")
+	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPResponseBodyTruncated], true)
+	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPResponseHeaders], `{"Bar":["foo"],"Content-Length":["9"],"Content-Type":["text/plain; charset=utf-8"],"Foo":["bar","car"]}`)
 	assert.Equal(t, mockTracer.FinishedSpans()[0].Tags()[HTTPResponseStatusCode], 200)
 
 	testSpanTwo := mockTracer.StartSpan("test span two")
@@ -79,13 +107,35 @@ func TestHydrateSpanFromResponse(t *testing.T) {
 	assert.Nil(t, mockTracer.FinishedSpans()[1].Tags()[HTTPResponse])
 }
 
-func TestDupReader(t *testing.T) {
+func TestPeekBody(t *testing.T) {
 	closer := ioutil.NopCloser(bytes.NewReader([]byte("test string")))
-	closerOne, closerTwo, _ := dupReader(closer)
-	data1, _ := ioutil.ReadAll(closerOne)
-	assert.Equal(t, string(data1), "test string")
-	data2, _ := ioutil.ReadAll(closerTwo)
-	assert.Equal(t, string(data2), "test string")
+	buf, rest, err := peekBody(closer, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", string(buf))
+	data, _ := ioutil.ReadAll(rest)
+	assert.Equal(t, "test string", string(data))
+
+	closer = ioutil.NopCloser(bytes.NewReader([]byte("test")))
+	buf, rest, err = peekBody(closer, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", string(buf))
+	data, _ = ioutil.ReadAll(rest)
+	assert.Equal(t, "test", string(data))
+
+	closer = ioutil.NopCloser(strings.NewReader(""))
+	buf, _, err = peekBody(closer, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(buf))
+}
+
+func TestIsCapturedContentType(t *testing.T) {
+	allowed := []string{"application/json", "text/*"}
+	assert.True(t, isCapturedContentType("application/json", allowed))
+	assert.True(t, isCapturedContentType("Application/JSON; charset=utf-8", allowed))
+	assert.True(t, isCapturedContentType("text/html", allowed))
+	assert.False(t, isCapturedContentType("application/octet-stream", allowed))
+	assert.False(t, isCapturedContentType("", allowed))
+	assert.False(t, isCapturedContentType("application/json", nil))
 }
 
 func TestOmitHeaderValues(t *testing.T) {
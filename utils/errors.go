@@ -20,6 +20,16 @@
 
 package utils
 
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// StatusClientClosedRequest is the non standard status code that is
+// recorded for requests that were canceled by their client
+const StatusClientClosedRequest = 499
+
 // Error is an interface that is used to intuitively handle HTTP errors.
 // It expands on the native error interface that the language provides
 type Error interface {
@@ -35,8 +45,9 @@ type StatusError struct {
 
 // JSONErr is used to assist in marshalling HTTP errors
 type JSONErr struct {
-	Code int    `json:"code"`
-	Msg  string `json:"msg"`
+	Code      int    `json:"code"`
+	Msg       string `json:"msg"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // Error will return the error message associated with the error
@@ -48,3 +59,17 @@ func (se StatusError) Error() string {
 func (se StatusError) Status() int {
 	return se.Code
 }
+
+// ContextError returns an error describing why a request context is done,
+// or nil if it is not. A request canceled by its client results in a
+// StatusClientClosedRequest error and an expired request in a gateway timeout.
+func ContextError(ctx context.Context) Error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return StatusError{Code: http.StatusGatewayTimeout, Err: errors.New("request timed out")}
+	default:
+		return StatusError{Code: StatusClientClosedRequest, Err: errors.New("client closed request")}
+	}
+}
@@ -21,8 +21,11 @@
 package utils
 
 import (
+	"context"
 	"errors"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +45,20 @@ func TestError(t *testing.T) {
 	}
 	assert.Equal(t, 400, se.Status())
 }
+
+func TestContextError(t *testing.T) {
+	assert.Nil(t, ContextError(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ContextError(ctx)
+	assert.Equal(t, StatusClientClosedRequest, err.Status())
+	assert.Equal(t, "client closed request", err.Error())
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	err = ContextError(ctx)
+	assert.Equal(t, http.StatusGatewayTimeout, err.Status())
+	assert.Equal(t, "request timed out", err.Error())
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes as defined by https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	GRPCStatusOK                 = 0
+	GRPCStatusCanceled           = 1
+	GRPCStatusUnknown            = 2
+	GRPCStatusInvalidArgument    = 3
+	GRPCStatusDeadlineExceeded   = 4
+	GRPCStatusNotFound           = 5
+	GRPCStatusAlreadyExists      = 6
+	GRPCStatusPermissionDenied   = 7
+	GRPCStatusResourceExhausted  = 8
+	GRPCStatusFailedPrecondition = 9
+	GRPCStatusAborted            = 10
+	GRPCStatusOutOfRange         = 11
+	GRPCStatusUnimplemented      = 12
+	GRPCStatusInternal           = 13
+	GRPCStatusUnavailable        = 14
+	GRPCStatusDataLoss           = 15
+	GRPCStatusUnauthenticated    = 16
+)
+
+var grpcToHTTPStatus = map[int]int{
+	GRPCStatusOK:                 http.StatusOK,
+	GRPCStatusCanceled:           499,
+	GRPCStatusUnknown:            http.StatusInternalServerError,
+	GRPCStatusInvalidArgument:    http.StatusBadRequest,
+	GRPCStatusDeadlineExceeded:   http.StatusGatewayTimeout,
+	GRPCStatusNotFound:           http.StatusNotFound,
+	GRPCStatusAlreadyExists:      http.StatusConflict,
+	GRPCStatusPermissionDenied:   http.StatusForbidden,
+	GRPCStatusResourceExhausted:  http.StatusTooManyRequests,
+	GRPCStatusFailedPrecondition: http.StatusBadRequest,
+	GRPCStatusAborted:            http.StatusConflict,
+	GRPCStatusOutOfRange:         http.StatusBadRequest,
+	GRPCStatusUnimplemented:      http.StatusNotImplemented,
+	GRPCStatusInternal:           http.StatusInternalServerError,
+	GRPCStatusUnavailable:        http.StatusServiceUnavailable,
+	GRPCStatusDataLoss:           http.StatusInternalServerError,
+	GRPCStatusUnauthenticated:    http.StatusUnauthorized,
+}
+
+// IsGRPC reports whether a content type is that of a gRPC request or response
+func IsGRPC(contentType string) bool {
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+") || strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// GRPCStatusFromHeader retrieves the gRPC status code from the grpc-status
+// header or trailer of a response. A missing or malformed status is unknown.
+func GRPCStatusFromHeader(h http.Header) int {
+	code, err := strconv.Atoi(h.Get("Grpc-Status"))
+	if err != nil {
+		return GRPCStatusUnknown
+	}
+	return code
+}
+
+// GRPCStatusToHTTP maps a gRPC status code to its closest HTTP status code
+func GRPCStatusToHTTP(code int) int {
+	if status, ok := grpcToHTTPStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// HTTPToGRPCStatus maps an HTTP status code to a gRPC status code as defined by
+// https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+func HTTPToGRPCStatus(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return GRPCStatusInternal
+	case http.StatusUnauthorized:
+		return GRPCStatusUnauthenticated
+	case http.StatusForbidden:
+		return GRPCStatusPermissionDenied
+	case http.StatusNotFound:
+		return GRPCStatusUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return GRPCStatusUnavailable
+	default:
+		return GRPCStatusUnknown
+	}
+}
+
+// WriteGRPCError writes an error as a trailers-only gRPC response, which
+// conveys the error in its headers and is understood by gRPC clients
+func WriteGRPCError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(HTTPToGRPCStatus(status)))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(msg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent encodes a message so that it can
+// be used as the value of the grpc-message header
+func encodeGRPCMessage(msg string) string {
+	var encoded []byte
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			encoded = append(encoded, c)
+		} else {
+			encoded = append(encoded, []byte(fmt.Sprintf("%%%02X", c))...)
+		}
+	}
+	return string(encoded)
+}
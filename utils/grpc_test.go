@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsGRPC(t *testing.T) {
+	assert.True(t, IsGRPC("application/grpc"))
+	assert.True(t, IsGRPC("application/grpc+proto"))
+	assert.True(t, IsGRPC("application/grpc; charset=utf-8"))
+	assert.False(t, IsGRPC("application/grpc-web"))
+	assert.False(t, IsGRPC("application/json"))
+	assert.False(t, IsGRPC(""))
+}
+
+func TestGRPCStatusFromHeader(t *testing.T) {
+	assert.Equal(t, GRPCStatusUnavailable, GRPCStatusFromHeader(http.Header{"Grpc-Status": []string{"14"}}))
+	assert.Equal(t, GRPCStatusUnknown, GRPCStatusFromHeader(http.Header{"Grpc-Status": []string{"foo"}}))
+	assert.Equal(t, GRPCStatusUnknown, GRPCStatusFromHeader(http.Header{}))
+}
+
+func TestGRPCStatusToHTTP(t *testing.T) {
+	assert.Equal(t, http.StatusOK, GRPCStatusToHTTP(GRPCStatusOK))
+	assert.Equal(t, http.StatusNotFound, GRPCStatusToHTTP(GRPCStatusNotFound))
+	assert.Equal(t, http.StatusUnauthorized, GRPCStatusToHTTP(GRPCStatusUnauthenticated))
+	assert.Equal(t, http.StatusServiceUnavailable, GRPCStatusToHTTP(GRPCStatusUnavailable))
+	assert.Equal(t, http.StatusInternalServerError, GRPCStatusToHTTP(42))
+}
+
+func TestHTTPToGRPCStatus(t *testing.T) {
+	assert.Equal(t, GRPCStatusUnauthenticated, HTTPToGRPCStatus(http.StatusUnauthorized))
+	assert.Equal(t, GRPCStatusPermissionDenied, HTTPToGRPCStatus(http.StatusForbidden))
+	assert.Equal(t, GRPCStatusUnimplemented, HTTPToGRPCStatus(http.StatusNotFound))
+	assert.Equal(t, GRPCStatusUnavailable, HTTPToGRPCStatus(http.StatusServiceUnavailable))
+	assert.Equal(t, GRPCStatusUnknown, HTTPToGRPCStatus(http.StatusInternalServerError))
+}
+
+func TestWriteGRPCError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteGRPCError(w, http.StatusUnauthorized, "api key not valid: 100%")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc", w.Header().Get("Content-Type"))
+	assert.Equal(t, "16", w.Header().Get("Grpc-Status"))
+	assert.Equal(t, "api key not valid: 100%25", w.Header().Get("Grpc-Message"))
+	assert.Equal(t, 0, w.Body.Len())
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Northwestern Mutual.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package utils
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDContext(t *testing.T) {
+	assert.Equal(t, "", RequestIDFromContext(context.Background()))
+	assert.Equal(t, "abc", RequestIDFromContext(WithRequestID(context.Background(), "abc")))
+}
+
+func TestNewRequestID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, second := NewRequestID(), NewRequestID()
+	assert.Regexp(t, uuid, first)
+	assert.Regexp(t, uuid, second)
+	assert.NotEqual(t, first, second)
+}
+
+func TestIsValidRequestID(t *testing.T) {
+	assert.True(t, IsValidRequestID("abc-123"))
+	assert.True(t, IsValidRequestID(strings.Repeat("a", 128)))
+	assert.False(t, IsValidRequestID(""))
+	assert.False(t, IsValidRequestID(strings.Repeat("a", 129)))
+	assert.False(t, IsValidRequestID("abc 123"))
+	assert.False(t, IsValidRequestID("abc\n123"))
+	assert.False(t, IsValidRequestID("abcé"))
+}
+
+func TestRequestID(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://foo.bar.com", nil)
+	assert.Equal(t, 36, len(RequestID(r)))
+
+	r.Header.Set(RequestIDHeader, "abc-123")
+	assert.Equal(t, "abc-123", RequestID(r))
+
+	r.Header.Set(RequestIDHeader, "abc\t123")
+	assert.NotEqual(t, "abc\t123", RequestID(r))
+}
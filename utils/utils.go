@@ -22,6 +22,8 @@ package utils
 
 import (
 	"bytes"
+	"fmt"
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"regexp"
@@ -30,23 +32,46 @@ import (
 	"k8s.io/kubernetes/pkg/api"
 )
 
+// PathWildcard is the path segment that, when used as the last segment of
+// an APIProxy path, matches all remaining segments of the incoming path
+const PathWildcard = "*"
+
 // ComputeTargetPath calcuates the target or destination path based on the incoming path,
-// desired target path prefix and the assicated proxy
+// desired target path prefix and the assicated proxy. Named parameters captured by the
+// proxy path may be referenced in the target path using the same {name} syntax.
 func ComputeTargetPath(proxyPath, proxyTarget, requestPath string) string {
 
-	proxyPath = NormalizeURLPath(proxyPath)
-	proxyTarget = NormalizeURLPath(proxyTarget)
-	requestPath = NormalizeURLPath(requestPath)
+	proxySegments := splitURLPath(proxyPath)
+	requestSegments := splitURLPath(requestPath)
+
+	params, remainder := matchSegments(proxySegments, requestSegments)
 
 	var buffer bytes.Buffer
 
-	if len(strings.SplitAfter(requestPath, proxyPath)) == 0 {
+	wildcardUsed := false
+	for _, segment := range splitURLPath(proxyTarget) {
+		if IsPathParam(segment) {
+			name := pathParamName(segment)
+			if name == PathWildcard {
+				wildcardUsed = true
+			}
+			if value, ok := params[name]; ok {
+				segment = value
+			}
+		}
+		if segment == "" {
+			continue
+		}
 		buffer.WriteString("/")
-	} else if proxyTarget != "/" {
-		buffer.WriteString(proxyTarget)
+		buffer.WriteString(segment)
 	}
 
-	buffer.WriteString(strings.SplitAfter(requestPath, proxyPath)[1])
+	if !wildcardUsed {
+		for _, segment := range remainder {
+			buffer.WriteString("/")
+			buffer.WriteString(segment)
+		}
+	}
 
 	if len(buffer.Bytes()) == 0 {
 		return "/"
@@ -55,6 +80,83 @@ func ComputeTargetPath(proxyPath, proxyTarget, requestPath string) string {
 	return buffer.String()
 }
 
+// ExtractPathParams returns the values captured from the request path by the
+// named parameters and wildcard in the given proxy path. The wildcard value,
+// if any, is stored under the PathWildcard key.
+func ExtractPathParams(proxyPath, requestPath string) map[string]string {
+	params, _ := matchSegments(splitURLPath(proxyPath), splitURLPath(requestPath))
+	return params
+}
+
+// ValidatePathTemplate reports whether a path is a well formed proxy path.
+// Segments of the form {name} are named parameters and a single trailing *
+// is a wildcard. Any other use of braces or wildcards is an error.
+func ValidatePathTemplate(path string) error {
+	segments := splitURLPath(path)
+	names := map[string]bool{}
+	for i, segment := range segments {
+		switch {
+		case segment == PathWildcard:
+			if i != len(segments)-1 {
+				return fmt.Errorf("wildcard in path %s must be the last segment", path)
+			}
+		case IsPathParam(segment):
+			name := pathParamName(segment)
+			if strings.ContainsAny(name, "{}*") {
+				return fmt.Errorf("path parameter %s in path %s is not a valid name", segment, path)
+			}
+			if names[name] {
+				return fmt.Errorf("path parameter %s is declared more than once in path %s", segment, path)
+			}
+			names[name] = true
+		case strings.ContainsAny(segment, "{}*"):
+			return fmt.Errorf("path segment %s in path %s is neither a literal, a parameter nor a wildcard", segment, path)
+		}
+	}
+	return nil
+}
+
+// IsPathParam reports whether a path segment is a named parameter, e.g. {id}
+func IsPathParam(segment string) bool {
+	return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}'
+}
+
+func pathParamName(segment string) string {
+	return segment[1 : len(segment)-1]
+}
+
+// matchSegments walks the proxy path alongside the request path, capturing
+// parameter and wildcard values. The segments of the request path that were
+// not consumed by the proxy path are returned as the remainder.
+func matchSegments(proxySegments, requestSegments []string) (map[string]string, []string) {
+	params := map[string]string{}
+	for i, segment := range proxySegments {
+		if segment == PathWildcard {
+			if i < len(requestSegments) {
+				params[PathWildcard] = strings.Join(requestSegments[i:], "/")
+				return params, requestSegments[i:]
+			}
+			params[PathWildcard] = ""
+			return params, nil
+		}
+		if i >= len(requestSegments) {
+			return params, nil
+		}
+		if IsPathParam(segment) {
+			params[pathParamName(segment)] = requestSegments[i]
+		}
+	}
+	return params, requestSegments[len(proxySegments):]
+}
+
+func splitURLPath(path string) []string {
+	path = NormalizeURLPath(path)
+	if path == "/" {
+		return []string{}
+	}
+	return strings.Split(path[1:], "/")
+}
+
 // GetAbsPath returns the absolute path given any path
 // the returned path is in a form that Kanali prefers
 func GetAbsPath(path string) (string, error) {
@@ -108,3 +210,19 @@ func NormalizeURLPath(path string) string {
 
 	return path
 }
+
+// IsUpgradeRequest reports whether a request asks to switch protocols,
+// e.g. to WebSockets, using the Connection and Upgrade headers
+func IsUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -21,6 +21,7 @@
 package utils
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,6 +42,41 @@ func TestComputeTargetPath(t *testing.T) {
 	assert.Equal(t, "/accounts", NormalizeURLPath(ComputeTargetPath("/api/v1/example-two/", "", "/api/v1/example-two/accounts")))
 	assert.Equal(t, "/", NormalizeURLPath(ComputeTargetPath("/", "", "/")))
 	assert.Equal(t, "/", NormalizeURLPath(ComputeTargetPath("/", "/", "/")))
+	assert.Equal(t, "/foo", NormalizeURLPath(ComputeTargetPath("/", "", "/foo")))
+	assert.Equal(t, "/v2/customers/123/orders", ComputeTargetPath("/accounts/{id}/orders", "/v2/customers/{id}/orders", "/accounts/123/orders"))
+	assert.Equal(t, "/v2/customers/123/orders/456", ComputeTargetPath("/accounts/{id}/orders", "/v2/customers/{id}/orders", "/accounts/123/orders/456"))
+	assert.Equal(t, "/456/123", ComputeTargetPath("/accounts/{id}/orders/{order}", "/{order}/{id}", "/accounts/123/orders/456"))
+	assert.Equal(t, "/static/css/main.css", ComputeTargetPath("/files/*", "/static", "/files/css/main.css"))
+	assert.Equal(t, "/static/css/main.css/raw", ComputeTargetPath("/files/*", "/static/{*}/raw", "/files/css/main.css"))
+	assert.Equal(t, "/static", ComputeTargetPath("/files/*", "/static", "/files"))
+}
+
+func TestExtractPathParams(t *testing.T) {
+	assert.Equal(t, map[string]string{}, ExtractPathParams("/foo/bar", "/foo/bar/car"))
+	assert.Equal(t, map[string]string{"id": "123"}, ExtractPathParams("/accounts/{id}/orders", "/accounts/123/orders"))
+	assert.Equal(t, map[string]string{"id": "123"}, ExtractPathParams("/accounts/{id}", "/accounts/123/orders"))
+	assert.Equal(t, map[string]string{"id": "123", "*": "a/b"}, ExtractPathParams("/accounts/{id}/*", "/accounts/123/a/b"))
+	assert.Equal(t, map[string]string{"*": ""}, ExtractPathParams("/files/*", "/files"))
+}
+
+func TestValidatePathTemplate(t *testing.T) {
+	assert.Nil(t, ValidatePathTemplate("/"))
+	assert.Nil(t, ValidatePathTemplate("/foo/bar"))
+	assert.Nil(t, ValidatePathTemplate("/accounts/{id}/orders/{order}"))
+	assert.Nil(t, ValidatePathTemplate("/accounts/{id}/*"))
+	assert.Equal(t, "wildcard in path /foo/*/bar must be the last segment", ValidatePathTemplate("/foo/*/bar").Error())
+	assert.Equal(t, "path parameter {id} is declared more than once in path /foo/{id}/{id}", ValidatePathTemplate("/foo/{id}/{id}").Error())
+	assert.Equal(t, "path parameter {*} in path /foo/{*} is not a valid name", ValidatePathTemplate("/foo/{*}").Error())
+	assert.Equal(t, "path segment foo{id} in path /foo{id} is neither a literal, a parameter nor a wildcard", ValidatePathTemplate("/foo{id}").Error())
+	assert.Equal(t, "path segment {} in path /{} is neither a literal, a parameter nor a wildcard", ValidatePathTemplate("/{}").Error())
+}
+
+func TestIsPathParam(t *testing.T) {
+	assert.True(t, IsPathParam("{id}"))
+	assert.False(t, IsPathParam("{}"))
+	assert.False(t, IsPathParam("id"))
+	assert.False(t, IsPathParam("{id"))
+	assert.False(t, IsPathParam("*"))
 }
 
 func TestAbsPath(t *testing.T) {
@@ -85,3 +121,14 @@ func TestNormalizeURLPath(t *testing.T) {
 	assert.Equal(t, "/", NormalizeURLPath("////"))
 	assert.Equal(t, "/https%3A%2F%2Fgoogle.com", NormalizeURLPath("/////https%3A%2F%2Fgoogle.com"))
 }
+
+func TestIsUpgradeRequest(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://foo.bar.com/", nil)
+	assert.False(t, IsUpgradeRequest(r))
+	r.Header.Set("Upgrade", "websocket")
+	assert.False(t, IsUpgradeRequest(r))
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	assert.True(t, IsUpgradeRequest(r))
+	r.Header.Del("Upgrade")
+	assert.False(t, IsUpgradeRequest(r))
+}